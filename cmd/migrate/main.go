@@ -0,0 +1,174 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"mywall-api/config"
+	"mywall-api/internal/database"
+	"mywall-api/migrations"
+
+	"github.com/joho/godotenv"
+)
+
+const usage = `Usage: go run ./cmd/migrate [flags] [command]
+
+Commands:
+  up            Apply all pending migrations (default)
+  status        Show applied and pending migrations
+  down [N]      Roll back the last N migrations (default 1)
+  redo          Roll back the last migration and apply it again
+  goto VERSION  Migrate up or down to VERSION, 0 rolls back everything
+  checksum --backfill
+                Record the checksum of applied migrations that have none, after
+                checking their files are what ran. Other commands do this too
+                and log each row, except with -strict, which refuses instead.
+
+Migrations embedded in the binary are used unless -dir is set. The database
+is chosen by DATABASE_URL, or DB_DRIVER when its scheme is not enough. MySQL
+migrations live at the root of the directory, PostgreSQL and SQLite ones in
+its postgres/ and sqlite/ subdirectories, e.g. -create name -dir migrations/sqlite.
+Every migration must be written for all three under the same file name, see
+migrations/README.md.
+
+Flags:
+`
+
+func main() {
+	// Load environment variables
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found")
+	}
+
+	// Parse command-line flags
+	create := flag.String("create", "", "Create a new migration")
+	migrationsDir := flag.String("dir", "", "Directory for migrations, instead of the embedded ones")
+	dryRun := flag.Bool("dry-run", false, "Print the SQL instead of executing it")
+	strict := flag.Bool("strict", false, "Fail instead of warning when an applied migration was modified")
+	lockTimeout := flag.Duration("lock-timeout", 0, "How long to wait for another migration run, defaults to MIGRATIONS_LOCK_TIMEOUT_SECONDS")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	// Create migration if requested, new files go to the source tree by default
+	if *create != "" {
+		dir := *migrationsDir
+		if dir == "" {
+			dir = "migrations"
+		}
+		filePath, err := database.CreateMigration(dir, *create)
+		if err != nil {
+			log.Fatalf("Failed to create migration: %v", err)
+		}
+		fmt.Printf("Created migration file: %s\n", filePath)
+		return
+	}
+
+	// Otherwise, run the command
+	cfg := config.New()
+	db, err := database.Connect(cfg.DBDriver, cfg.DatabaseURL)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	var source fs.FS = migrations.FS
+	if *migrationsDir != "" {
+		absPath, err := filepath.Abs(*migrationsDir)
+		if err != nil {
+			log.Fatalf("Failed to get absolute path: %v", err)
+		}
+		source = os.DirFS(absPath)
+	}
+	migrator := database.NewMigrator(db, source)
+	migrator.DryRun = *dryRun
+	migrator.Strict = *strict
+	migrator.LockTimeout = time.Duration(cfg.MigrationsLockTimeoutSeconds) * time.Second
+	if *lockTimeout > 0 {
+		migrator.LockTimeout = *lockTimeout
+	}
+
+	command := flag.Arg(0)
+	if command == "" {
+		command = "up"
+	}
+	switch command {
+	case "up":
+		if err := migrator.Up(); err != nil {
+			log.Fatalf("Failed to apply migrations: %v", err)
+		}
+		fmt.Println("All migrations applied successfully")
+	case "status":
+		printStatus(migrator)
+	case "down":
+		n := 1
+		if flag.NArg() > 1 {
+			n, err = strconv.Atoi(flag.Arg(1))
+			if err != nil || n < 1 {
+				log.Fatalf("Invalid number of migrations: %s", flag.Arg(1))
+			}
+		}
+		if err := migrator.Down(n); err != nil {
+			log.Fatalf("Failed to roll back migrations: %v", err)
+		}
+	case "redo":
+		if err := migrator.Redo(); err != nil {
+			log.Fatalf("Failed to redo migration: %v", err)
+		}
+	case "goto":
+		if flag.NArg() < 2 {
+			log.Fatal("goto requires a VERSION")
+		}
+		if err := migrator.Goto(flag.Arg(1)); err != nil {
+			log.Fatalf("Failed to migrate to %s: %v", flag.Arg(1), err)
+		}
+	case "checksum":
+		if flag.Arg(1) != "--backfill" && flag.Arg(1) != "-backfill" {
+			log.Fatal("checksum requires --backfill")
+		}
+		if err := migrator.BackfillChecksums(); err != nil {
+			log.Fatalf("Failed to backfill checksums: %v", err)
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+// printStatus prints one line per migration
+func printStatus(migrator *database.Migrator) {
+	statuses, err := migrator.Status()
+	if err != nil {
+		log.Fatalf("Failed to get migration status: %v", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STATUS\tAPPLIED AT\tMIGRATION")
+	pending := 0
+	for _, s := range statuses {
+		state, appliedAt := "pending", "-"
+		if s.Applied {
+			state = "applied"
+			appliedAt = s.AppliedAt.Format("2006-01-02 15:04:05")
+		} else {
+			pending++
+		}
+		if s.Missing {
+			state = "missing"
+		}
+		if s.Modified {
+			state = "modified"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", state, appliedAt, s.Name)
+	}
+	w.Flush()
+	fmt.Printf("\n%d migrations, %d pending\n", len(statuses), pending)
+}
@@ -1,17 +1,30 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
+	"fmt"
+	"io/fs"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
+	"time"
 
 	"mywall-api/config"
 	"mywall-api/internal/api"
 	"mywall-api/internal/database"
+	"mywall-api/internal/events"
 	"mywall-api/internal/auth"
+	"mywall-api/internal/notify"
+	"mywall-api/internal/storage"
+	"mywall-api/migrations"
 
 	"github.com/joho/godotenv"
+	"gorm.io/gorm"
 )
 
 func main() {
@@ -20,7 +33,7 @@ func main() {
 
 	// Parse command line flags
 	useSqlMigrations := flag.Bool("sql-migrations", false, "Use SQL migrations instead of GORM AutoMigrate")
-	migrationsDir := flag.String("migrations-dir", "migrations", "Directory for SQL migrations")
+	migrationsDir := flag.String("migrations-dir", "", "Directory for SQL migrations, instead of the embedded ones")
 	flag.Parse()
 
 	// Initialize config
@@ -32,21 +45,31 @@ func main() {
 	log.Printf("🔧 Debug mode: %t", cfg.Debug)
 
 	// Setup database
-	db, err := database.Connect(cfg.DatabaseURL)
+	db, err := database.Connect(cfg.DBDriver, cfg.DatabaseURL)
 	if err != nil {
 		log.Fatalf("❌ Failed to connect to database: %v", err)
 	}
-	log.Println("✅ Database connected successfully")
+	log.Printf("✅ Database connected successfully (%s)", db.Dialector.Name())
 
 	// Run migrations
 	if *useSqlMigrations {
-		absPath, err := filepath.Abs(*migrationsDir)
-		if err != nil {
-			log.Fatalf("❌ Failed to get absolute path for migrations: %v", err)
+		var source fs.FS = migrations.FS
+		if *migrationsDir != "" {
+			absPath, err := filepath.Abs(*migrationsDir)
+			if err != nil {
+				log.Fatalf("❌ Failed to get absolute path for migrations: %v", err)
+			}
+			source = os.DirFS(absPath)
+			log.Printf("📦 Running SQL migrations from %s", absPath)
+		} else {
+			log.Println("📦 Running embedded SQL migrations")
 		}
-		
-		log.Printf("📦 Running SQL migrations from %s", absPath)
-		if err := database.MigrateWithSQL(db, absPath); err != nil {
+
+		migrator := database.NewMigrator(db, source)
+		migrator.Strict = cfg.MigrationsStrict
+		// Replicas starting together wait here while the first one migrates
+		migrator.LockTimeout = time.Duration(cfg.MigrationsLockTimeoutSeconds) * time.Second
+		if err := migrator.Up(); err != nil {
 			log.Fatalf("❌ Failed to run SQL migrations: %v", err)
 		}
 		log.Println("✅ SQL migrations completed successfully")
@@ -59,11 +82,36 @@ func main() {
 	}
 
 	// Initialize auth service with JWT secret
-	authService := auth.NewService(db, cfg.JWTSecret)
+	authService := auth.NewService(db, cfg.JWTSecret,
+		time.Duration(cfg.JWTExpiryHours)*time.Hour,
+		time.Duration(cfg.RefreshExpiryHours)*time.Hour,
+	)
 	log.Println("✅ Auth service initialized")
 
+	// Initialize upload storage
+	store, err := newStorage(cfg)
+	if err != nil {
+		log.Fatalf("❌ Failed to initialize storage: %v", err)
+	}
+	log.Printf("✅ Storage initialized (%s)", cfg.StorageDriver)
+
+	// Initialize the real-time event bus
+	bus, err := newEventBus(cfg)
+	if err != nil {
+		log.Fatalf("❌ Failed to initialize event bus: %v", err)
+	}
+	defer bus.Close()
+	log.Printf("✅ Event bus initialized (%s)", cfg.EventBus)
+
+	// Initialize notification delivery channels
+	notifier, err := newNotifier(cfg, db)
+	if err != nil {
+		log.Fatalf("❌ Failed to initialize notification channels: %v", err)
+	}
+	log.Printf("✅ Notification dispatcher initialized (email: %t)", cfg.SMTPHost != "")
+
 	// Initialize and start the server
-	server := api.NewServer(db, authService)
+	server := api.NewServer(db, authService, cfg, store, bus, notifier)
 	
 	// Add environment-specific middleware if needed
 	if cfg.IsProduction() {
@@ -73,7 +121,37 @@ func main() {
 	}
 
 	log.Printf("🌐 Starting server on %s...", cfg.GetServerURL())
-	log.Fatal(server.Start(cfg.Port))
+	quit := make(chan os.Signal, 1)
+	go func() {
+		if err := server.Start(cfg.Port); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("❌ Server error: %v", err)
+			quit <- syscall.SIGTERM
+		}
+	}()
+
+	// Background jobs stop with the server
+	jobs, stopJobs := context.WithCancel(context.Background())
+	go server.RunJob(jobs, "digests", time.Minute, server.SendDueDigests)
+	go server.RunJob(jobs, "scheduled notifications",
+		time.Duration(cfg.SchedulerIntervalSeconds)*time.Second, server.DeliverDueNotifications)
+	go server.RunJob(jobs, "notification retention",
+		time.Duration(cfg.RetentionIntervalMinutes)*time.Minute, server.PurgeExpiredNotifications)
+
+	// Wait for a termination signal, then close WebSockets and drain requests
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	log.Println("🛑 Shutting down server...")
+	stopJobs()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("⚠️  Graceful shutdown incomplete: %v", err)
+	}
+	if err := notifier.Shutdown(ctx); err != nil {
+		log.Printf("⚠️  %v", err)
+	}
+	log.Println("✅ Server stopped")
 }
 
 // loadEnvFiles loads environment files based on current environment
@@ -95,4 +173,61 @@ func loadEnvFiles() {
 			log.Println("✅ Loaded environment from .env")
 		}
 	}
-}
\ No newline at end of file
+}
+
+// newStorage creates the upload storage selected by STORAGE_DRIVER
+func newStorage(cfg *config.Config) (storage.Storage, error) {
+	switch cfg.StorageDriver {
+	case "local":
+		return storage.NewLocal(cfg.StorageLocalDir), nil
+	case "s3":
+		return storage.NewS3(storage.S3Options{
+			Endpoint:  cfg.S3Endpoint,
+			Region:    cfg.S3Region,
+			Bucket:    cfg.S3Bucket,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+			Presign:   cfg.S3Presign,
+		})
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", cfg.StorageDriver)
+	}
+}
+
+// newEventBus creates the event bus selected by EVENT_BUS
+func newEventBus(cfg *config.Config) (events.Bus, error) {
+	switch cfg.EventBus {
+	case "memory":
+		return events.NewMemoryBus(), nil
+	case "redis":
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		return events.NewRedisBus(ctx, cfg.RedisURL, cfg.EventChannel)
+	default:
+		return nil, fmt.Errorf("unknown event bus %q", cfg.EventBus)
+	}
+}
+
+// newNotifier creates the notification dispatcher, email is only enabled when SMTP_HOST is set
+func newNotifier(cfg *config.Config, db *gorm.DB) (*notify.Dispatcher, error) {
+	channels := []notify.Channel{
+		notify.NewWebhook(cfg.WebhookSecret, time.Duration(cfg.WebhookTimeoutSeconds)*time.Second),
+	}
+	if cfg.SMTPHost != "" {
+		email, err := notify.NewSMTP(notify.SMTPOptions{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.SMTPFrom,
+		})
+		if err != nil {
+			return nil, err
+		}
+		channels = append(channels, email)
+	}
+	return notify.NewDispatcher(db, notify.RetryPolicy{
+		MaxAttempts: cfg.NotificationMaxAttempts,
+		Backoff:     time.Duration(cfg.NotificationRetrySeconds) * time.Second,
+	}, channels...), nil
+}
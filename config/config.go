@@ -7,27 +7,81 @@ import (
 
 // Config holds all configuration for the application
 type Config struct {
-	Environment      string
-	Port             string
-	JWTSecret        string
-	JWTExpiryHours   int
-	APIKeyHeader     string
-	DBHost           string
-	DBPort           string
-	DBUser           string
-	DBPassword       string
-	DBName           string
-	DatabaseURL      string
-	Domain           string
-	UseHTTPS         bool
-	Debug            bool
+	Environment        string
+	Port               string
+	JWTSecret          string
+	JWTExpiryHours     int
+	RefreshExpiryHours int
+	APIKeyHeader       string
+	DBHost             string
+	DBPort             string
+	DBUser             string
+	DBPassword         string
+	DBName             string
+	DatabaseURL        string
+	DBDriver           string // "mysql", "postgres" or "sqlite", detected from DatabaseURL when empty
+	Domain             string
+	UseHTTPS           bool
+	Debug              bool
+	// Refuse to start when an applied SQL migration was modified, instead of warning
+	MigrationsStrict bool
+	// How long a replica waits for another one to finish migrating
+	MigrationsLockTimeoutSeconds int
+
+	// Upload storage, "local" or "s3"
+	StorageDriver          string
+	StorageLocalDir        string
+	S3Endpoint             string
+	S3Region               string
+	S3Bucket               string
+	S3AccessKey            string
+	S3SecretKey            string
+	S3Presign              bool
+	SignedURLExpiryMinutes int
+
+	// Gallery renditions as name:max_pixels pairs, the original is always kept
+	ImageRenditions string
+	// Directory caching on the fly image transformations
+	ImageCacheDir string
+	// Size the transformation cache is kept under in megabytes, 0 disables eviction
+	ImageCacheMaxMB int
+	// Uploads larger than these are rejected as decompression bombs
+	MaxImagePixels    int
+	MaxImageDimension int
+
+	// Real-time event bus, "memory" for a single instance or "redis" to share events between instances
+	EventBus     string
+	RedisURL     string
+	EventChannel string
+	// Events kept per user for reconnecting clients, 0 disables replay
+	EventReplayLimit int
+
+	// Email notifications, disabled while SMTPHost is empty
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	SMTPFrom     string
+	// Outgoing notification webhooks are signed with WebhookSecret when set
+	WebhookSecret         string
+	WebhookTimeoutSeconds int
+	// Email and webhook deliveries are retried with exponential backoff
+	NotificationMaxAttempts  int
+	NotificationRetrySeconds int
+	// Unread notifications of these types coalesce within the window, as type:seconds pairs
+	NotificationCoalesce string
+	// Local hour daily and weekly digests are sent at, weekly ones on Monday
+	DigestHour int
+	// How often scheduled notifications are delivered and expired ones purged
+	SchedulerIntervalSeconds int
+	RetentionIntervalMinutes int
 }
 
 // New creates a new Config with values from environment variables
 func New() *Config {
 	// Get environment (default to development)
 	env := getEnv("APP_ENV", "development")
-	
+
 	// Get port with default
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -37,24 +91,74 @@ func New() *Config {
 	// Get JWT expiry hours
 	jwtExpiryHours, _ := strconv.Atoi(os.Getenv("JWT_EXPIRY_HOURS"))
 	if jwtExpiryHours == 0 {
-		jwtExpiryHours = 24 // default 24 hours
+		jwtExpiryHours = 1 // default 1 hour, renewed with refresh tokens
+	}
+
+	// Get refresh token expiry hours
+	refreshExpiryHours, _ := strconv.Atoi(os.Getenv("REFRESH_EXPIRY_HOURS"))
+	if refreshExpiryHours == 0 {
+		refreshExpiryHours = 720 // default 30 days
 	}
 
 	return &Config{
-		Environment:    env,
-		Port:           port,
-		JWTSecret:      os.Getenv("JWT_SECRET"),
-		JWTExpiryHours: jwtExpiryHours,
-		APIKeyHeader:   os.Getenv("API_KEY_HEADER"),
-		DatabaseURL:    os.Getenv("DATABASE_URL"),
-		DBHost:         os.Getenv("DB_HOST"),
-		DBPort:         os.Getenv("DB_PORT"),
-		DBUser:         os.Getenv("DB_USER"),
-		DBPassword:     os.Getenv("DB_PASSWORD"),
-		DBName:         os.Getenv("DB_NAME"),
-		Domain:         getDomain(env),
-		UseHTTPS:       getUseHTTPS(env),
-		Debug:          getDebug(env),
+		Environment:        env,
+		Port:               port,
+		JWTSecret:          os.Getenv("JWT_SECRET"),
+		JWTExpiryHours:     jwtExpiryHours,
+		RefreshExpiryHours: refreshExpiryHours,
+		APIKeyHeader:       os.Getenv("API_KEY_HEADER"),
+		DatabaseURL:        os.Getenv("DATABASE_URL"),
+		DBDriver:           os.Getenv("DB_DRIVER"),
+		DBHost:             os.Getenv("DB_HOST"),
+		DBPort:             os.Getenv("DB_PORT"),
+		DBUser:             os.Getenv("DB_USER"),
+		DBPassword:         os.Getenv("DB_PASSWORD"),
+		DBName:             os.Getenv("DB_NAME"),
+		Domain:             getDomain(env),
+		UseHTTPS:           getUseHTTPS(env),
+		Debug:              getDebug(env),
+		MigrationsStrict:   getEnvBool("MIGRATIONS_STRICT", env == "production"),
+
+		MigrationsLockTimeoutSeconds: getEnvInt("MIGRATIONS_LOCK_TIMEOUT_SECONDS", 300),
+
+		StorageDriver:          getEnv("STORAGE_DRIVER", "local"),
+		StorageLocalDir:        getEnv("STORAGE_LOCAL_DIR", "."),
+		S3Endpoint:             os.Getenv("S3_ENDPOINT"),
+		S3Region:               getEnv("S3_REGION", "us-east-1"),
+		S3Bucket:               os.Getenv("S3_BUCKET"),
+		S3AccessKey:            os.Getenv("S3_ACCESS_KEY"),
+		S3SecretKey:            os.Getenv("S3_SECRET_KEY"),
+		S3Presign:              getEnvBool("S3_PRESIGN", true),
+		SignedURLExpiryMinutes: getEnvInt("SIGNED_URL_EXPIRY_MINUTES", 15),
+
+		ImageRenditions: getEnv("IMAGE_RENDITIONS", "thumbnail:200,medium:1024"),
+		ImageCacheDir:   getEnv("IMAGE_CACHE_DIR", "cache/images"),
+		ImageCacheMaxMB: getEnvInt("IMAGE_CACHE_MAX_MB", 1024),
+
+		MaxImagePixels:    getEnvInt("MAX_IMAGE_PIXELS", 40000000),
+		MaxImageDimension: getEnvInt("MAX_IMAGE_DIMENSION", 10000),
+
+		EventBus:     getEnv("EVENT_BUS", "memory"),
+		RedisURL:     getEnv("REDIS_URL", "redis://localhost:6379/0"),
+		EventChannel: getEnv("EVENT_CHANNEL", "mywall:events"),
+
+		EventReplayLimit: getEnvInt("EVENT_REPLAY_LIMIT", 100),
+
+		SMTPHost:     os.Getenv("SMTP_HOST"),
+		SMTPPort:     getEnvInt("SMTP_PORT", 1025),
+		SMTPUsername: os.Getenv("SMTP_USERNAME"),
+		SMTPPassword: os.Getenv("SMTP_PASSWORD"),
+		SMTPFrom:     getEnv("SMTP_FROM", "MyWall <no-reply@localhost>"),
+
+		WebhookSecret:         os.Getenv("WEBHOOK_SECRET"),
+		WebhookTimeoutSeconds: getEnvInt("WEBHOOK_TIMEOUT_SECONDS", 10),
+
+		NotificationMaxAttempts:  getEnvInt("NOTIFICATION_MAX_ATTEMPTS", 5),
+		NotificationRetrySeconds: getEnvInt("NOTIFICATION_RETRY_SECONDS", 30),
+		NotificationCoalesce:     getEnv("NOTIFICATION_COALESCE", "gallery.created:300"),
+		DigestHour:               getEnvInt("DIGEST_HOUR", 8),
+		SchedulerIntervalSeconds: getEnvInt("SCHEDULER_INTERVAL_SECONDS", 15),
+		RetentionIntervalMinutes: getEnvInt("RETENTION_INTERVAL_MINUTES", 60),
 	}
 }
 
@@ -66,6 +170,22 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// Helper function to get an integer environment variable with default
+func getEnvInt(key string, defaultValue int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+// Helper function to get a boolean environment variable with default
+func getEnvBool(key string, defaultValue bool) bool {
+	if value, err := strconv.ParseBool(os.Getenv(key)); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
 // Get domain based on environment
 func getDomain(env string) string {
 	if env == "production" {
@@ -108,4 +228,4 @@ func (c *Config) GetServerURL() string {
 		return "https://" + c.Domain
 	}
 	return "http://" + c.Domain + ":" + c.Port
-}
\ No newline at end of file
+}
@@ -0,0 +1,22 @@
+package api
+
+import "testing"
+
+func TestRedactCredentials(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/api/galleries", "/api/galleries"},
+		{"/ws?topics=galleries", "/ws?topics=galleries"},
+		{"/ws?token=secret.jwt.value", "/ws?token=REDACTED"},
+		{"/ws?api_key=abc&last_event_id=7", "/ws?api_key=REDACTED&last_event_id=7"},
+		{"/ws?topics=a&token=x&token=y", "/ws?token=REDACTED&topics=a"},
+		{"/ws?token=%zz", "/ws"},
+	}
+	for _, tt := range tests {
+		if got := redactCredentials(tt.path); got != tt.want {
+			t.Errorf("redactCredentials(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
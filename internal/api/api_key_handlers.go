@@ -0,0 +1,110 @@
+package api
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"mywall-api/internal/auth"
+	"mywall-api/internal/helpers"
+)
+
+type ApiKeyRequest struct {
+	Name      string     `json:"name" binding:"required,max=100"`
+	Scopes    []string   `json:"scopes" binding:"dive,max=50"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+func (s *Server) listApiKeys(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	keys, err := s.auth.ListAPIKeys(userID)
+	if err != nil {
+		helpers.InternalServerError(c, "Failed to retrieve API keys")
+		return
+	}
+	helpers.Success(c, "API keys retrieved successfully", keys)
+}
+
+func (s *Server) createApiKey(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	var req ApiKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		if validationErrors, ok := err.(validator.ValidationErrors); ok {
+			errorMessages := make(map[string]string)
+			for _, e := range validationErrors {
+				switch e.Field() {
+				case "Name":
+					if e.Tag() == "required" {
+						errorMessages["name"] = "Name is required"
+					} else if e.Tag() == "max" {
+						errorMessages["name"] = "Name must not exceed 100 characters"
+					}
+				default:
+					errorMessages["scopes"] = "Invalid scope"
+				}
+			}
+			helpers.ValidationError(c, "Validation failed", errorMessages)
+			return
+		}
+		helpers.BadRequest(c, "Invalid request data")
+		return
+	}
+
+	if req.ExpiresAt != nil && req.ExpiresAt.Before(time.Now()) {
+		helpers.ValidationError(c, "Validation failed", map[string]string{
+			"expires_at": "Expiry must be in the future",
+		})
+		return
+	}
+
+	// A key may only create keys with a subset of its own scopes
+	if held, ok := c.Get("api_key_scopes"); ok {
+		if len(req.Scopes) == 0 {
+			req.Scopes = held.([]string)
+		}
+		if len(req.Scopes) == 0 || !auth.ScopesWithin(req.Scopes, held.([]string)) {
+			helpers.Forbidden(c, "API key cannot grant scopes it does not hold")
+			return
+		}
+	}
+
+	apiKey, key, err := s.auth.CreateAPIKey(userID, req.Name, req.Scopes, req.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidScope) {
+			helpers.ValidationError(c, "Validation failed", map[string]string{
+				"scopes": "Scopes must be *, resource:*, resource:read or resource:write",
+			})
+			return
+		}
+		helpers.InternalServerError(c, "Failed to create API key")
+		return
+	}
+
+	// The plaintext key is only shown once
+	helpers.Created(c, "API key created successfully", gin.H{
+		"api_key": apiKey,
+		"key":     key,
+	})
+}
+
+func (s *Server) revokeApiKey(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		helpers.BadRequest(c, "Invalid ID format")
+		return
+	}
+
+	key, err := s.auth.RevokeAPIKey(userID, uint(id))
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidAPIKey) {
+			helpers.NotFound(c, "API key not found")
+			return
+		}
+		helpers.InternalServerError(c, "Failed to revoke API key")
+		return
+	}
+	helpers.Success(c, "API key revoked", key)
+}
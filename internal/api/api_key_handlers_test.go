@@ -0,0 +1,62 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCreateApiKeyScopes(t *testing.T) {
+	ts := newTestServer(t)
+	userID, token := ts.login(t, "user@example.com", false)
+
+	code, resp := ts.do(t, "POST", "/api/api-keys", token, gin.H{"name": "bad", "scopes": []string{"galleries:fly"}})
+	if code != http.StatusUnprocessableEntity {
+		t.Fatalf("invalid scope = %d %v", code, resp)
+	}
+	code, resp = ts.do(t, "POST", "/api/api-keys", token, gin.H{"name": "all", "scopes": []string{"*"}})
+	if code != http.StatusCreated {
+		t.Fatalf("full access from a session = %d %v", code, resp)
+	}
+
+	apiKey, _, err := ts.auth.CreateAPIKey(userID, "limited", []string{"galleries:read", "api-keys:write"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withKey := func(method, path string, body interface{}) int {
+		t.Helper()
+		raw, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, path, bytes.NewReader(raw))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", apiKey)
+		w := httptest.NewRecorder()
+		ts.router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// A key cannot mint a key with more access than itself
+	for _, scopes := range [][]string{{"*"}, {"galleries:*"}, {"categories:read"}} {
+		if code := withKey("POST", "/api/api-keys", gin.H{"name": "escalate", "scopes": scopes}); code != http.StatusForbidden {
+			t.Errorf("key creating %v = %d, want 403", scopes, code)
+		}
+	}
+	if code := withKey("POST", "/api/regenerate-api-key", nil); code != http.StatusForbidden {
+		t.Errorf("key regenerating the full access key = %d, want 403", code)
+	}
+	if code := withKey("POST", "/api/api-keys", gin.H{"name": "subset", "scopes": []string{"galleries:read"}}); code != http.StatusCreated {
+		t.Errorf("key creating a subset = %d, want 201", code)
+	}
+
+	// Without scopes the new key inherits the caller's
+	if code := withKey("POST", "/api/api-keys", gin.H{"name": "inherit"}); code != http.StatusCreated {
+		t.Fatalf("key creating without scopes = %d, want 201", code)
+	}
+	keys, _ := ts.auth.ListAPIKeys(userID)
+	if keys[0].Name != "inherit" || keys[0].Scopes != "galleries:read,api-keys:write" {
+		t.Fatalf("inherited key = %s %q", keys[0].Name, keys[0].Scopes)
+	}
+}
@@ -1,6 +1,9 @@
 package api
 
 import (
+	"errors"
+	"log"
+	"mywall-api/internal/auth"
 	"mywall-api/internal/models"
 	"net/http"
 
@@ -14,6 +17,10 @@ type RegisterRequest struct {
 	Name     string `json:"name" binding:"required"`
 }
 
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
 type LoginRequest struct {
 	Email    string `json:"email" binding:"required,email"`
 	Password string `json:"password" binding:"required"`
@@ -52,26 +59,28 @@ func (s *Server) handleRegister(c *gin.Context) {
 		return
 	}
 
-	user, err := s.auth.Register(req.Email, req.Password, req.Name)
+	user, apiKey, err := s.auth.Register(req.Email, req.Password, req.Name)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
 	// Generate initial JWT token
-	token, err := s.auth.Login(req.Email, req.Password)
+	tokens, err := s.auth.Login(req.Email, req.Password)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
 	c.JSON(http.StatusCreated, gin.H{
-		"token": token,
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
 		"user": gin.H{
 			"id":      user.ID,
 			"email":   user.Email,
 			"name":    user.Name,
-			"api_key": user.ApiKey,
+			"api_key": apiKey,
 		},
 	})
 }
@@ -83,7 +92,7 @@ func (s *Server) handleLogin(c *gin.Context) {
 		return
 	}
 
-	token, err := s.auth.Login(req.Email, req.Password)
+	tokens, err := s.auth.Login(req.Email, req.Password)
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
@@ -97,16 +106,62 @@ func (s *Server) handleLogin(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"token": token,
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
 		"user": gin.H{
-			"id":      user.ID,
-			"email":   user.Email,
-			"name":    user.Name,
-			"api_key": user.ApiKey,
+			"id":    user.ID,
+			"email": user.Email,
+			"name":  user.Name,
 		},
 	})
 }
 
+func (s *Server) handleRefresh(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	tokens, err := s.auth.Refresh(req.RefreshToken)
+	if err != nil {
+		if errors.Is(err, auth.ErrTokenReused) {
+			log.Printf("Refresh token reuse detected from %s, session revoked", c.ClientIP())
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token reuse detected, session revoked"})
+			return
+		}
+		// A session ended by logout is not a security event
+		if errors.Is(err, auth.ErrTokenRevoked) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token revoked"})
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+func (s *Server) handleLogout(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	if err := s.auth.Logout(req.RefreshToken); err != nil {
+		if errors.Is(err, auth.ErrInvalidToken) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to logout"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+}
+
 func (s *Server) handleRegenerateApiKey(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
@@ -114,6 +169,12 @@ func (s *Server) handleRegenerateApiKey(c *gin.Context) {
 		return
 	}
 
+	// The default key has full access, a scoped key cannot issue it
+	if held, ok := c.Get("api_key_scopes"); ok && !auth.ScopesWithin([]string{auth.FullAccessScope}, held.([]string)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "API key cannot grant scopes it does not hold"})
+		return
+	}
+
 	apiKey, err := s.auth.RegenerateAPIKey(userID.(uint))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to regenerate API key"})
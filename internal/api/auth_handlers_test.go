@@ -0,0 +1,35 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRefreshAfterLogoutIsNotReuse(t *testing.T) {
+	ts := newTestServer(t)
+	ts.login(t, "user@example.com", false)
+	tokens, err := ts.auth.Login("user@example.com", "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if code, resp := ts.do(t, "POST", "/auth/logout", "", gin.H{"refresh_token": tokens.RefreshToken}); code != http.StatusOK {
+		t.Fatalf("logout = %d %v", code, resp)
+	}
+	code, resp := ts.do(t, "POST", "/auth/refresh", "", gin.H{"refresh_token": tokens.RefreshToken})
+	if code != http.StatusUnauthorized || resp["error"] != "Refresh token revoked" {
+		t.Fatalf("refresh after logout = %d %v", code, resp)
+	}
+
+	// A rotated token presented again is reuse
+	tokens, _ = ts.auth.Login("user@example.com", "password123")
+	if code, resp := ts.do(t, "POST", "/auth/refresh", "", gin.H{"refresh_token": tokens.RefreshToken}); code != http.StatusOK {
+		t.Fatalf("refresh = %d %v", code, resp)
+	}
+	code, resp = ts.do(t, "POST", "/auth/refresh", "", gin.H{"refresh_token": tokens.RefreshToken})
+	if code != http.StatusUnauthorized || resp["error"] != "Refresh token reuse detected, session revoked" {
+		t.Fatalf("refresh of a rotated token = %d %v", code, resp)
+	}
+}
@@ -4,13 +4,15 @@ import (
 	"mywall-api/internal/models"
 	"math"
 	"strconv"
-	"os"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"mywall-api/internal/helpers"
 )
 
+// categoryImageSize is the maximum width and height of a category image
+const categoryImageSize = 50
+
 type CategoryRequest struct {
 	Name    	string `json:"name" binding:"required,max=50"`
 }
@@ -166,8 +168,8 @@ func (s *Server) createCategory(c *gin.Context) {
 	defer file.Close()
 	
 	// Validate file type using shared utility function
-	if !IsValidImageFile(header.Filename) {
-		helpers.BadRequest(c, "Invalid file type. Only JPG, JPEG, and PNG files are allowed")
+	if !IsValidImageFileExtended(header.Filename) {
+		helpers.BadRequest(c, "Invalid file type. Only JPG, JPEG, PNG, GIF and WebP files are allowed")
 		return
 	}
 	
@@ -178,8 +180,14 @@ func (s *Server) createCategory(c *gin.Context) {
 		return
 	}
 
+	// Verify the actual bytes and strip metadata
+	upload, ok := s.sanitizeUpload(c, file, header)
+	if !ok {
+		return
+	}
+
 	// Save and optimize the uploaded image (resize + compress)
-	filePath, err := SaveAndOptimizeImage(file, header)
+	filePath, err := SaveAndOptimizeImage(c.Request.Context(), s.storage, upload, categoryImageSize)
 	if err != nil {
 		helpers.InternalServerError(c, "Failed to save image file")
 		return
@@ -194,7 +202,7 @@ func (s *Server) createCategory(c *gin.Context) {
 	
 	if result := s.db.Create(&category); result.Error != nil {
 		// If database creation fails and we uploaded a file, clean it up
-		os.Remove(finalImageURL)
+		s.storage.Delete(c.Request.Context(), finalImageURL)
 		helpers.InternalServerError(c, "Failed to create category")
 		return
 	}
@@ -231,8 +239,8 @@ func (s *Server) updateCategory(c *gin.Context) {
 		defer file.Close()
 		
 		// Validate file type using shared utility function
-		if !IsValidImageFile(header.Filename) {
-			helpers.BadRequest(c, "Invalid file type. Only JPG, JPEG, and PNG files are allowed")
+		if !IsValidImageFileExtended(header.Filename) {
+			helpers.BadRequest(c, "Invalid file type. Only JPG, JPEG, PNG, GIF and WebP files are allowed")
 			return
 		}
 		
@@ -243,8 +251,14 @@ func (s *Server) updateCategory(c *gin.Context) {
 			return
 		}
 
+		// Verify the actual bytes and strip metadata
+		upload, ok := s.sanitizeUpload(c, file, header)
+		if !ok {
+			return
+		}
+
 		// Save and optimize the uploaded image (resize + compress)
-		newFilePath, err := SaveAndOptimizeImage(file, header)
+		newFilePath, err := SaveAndOptimizeImage(c.Request.Context(), s.storage, upload, categoryImageSize)
 		if err != nil {
 			helpers.InternalServerError(c, "Failed to save image file")
 			return
@@ -259,14 +273,14 @@ func (s *Server) updateCategory(c *gin.Context) {
 		// Save to database first
 		if result := s.db.Save(&category); result.Error != nil {
 			// If database update fails, clean up the new file
-			os.Remove(newFilePath)
+			s.storage.Delete(c.Request.Context(), newFilePath)
 			helpers.InternalServerError(c, "Failed to update category")
 			return
 		}
 
 		// Delete old image file if it exists and update was successful
 		if oldImagePath != "" {
-			if err := os.Remove(oldImagePath); err != nil {
+			if err := s.storage.Delete(c.Request.Context(), oldImagePath); err != nil {
 				// Log the error but don't fail the update
 				// fmt.Printf("Warning: Failed to delete old image file %s: %v\n", oldImagePath, err)
 			}
@@ -311,8 +325,8 @@ func (s *Server) updateCategory(c *gin.Context) {
 		defer file.Close()
 		
 		// Validate file type using shared utility function
-		if !IsValidImageFile(header.Filename) {
-			helpers.BadRequest(c, "Invalid file type. Only JPG, JPEG, and PNG files are allowed")
+		if !IsValidImageFileExtended(header.Filename) {
+			helpers.BadRequest(c, "Invalid file type. Only JPG, JPEG, PNG, GIF and WebP files are allowed")
 			return
 		}
 		
@@ -375,7 +389,7 @@ func (s *Server) deleteCategory(c *gin.Context) {
 
 	// Delete associated image file if it exists
 	if category.ImageURL != "" {
-		if err := os.Remove(category.ImageURL); err != nil {
+		if err := s.storage.Delete(c.Request.Context(), category.ImageURL); err != nil {
 			// Log the error but don't fail the deletion
 			// You might want to use your logging system here
 			// fmt.Printf("Warning: Failed to delete image file %s: %v\n", category.ImageURL, err)
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"mywall-api/internal/helpers"
+)
+
+const (
+	// sseHeartbeat keeps proxies from closing an idle stream
+	sseHeartbeat = 25 * time.Second
+	// sseRetry is the reconnect delay suggested to EventSource clients, in milliseconds
+	sseRetry = 3000
+)
+
+// streamEvents serves the WebSocket messages as Server-Sent Events for clients
+// behind proxies that block upgrades. Each message is sent with its type as the
+// event name and the whole message as data; events also carry their ID so a
+// reconnecting EventSource resumes through Last-Event-ID.
+func (s *Server) streamEvents(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	var scopes []string
+	if value, ok := c.Get("api_key_scopes"); ok {
+		scopes = value.([]string)
+		if scopes == nil {
+			scopes = []string{}
+		}
+	}
+
+	resume, err := wsResumeParams(c)
+	if err != nil {
+		helpers.BadRequest(c, err.Error())
+		return
+	}
+	// EventSource sends Last-Event-ID by itself when it reconnects
+	if header := c.GetHeader("Last-Event-ID"); header != "" {
+		id, err := strconv.ParseUint(strings.TrimSpace(header), 10, 64)
+		if err != nil {
+			helpers.BadRequest(c, "Invalid Last-Event-ID")
+			return
+		}
+		resume.lastEventID = id
+		resume.replay = true
+	}
+
+	client := newStreamClient(nil, c.ClientIP(), userID, scopes, s.ws.queueSize())
+	for _, topic := range resume.topics {
+		if s.authorizeTopic(client, topic) == nil {
+			client.subscribe(topic)
+		}
+	}
+	client.enqueue(Message{
+		Type:    "connected",
+		Payload: map[string]interface{}{"user_id": userID, "topics": client.topicList()},
+	})
+	if !s.ws.register(client, resume) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Server shutting down"})
+		return
+	}
+	defer s.ws.unregister(client)
+	defer client.close(0, "")
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // disable nginx response buffering
+	c.Status(http.StatusOK)
+
+	w := c.Writer
+	rc := http.NewResponseController(w)
+	fmt.Fprintf(w, "retry: %d\n\n", sseRetry)
+	w.Flush()
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case message := <-client.send:
+			rc.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := writeSSE(w, message); err != nil {
+				return
+			}
+			w.Flush()
+		case <-heartbeat.C:
+			rc.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			w.Flush()
+		case <-client.done:
+			return
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+}
+
+// writeSSE writes one message as an event, only events get an id line
+func writeSSE(w gin.ResponseWriter, message Message) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	if message.ID != 0 {
+		if _, err := fmt.Fprintf(w, "id: %d\n", message.ID); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", message.Type, data)
+	return err
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sseEvent is one parsed text/event-stream event
+type sseEvent struct {
+	id      string
+	event   string
+	message Message
+}
+
+// openSSE connects to /api/events and returns a channel of its events
+func openSSE(t *testing.T, url, token, lastEventID string) (<-chan sseEvent, context.CancelFunc) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	req, _ := http.NewRequestWithContext(ctx, "GET", url+"/api/events", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		t.Fatalf("GET /api/events = %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	events := make(chan sseEvent, 16)
+	go func() {
+		defer resp.Body.Close()
+		defer close(events)
+		scanner := bufio.NewScanner(resp.Body)
+		var current sseEvent
+		for scanner.Scan() {
+			line := scanner.Text()
+			field, value, _ := strings.Cut(line, ": ")
+			switch field {
+			case "":
+				if current.event != "" {
+					events <- current
+				}
+				current = sseEvent{}
+			case "id":
+				current.id = value
+			case "event":
+				current.event = value
+			case "data":
+				json.Unmarshal([]byte(value), &current.message)
+			}
+		}
+	}()
+	return events, cancel
+}
+
+func nextSSE(t *testing.T, events <-chan sseEvent) sseEvent {
+	t.Helper()
+	select {
+	case event, ok := <-events:
+		if !ok {
+			t.Fatal("stream closed")
+		}
+		return event
+	case <-time.After(2 * time.Second):
+		t.Fatal("no event within 2s")
+	}
+	return sseEvent{}
+}
+
+func TestSSEResumesFromLastEventID(t *testing.T) {
+	ts, srv := newWSTestServer(t)
+	aliceID, aliceToken := ts.login(t, "alice@example.com", false)
+	bobID, _ := ts.login(t, "bob@example.com", false)
+
+	events, disconnect := openSSE(t, srv.URL, aliceToken, "")
+	if event := nextSSE(t, events); event.event != "connected" || event.id != "" {
+		t.Fatalf("first event = %+v", event)
+	}
+	for i := 1; i <= 2; i++ {
+		ts.ws.BroadcastNotification(aliceID, map[string]interface{}{"title": "seen " + strconv.Itoa(i)})
+	}
+	var lastID string
+	for i := 1; i <= 2; i++ {
+		event := nextSSE(t, events)
+		if event.event != "notification" || event.id == "" || event.id != strconv.FormatUint(event.message.ID, 10) {
+			t.Fatalf("event %d = %+v", i, event)
+		}
+		lastID = event.id
+	}
+	disconnect()
+
+	// Missed while disconnected, bob's event is not for alice
+	ts.ws.BroadcastNotification(aliceID, map[string]interface{}{"title": "missed 1"})
+	ts.ws.BroadcastNotification(bobID, map[string]interface{}{"title": "for bob"})
+	ts.ws.BroadcastBadgeUpdate(aliceID, 3)
+
+	events, _ = openSSE(t, srv.URL, aliceToken, lastID)
+	if event := nextSSE(t, events); event.event != "connected" {
+		t.Fatalf("first event after reconnect = %+v", event)
+	}
+	if event := nextSSE(t, events); event.event != "notification" || event.message.Payload.(map[string]interface{})["title"] != "missed 1" {
+		t.Fatalf("first replayed event = %+v", event)
+	}
+	if event := nextSSE(t, events); event.event != "badge_update" {
+		t.Fatalf("second replayed event = %+v", event)
+	}
+	event := nextSSE(t, events)
+	if event.event != "replay_complete" || event.message.Payload.(map[string]interface{})["replayed"].(float64) != 2 {
+		t.Fatalf("after replay = %+v", event)
+	}
+
+	// Live events follow the replay
+	ts.ws.BroadcastNotification(aliceID, map[string]interface{}{"title": "live"})
+	if event := nextSSE(t, events); event.message.Payload.(map[string]interface{})["title"] != "live" {
+		t.Fatalf("live event = %+v", event)
+	}
+}
+
+func TestSSEInvalidLastEventID(t *testing.T) {
+	ts := newTestServer(t)
+	_, token := ts.login(t, "alice@example.com", false)
+	req := httptest.NewRequest("GET", "/api/events", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Last-Event-ID", "abc")
+	w := httptest.NewRecorder()
+	ts.router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("GET /api/events = %d, want 400", w.Code)
+	}
+}
@@ -3,8 +3,7 @@ package api
 import (
 	"mywall-api/internal/models"
 	// "net/http"
-	"fmt"
-	"os"
+	"context"
 	"strconv"
 	"strings"
 	"math"
@@ -14,8 +13,10 @@ import (
 	"gorm.io/gorm"
 	"math/rand"
 	"errors"
-	
-	// "log"
+	"log"
+
+	"mywall-api/internal/notify"
+	"mywall-api/internal/storage"
 )
 type GalleryRequest struct {
 	Title    	string `json:"title" binding:"required,max=100"`
@@ -188,8 +189,8 @@ func (s *Server) createGallery(c *gin.Context) {
 	defer file.Close()
 	
 	// Validate file type
-	if !IsValidImageFile(header.Filename) {
-		helpers.BadRequest(c, "Invalid file type. Only JPG and PNG files are allowed")
+	if !IsValidImageFileExtended(header.Filename) {
+		helpers.BadRequest(c, "Invalid file type. Only JPG, PNG, GIF and WebP files are allowed")
 		return
 	}
 	
@@ -214,8 +215,14 @@ func (s *Server) createGallery(c *gin.Context) {
 		return
 	}
 	
-	// Create directory structure and save file
-	filePath, err := SaveUploadedFile(file, header)
+	// Verify the actual bytes and strip metadata
+	upload, ok := s.sanitizeUpload(c, file, header)
+	if !ok {
+		return
+	}
+
+	// Save the original and its renditions
+	filePath, renditions, err := SaveImageWithRenditions(c.Request.Context(), s.storage, s.renditions, upload)
 	if err != nil {
 		helpers.InternalServerError(c, "Failed to save image file")
 		return
@@ -228,35 +235,28 @@ func (s *Server) createGallery(c *gin.Context) {
 		Title:       req.Title,
 		Description: req.Description,
 		ImageURL:    finalImageURL,
+		Renditions:  renditions,
 		CategoryID:  req.CategoryID,
 		UserID:      userID,
 	}
 
-    // Panggil NotificationHandlers
-	notifHandler := &NotificationHandlers{db: s.db}
-	_ = notifHandler.CreateNotificationDirect(
-		userID,
-		"Gallery Created",
-		"A new gallery has been created",
-		"message",
-		map[string]interface{}{"title": gallery.Title},
-	)
-
-
-	// h := &NotificationHandlers{}
-	// h.createNotification(s.db, userID, "Gallery Created", "A new gallery has been created", "gallery", map[string]string{
-	// 	"title": gallery.Title,
-	// })
-	
 	if result := s.db.Create(&gallery); result.Error != nil {
 		// If database creation fails, clean up the uploaded file
-		os.Remove(finalImageURL)
+		DeleteRenditions(c.Request.Context(), s.storage, renditions)
 		helpers.InternalServerError(c, "Failed to create gallery")
 		return
 	}
+
+	// Notify the owner once the gallery exists, in their language
+	if err := s.notifications().Notify(userID, notify.EventGalleryCreated, map[string]interface{}{
+		"gallery_id": gallery.ID,
+		"title":      gallery.Title,
+	}); err != nil {
+		log.Printf("Failed to notify gallery creation: %v", err)
+	}
 	
-	// Broadcast ke semua connected clients
-	BroadcastNewGallery(map[string]interface{}{
+	// Broadcast ke owner dan subscribers
+	s.ws.BroadcastNewGallery(gallery, map[string]interface{}{
 		"ID":          gallery.ID,
 		"title":       gallery.Title,
 		"description": gallery.Description,
@@ -317,7 +317,6 @@ func (s *Server) updateGallery(c *gin.Context) {
 
 	// 5. Validasi dan konversi category_id
 	categoryID := input.CategoryID
-	fmt.Printf("Input received: %+v\n", categoryID)
 	if err != nil {
 		helpers.BadRequest(c, "Invalid category_id format")
 		return
@@ -335,41 +334,39 @@ func (s *Server) updateGallery(c *gin.Context) {
 	}
 
 	// 7. Handle file upload jika ada
+	previousCategoryID := gallery.CategoryID
 	imageURL := gallery.ImageURL // default gunakan URL yang sudah ada
+	renditions := gallery.Renditions
+	previousImageURL, previousRenditions := gallery.ImageURL, gallery.Renditions
+	replaced := false
 	
 	file, header, err := c.Request.FormFile("image")
 	if err == nil && header != nil {
 		defer file.Close()
 		
-		// Validasi file type
-		allowedTypes := map[string]bool{
-			"image/jpeg": true,
-			"image/jpg":  true,
-			"image/png":  true,
-			"image/gif":  true,
-		}
-		
-		contentType := header.Header.Get("Content-Type")
-		if !allowedTypes[contentType] {
-			helpers.BadRequest(c, "Invalid file type. Only JPEG, PNG, GIF allowed")
-			return
-		}
-		
 		// Validasi file size (max 5MB)
 		if header.Size > 5*1024*1024 {
 			helpers.BadRequest(c, "File too large. Maximum size is 5MB")
 			return
 		}
+
+		// Validasi file type dari isi file, bukan header Content-Type
+		upload, ok := s.sanitizeUpload(c, file, header)
+		if !ok {
+			return
+		}
 		
 		// Upload file (contoh ke local storage atau cloud)
 		// uploadedURL, err := s.uploadImage(file, header)
-		uploadedURL, err := SaveUploadedFile(file, header)
+		uploadedURL, uploadedRenditions, err := SaveImageWithRenditions(c.Request.Context(), s.storage, s.renditions, upload)
 		if err != nil {
 			helpers.InternalServerError(c, "Failed to upload image: "+err.Error())
 			return
 		}
 		
 		imageURL = uploadedURL
+		renditions = uploadedRenditions
+		replaced = true
 	}
 
 	// 8. Update gallery dengan error handling
@@ -377,14 +374,23 @@ func (s *Server) updateGallery(c *gin.Context) {
 		Title:       input.Title,
 		Description: input.Description,
 		ImageURL:    imageURL,
+		Renditions:  renditions,
 		CategoryID:  categoryID,
 	}
 
 	if err := s.db.Model(&gallery).Updates(updateData).Error; err != nil {
+		if replaced {
+			DeleteRenditions(c.Request.Context(), s.storage, renditions)
+		}
 		helpers.InternalServerError(c, "Failed to update gallery")
 		return
 	}
 
+	// Remove the replaced image files
+	if replaced {
+		s.deleteGalleryImages(c.Request.Context(), previousImageURL, previousRenditions)
+	}
+
 	// 9. Reload data yang sudah diupdate untuk response
 	if err := s.db.First(&gallery, gallery.ID).Error; err != nil {
 		helpers.InternalServerError(c, "Failed to reload gallery data")
@@ -392,7 +398,7 @@ func (s *Server) updateGallery(c *gin.Context) {
 	}
 
 	// Broadcast update
-	BroadcastUpdateGallery(map[string]interface{}{
+	s.ws.BroadcastUpdateGallery(gallery, previousCategoryID, map[string]interface{}{
 		"ID":          gallery.ID,
 		"title":       gallery.Title,
 		"description": gallery.Description,
@@ -445,6 +451,15 @@ func generateRandomString(length int) string {
 	return string(b)
 }
 
+// deleteGalleryImages removes the original and every rendition of a gallery
+// image. Galleries from before renditions only recorded their original in image_url.
+func (s *Server) deleteGalleryImages(ctx context.Context, imageURL, renditions string) {
+	DeleteRenditions(ctx, s.storage, renditions)
+	if key := strings.TrimPrefix(imageURL, "/"); strings.HasPrefix(key, storage.UploadPrefix+"/") {
+		s.storage.Delete(ctx, key)
+	}
+}
+
 func (s *Server) deleteGallery(c *gin.Context) {
 	userID := c.GetUint("user_id")
 	id := c.Param("id")
@@ -453,9 +468,13 @@ func (s *Server) deleteGallery(c *gin.Context) {
 		helpers.NotFound(c, "Gallery not found")
 		return
 	}
-	s.db.Delete(&gallery)
+	if err := s.db.Delete(&gallery).Error; err != nil {
+		helpers.InternalServerError(c, "Failed to delete gallery")
+		return
+	}
+	s.deleteGalleryImages(c.Request.Context(), gallery.ImageURL, gallery.Renditions)
 	// Broadcast delete
-	BroadcastDeleteGallery(id)
+	s.ws.BroadcastDeleteGallery(gallery)
 
 	helpers.Success(c, "Gallery deleted", gallery)	
 }
@@ -0,0 +1,200 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"mywall-api/internal/models"
+	"mywall-api/internal/storage"
+)
+
+func testPNG(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 20, 20))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// putGalleryImage replaces the gallery image through PUT /api/galleries/:id
+func putGalleryImage(t *testing.T, ts *testServer, token string, gallery models.Gallery) models.Gallery {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("title", gallery.Title)
+	form.WriteField("category_id", strconv.FormatUint(uint64(gallery.CategoryID), 10))
+	part, _ := form.CreateFormFile("image", "new.png")
+	part.Write(testPNG(t))
+	form.Close()
+
+	req := httptest.NewRequest("PUT", "/api/galleries/"+strconv.FormatUint(uint64(gallery.ID), 10), &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	ts.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("update = %d %s", w.Code, w.Body.String())
+	}
+
+	var updated models.Gallery
+	ts.db.First(&updated, gallery.ID)
+	return updated
+}
+
+func storedKeys(t *testing.T, store storage.Storage, keys ...string) map[string]bool {
+	t.Helper()
+	exists := make(map[string]bool)
+	for _, key := range keys {
+		_, err := store.Stat(context.Background(), key)
+		exists[key] = err == nil
+	}
+	return exists
+}
+
+func newGalleryTestServer(t *testing.T) (*testServer, string, models.Category) {
+	t.Helper()
+	ts := newTestServer(t)
+	ts.storage = storage.NewLocal(t.TempDir())
+	adminID, token := ts.login(t, "admin@example.com", true)
+	category := models.Category{Name: "Nature", UserID: adminID, ImageURL: "x"}
+	if err := ts.db.Create(&category).Error; err != nil {
+		t.Fatal(err)
+	}
+	return ts, token, category
+}
+
+func TestUpdateGalleryDeletesPreviousOriginal(t *testing.T) {
+	ts, token, category := newGalleryTestServer(t)
+
+	// A gallery from before renditions, only image_url is recorded
+	oldKey := "uploads/2024/01/02/old.png"
+	data := testPNG(t)
+	ts.storage.Save(context.Background(), oldKey, bytes.NewReader(data), int64(len(data)), "image/png")
+	gallery := models.Gallery{Title: "Sunset", ImageURL: "/" + oldKey, CategoryID: category.ID, UserID: category.UserID}
+	ts.db.Create(&gallery)
+
+	updated := putGalleryImage(t, ts, token, gallery)
+
+	exists := storedKeys(t, ts.storage, oldKey, updated.ImageURL)
+	if exists[oldKey] || !exists[updated.ImageURL] {
+		t.Fatalf("after update %v", exists)
+	}
+}
+
+func TestUpdateGalleryDeletesPreviousRenditions(t *testing.T) {
+	ts, token, category := newGalleryTestServer(t)
+
+	upload, err := SanitizeImage(bytes.NewReader(testPNG(t)), "old.png", ts.imageLimits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	originalKey, renditionsJSON, err := SaveImageWithRenditions(context.Background(), ts.storage, ts.renditions, upload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gallery := models.Gallery{Title: "Forest", ImageURL: originalKey, Renditions: renditionsJSON, CategoryID: category.ID, UserID: category.UserID}
+	ts.db.Create(&gallery)
+
+	updated := putGalleryImage(t, ts, token, gallery)
+
+	var oldKeys, newKeys map[string]string
+	json.Unmarshal([]byte(renditionsJSON), &oldKeys)
+	json.Unmarshal([]byte(updated.Renditions), &newKeys)
+	if len(oldKeys) < 2 || len(newKeys) != len(oldKeys) {
+		t.Fatalf("renditions %v -> %v", oldKeys, newKeys)
+	}
+	for name, key := range oldKeys {
+		if storedKeys(t, ts.storage, key)[key] {
+			t.Errorf("old %s %s still stored", name, key)
+		}
+		if newKey := newKeys[name]; !storedKeys(t, ts.storage, newKey)[newKey] || strings.EqualFold(newKey, key) {
+			t.Errorf("new %s %s missing", name, newKey)
+		}
+	}
+}
+
+func TestDeleteGalleryDeletesImages(t *testing.T) {
+	ts, token, category := newGalleryTestServer(t)
+
+	upload, err := SanitizeImage(bytes.NewReader(testPNG(t)), "forest.png", ts.imageLimits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	originalKey, renditionsJSON, err := SaveImageWithRenditions(context.Background(), ts.storage, ts.renditions, upload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gallery := models.Gallery{Title: "Forest", ImageURL: originalKey, Renditions: renditionsJSON, CategoryID: category.ID, UserID: category.UserID}
+	ts.db.Create(&gallery)
+
+	// A gallery from before renditions, only image_url is recorded
+	legacyKey := "uploads/2024/01/02/old.png"
+	ts.storage.Save(context.Background(), legacyKey, bytes.NewReader(upload.Data), int64(len(upload.Data)), "image/png")
+	legacy := models.Gallery{Title: "Sunset", ImageURL: "/" + legacyKey, CategoryID: category.ID, UserID: category.UserID}
+	ts.db.Create(&legacy)
+
+	for _, id := range []uint{gallery.ID, legacy.ID} {
+		if code, resp := ts.do(t, "DELETE", "/api/galleries/"+strconv.FormatUint(uint64(id), 10), token, nil); code != http.StatusOK {
+			t.Fatalf("delete = %d %v", code, resp)
+		}
+	}
+
+	var keys map[string]string
+	json.Unmarshal([]byte(renditionsJSON), &keys)
+	if len(keys) < 2 {
+		t.Fatalf("renditions %v", keys)
+	}
+	keys["legacy"] = legacyKey
+	for name, key := range keys {
+		if storedKeys(t, ts.storage, key)[key] {
+			t.Errorf("%s %s still stored", name, key)
+		}
+	}
+}
+
+func TestCategoryImageKeepsCategorySize(t *testing.T) {
+	ts, token, _ := newGalleryTestServer(t)
+
+	var img bytes.Buffer
+	png.Encode(&img, image.NewRGBA(image.Rect(0, 0, 200, 100)))
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("name", "Animals")
+	part, _ := form.CreateFormFile("image", "animals.png")
+	part.Write(img.Bytes())
+	form.Close()
+
+	req := httptest.NewRequest("POST", "/api/categories", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	ts.router.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create = %d %s", w.Code, w.Body.String())
+	}
+
+	var category models.Category
+	ts.db.Where("name = ?", "Animals").First(&category)
+	r, _, err := ts.storage.Open(context.Background(), category.ImageURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	stored, _, err := image.DecodeConfig(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Width != categoryImageSize || stored.Height != categoryImageSize/2 {
+		t.Fatalf("category image is %dx%d", stored.Width, stored.Height)
+	}
+}
@@ -0,0 +1,299 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/HugoSmits86/nativewebp"
+	"github.com/disintegration/imaging"
+	"github.com/gin-gonic/gin"
+	"mywall-api/internal/storage"
+)
+
+// maxTransformDimension bounds the requested width and height
+const maxTransformDimension = 4096
+
+// Requested sizes and qualities are rounded up to these steps, so the number
+// of distinct transformations of one image, and cache files, stays small
+const (
+	transformDimensionStep = 64
+	transformQualityStep   = 10
+)
+
+// transformQueryParams trigger an on the fly transformation when present
+var transformQueryParams = []string{"w", "h", "fit", "format", "q"}
+
+// transformFormats maps the format param to its encoder, content type and extension.
+// imaging has no WebP encoder, so webp is handled separately in encodeTransform.
+var transformFormats = map[string]struct {
+	format      imaging.Format
+	contentType string
+	ext         string
+}{
+	"jpeg": {imaging.JPEG, "image/jpeg", ".jpg"},
+	"jpg":  {imaging.JPEG, "image/jpeg", ".jpg"},
+	"png":  {imaging.PNG, "image/png", ".png"},
+	"gif":  {imaging.GIF, "image/gif", ".gif"},
+	"webp": {-1, "image/webp", ".webp"},
+}
+
+// ImageTransform holds the parsed w, h, fit, format and q params
+type ImageTransform struct {
+	Width   int
+	Height  int
+	Fit     string // contain, cover or fill
+	Format  string
+	Quality int
+}
+
+func transformRequested(c *gin.Context) bool {
+	for _, param := range transformQueryParams {
+		if c.Query(param) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// parseImageTransform validates the transform params. Without a format param the
+// negotiated format is used, then the format of sourceKey.
+func parseImageTransform(c *gin.Context, sourceKey, negotiated string) (*ImageTransform, error) {
+	t := &ImageTransform{
+		Fit:     strings.ToLower(c.DefaultQuery("fit", "contain")),
+		Format:  strings.ToLower(c.Query("format")),
+		Quality: 80,
+	}
+
+	var err error
+	if t.Width, err = parseDimension(c.Query("w")); err != nil {
+		return nil, fmt.Errorf("invalid w: %w", err)
+	}
+	if t.Height, err = parseDimension(c.Query("h")); err != nil {
+		return nil, fmt.Errorf("invalid h: %w", err)
+	}
+
+	switch t.Fit {
+	case "contain", "cover", "fill":
+	default:
+		return nil, errors.New("fit must be contain, cover or fill")
+	}
+	if (t.Fit == "cover" || t.Fit == "fill") && (t.Width == 0 || t.Height == 0) {
+		return nil, fmt.Errorf("fit=%s requires both w and h", t.Fit)
+	}
+
+	if t.Format == "" {
+		t.Format = negotiated
+	}
+	if t.Format == "" {
+		t.Format = strings.TrimPrefix(strings.ToLower(filepath.Ext(sourceKey)), ".")
+	}
+	if _, ok := transformFormats[t.Format]; !ok {
+		return nil, errors.New("unsupported format")
+	}
+	if t.Format == "jpg" {
+		t.Format = "jpeg"
+	}
+
+	if q := c.Query("q"); q != "" {
+		t.Quality, err = strconv.Atoi(q)
+		if err != nil || t.Quality < 1 || t.Quality > 100 {
+			return nil, errors.New("q must be between 1 and 100")
+		}
+	}
+	if t.Format == "jpeg" {
+		t.Quality = roundUp(t.Quality, transformQualityStep)
+	} else {
+		t.Quality = 0 // only JPEG is lossy
+	}
+	return t, nil
+}
+
+// roundUp rounds n up to a multiple of step
+func roundUp(n, step int) int {
+	return (n + step - 1) / step * step
+}
+
+func parseDimension(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 || n > maxTransformDimension {
+		return 0, fmt.Errorf("must be between 1 and %d", maxTransformDimension)
+	}
+	return roundUp(n, transformDimensionStep), nil
+}
+
+// cachePath derives the cache file of a transformation from the source key and params
+func (t *ImageTransform) cachePath(cacheDir, sourceKey string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|w=%d|h=%d|fit=%s|format=%s|q=%d",
+		sourceKey, t.Width, t.Height, t.Fit, t.Format, t.Quality)))
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(cacheDir, name[:2], name[2:4], name+transformFormats[t.Format].ext)
+}
+
+// apply resizes and crops the image according to the fit mode
+func (t *ImageTransform) apply(img image.Image) image.Image {
+	if t.Width == 0 && t.Height == 0 {
+		return img
+	}
+	switch t.Fit {
+	case "cover":
+		return imaging.Fill(img, t.Width, t.Height, imaging.Center, imaging.Lanczos)
+	case "fill":
+		return imaging.Resize(img, t.Width, t.Height, imaging.Lanczos)
+	}
+	if t.Width == 0 || t.Height == 0 {
+		// A single dimension keeps the aspect ratio, never upscale
+		bounds := img.Bounds()
+		if (t.Width == 0 || t.Width >= bounds.Dx()) && (t.Height == 0 || t.Height >= bounds.Dy()) {
+			return img
+		}
+		return imaging.Resize(img, t.Width, t.Height, imaging.Lanczos)
+	}
+	return imaging.Fit(img, t.Width, t.Height, imaging.Lanczos)
+}
+
+// serveTransformedImage serves the transformed image from the disk cache, rendering it on a miss
+func (s *Server) serveTransformedImage(c *gin.Context, sourceKey, negotiated string) {
+	t, err := parseImageTransform(c, sourceKey, negotiated)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	cachePath := t.cachePath(s.cfg.ImageCacheDir, sourceKey)
+	cached, err := os.Stat(cachePath)
+	if err != nil {
+		if err := s.renderTransform(c, t, sourceKey, cachePath); err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Image not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to transform image"})
+			return
+		}
+		c.Header("X-Cache", "MISS")
+		if cached, err = os.Stat(cachePath); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to transform image"})
+			return
+		}
+		s.transforms.added(cachePath, cached.Size())
+	} else {
+		c.Header("X-Cache", "HIT")
+		s.transforms.touch(cachePath)
+	}
+
+	c.Header("Cache-Control", "public, max-age=31536000") // Cache for 1 year
+	// The cache file name is a hash of source and params, so it doubles as the ETag
+	name := filepath.Base(cachePath)
+	if notModified(c, `"`+strings.TrimSuffix(name, filepath.Ext(name))+`"`, cached.ModTime()) {
+		return
+	}
+
+	c.Header("Content-Type", transformFormats[t.Format].contentType)
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.File(cachePath)
+}
+
+func (s *Server) renderTransform(c *gin.Context, t *ImageTransform, sourceKey, cachePath string) error {
+	reader, _, err := s.storage.Open(c.Request.Context(), sourceKey)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	img, err := imaging.Decode(reader, imaging.AutoOrientation(true))
+	if err != nil {
+		return fmt.Errorf("failed to decode image: %w", err)
+	}
+	img = t.apply(img)
+
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	// Concurrent misses each render to their own temp file, the last rename wins
+	tmp, err := os.CreateTemp(filepath.Dir(cachePath), ".transform-*")
+	if err != nil {
+		return fmt.Errorf("failed to create cache file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := encodeTransform(tmp, img, t); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to encode image: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), cachePath)
+}
+
+func encodeTransform(w io.Writer, img image.Image, t *ImageTransform) error {
+	if t.Format == "webp" {
+		// Lossless only, q does not apply
+		return nativewebp.Encode(w, img, nil)
+	}
+	return imaging.Encode(w, img, transformFormats[t.Format].format, imaging.JPEGQuality(t.Quality))
+}
+
+// negotiateImageFormat picks the format to serve sourceKey in from the Accept header,
+// "" keeps the stored format. Only lossless WebP can be encoded, which beats PNG but
+// not JPEG, so PNG is upgraded to WebP and WebP is downgraded to PNG for clients
+// that cannot display it.
+func negotiateImageFormat(accept, sourceKey string) string {
+	switch strings.ToLower(filepath.Ext(sourceKey)) {
+	case ".png":
+		if acceptsMediaType(accept, "image/webp", false) {
+			return "webp"
+		}
+	case ".webp":
+		if accept != "" && !acceptsMediaType(accept, "image/webp", true) {
+			return "png"
+		}
+	}
+	return ""
+}
+
+// acceptsMediaType reports whether the Accept header allows mediaType with a non zero
+// quality, wildcard ranges only count when allowWildcard is set. The most specific
+// matching range decides, so "image/webp;q=0, */*" rejects WebP.
+func acceptsMediaType(accept, mediaType string, allowWildcard bool) bool {
+	kind, _, _ := strings.Cut(mediaType, "/")
+	best, quality := -1, 0.0
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		candidate := strings.ToLower(strings.TrimSpace(params[0]))
+		specificity := -1
+		switch {
+		case candidate == mediaType:
+			specificity = 2
+		case allowWildcard && candidate == kind+"/*":
+			specificity = 1
+		case allowWildcard && candidate == "*/*":
+			specificity = 0
+		}
+		if specificity <= best {
+			continue
+		}
+		best, quality = specificity, 1
+		for _, param := range params[1:] {
+			name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.TrimSpace(name) == "q" {
+				if q, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+					quality = q
+				}
+			}
+		}
+	}
+	return quality > 0
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"testing"
+
+	"mywall-api/internal/models"
+)
+
+func TestAcceptsMediaType(t *testing.T) {
+	tests := []struct {
+		accept        string
+		allowWildcard bool
+		want          bool
+	}{
+		{"image/webp", false, true},
+		{"IMAGE/WEBP", false, true},
+		{"image/avif,image/webp,*/*;q=0.8", false, true},
+		{"image/webp;q=0.5", false, true},
+		{"image/webp;q=0", false, false},
+		{"image/webp; q=0.0", false, false},
+		{"image/webp;q=invalid", false, true},
+		{"image/png", false, false},
+		{"", false, false},
+		{"", true, false},
+
+		// Wildcards
+		{"*/*", false, false},
+		{"*/*", true, true},
+		{"image/*", true, true},
+		{"text/*", true, false},
+		{"image/*;q=0", true, false},
+
+		// The most specific range decides
+		{"image/webp;q=0, */*", true, false},
+		{"*/*, image/webp;q=0", true, false},
+		{"image/*;q=0, image/webp", true, true},
+		{"image/webp;q=0, image/*", true, false},
+		{"*/*;q=0, image/*", true, true},
+	}
+	for _, tt := range tests {
+		if got := acceptsMediaType(tt.accept, "image/webp", tt.allowWildcard); got != tt.want {
+			t.Errorf("acceptsMediaType(%q, wildcard %v) = %v, want %v", tt.accept, tt.allowWildcard, got, tt.want)
+		}
+	}
+}
+
+func TestNegotiateImageFormat(t *testing.T) {
+	const browser = "image/avif,image/webp,image/apng,image/*,*/*;q=0.8"
+	tests := []struct {
+		accept, source, want string
+	}{
+		// PNG is upgraded only when WebP is named explicitly
+		{browser, "a.png", "webp"},
+		{"image/webp", "a.PNG", "webp"},
+		{"image/webp;q=0, image/png", "a.png", ""},
+		{"image/*", "a.png", ""},
+		{"*/*", "a.png", ""},
+		{"", "a.png", ""},
+
+		// WebP is downgraded for clients that cannot display it
+		{browser, "a.webp", ""},
+		{"image/*", "a.webp", ""},
+		{"*/*", "a.webp", ""},
+		{"image/png,image/jpeg", "a.webp", "png"},
+		{"image/webp;q=0, */*", "a.webp", "png"},
+		{"", "a.webp", ""},
+
+		// JPEG and GIF are kept
+		{browser, "a.jpg", ""},
+		{"image/png", "a.jpg", ""},
+		{browser, "a.gif", ""},
+	}
+	for _, tt := range tests {
+		if got := negotiateImageFormat(tt.accept, tt.source); got != tt.want {
+			t.Errorf("negotiateImageFormat(%q, %s) = %q, want %q", tt.accept, tt.source, got, tt.want)
+		}
+	}
+}
+
+func TestServeImageVaryAccept(t *testing.T) {
+	ts, token, category := newGalleryTestServer(t)
+	ts.cfg.ImageCacheDir = t.TempDir()
+	key := "uploads/2026/01/02/photo.png"
+	data := encodePNG(t, testImage(8, 8))
+	ts.storage.Save(context.Background(), key, bytes.NewReader(data), int64(len(data)), "image/png")
+	ts.db.Create(&models.Gallery{Title: "Photo", ImageURL: key, CategoryID: category.ID, UserID: category.UserID})
+	path := "/api/images/2026/01/02/photo.png"
+
+	tests := []struct {
+		name        string
+		query       string
+		accept      string
+		contentType string
+		vary        string
+	}{
+		{"negotiated to WebP", "", "image/webp,*/*", "image/webp", "Accept"},
+		{"stored format", "", "image/png", "image/png", "Accept"},
+		{"no Accept header", "", "", "image/png", "Accept"},
+		{"explicit format", "?format=png", "image/webp", "image/png", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := imageRequest(t, ts, token, path+tt.query, map[string]string{"Accept": tt.accept})
+			if w.Code != http.StatusOK {
+				t.Fatalf("GET = %d %s", w.Code, w.Body.String())
+			}
+			if got := w.Header().Get("Content-Type"); got != tt.contentType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.contentType)
+			}
+			if got := w.Header().Get("Vary"); got != tt.vary {
+				t.Errorf("Vary = %q, want %q", got, tt.vary)
+			}
+
+			// A revalidation varies the same way
+			w = imageRequest(t, ts, token, path+tt.query, map[string]string{"Accept": tt.accept, "If-None-Match": w.Header().Get("ETag")})
+			if w.Code != http.StatusNotModified || w.Header().Get("Vary") != tt.vary {
+				t.Errorf("revalidation = %d, Vary %q", w.Code, w.Header().Get("Vary"))
+			}
+		})
+	}
+}
@@ -0,0 +1,463 @@
+package api
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/disintegration/imaging"
+	"github.com/gin-gonic/gin"
+	_ "golang.org/x/image/webp"
+	"mywall-api/internal/helpers"
+)
+
+// Upload validation errors, their messages are safe to return to clients
+var (
+	ErrUnsupportedImage = errors.New("unsupported image type, only JPEG, PNG, GIF and WebP are allowed")
+	ErrImageMismatch    = errors.New("file extension does not match image content")
+	ErrImageTooLarge    = errors.New("image dimensions too large")
+	ErrCorruptImage     = errors.New("image is corrupt or truncated")
+	ErrImageTrailing    = errors.New("image contains unexpected trailing data")
+)
+
+// ImageLimits bounds decoded image dimensions to reject decompression bombs
+type ImageLimits struct {
+	MaxPixels    int
+	MaxDimension int
+}
+
+// SanitizedImage is an upload whose bytes were verified and stripped of metadata
+type SanitizedImage struct {
+	Data        []byte
+	Format      string // jpeg, png, gif or webp
+	ContentType string
+	Ext         string
+	Width       int
+	Height      int
+}
+
+// sniffedImageTypes maps sniffed content types to the decoder format and allowed extensions
+var sniffedImageTypes = map[string]struct {
+	format string
+	exts   []string
+}{
+	"image/jpeg": {"jpeg", []string{".jpg", ".jpeg"}},
+	"image/png":  {"png", []string{".png"}},
+	"image/gif":  {"gif", []string{".gif"}},
+	"image/webp": {"webp", []string{".webp"}},
+}
+
+// SanitizeImage verifies the upload by its bytes rather than its name or headers,
+// rejects decompression bombs and polyglots, and strips EXIF and other metadata.
+func SanitizeImage(r io.Reader, filename string, limits ImageLimits) (*SanitizedImage, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read upload: %w", err)
+	}
+
+	contentType := http.DetectContentType(data)
+	sniffed, ok := sniffedImageTypes[contentType]
+	if !ok {
+		return nil, ErrUnsupportedImage
+	}
+	ext := strings.ToLower(filepath.Ext(filename))
+	if !containsString(sniffed.exts, ext) {
+		return nil, ErrImageMismatch
+	}
+
+	// Check dimensions before allocating any pixels
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || format != sniffed.format {
+		return nil, ErrCorruptImage
+	}
+	if config.Width <= 0 || config.Height <= 0 ||
+		config.Width > limits.MaxDimension || config.Height > limits.MaxDimension ||
+		config.Width*config.Height > limits.MaxPixels {
+		return nil, ErrImageTooLarge
+	}
+
+	var clean []byte
+	switch format {
+	case "jpeg":
+		clean, err = sanitizeJPEG(data)
+	case "png":
+		clean, err = sanitizePNG(data)
+	case "gif":
+		clean, err = sanitizeGIF(data, limits)
+	case "webp":
+		clean, err = sanitizeWebP(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// The stripped file must still decode completely
+	img, _, err := image.Decode(bytes.NewReader(clean))
+	if err != nil {
+		return nil, ErrCorruptImage
+	}
+
+	return &SanitizedImage{
+		Data:        clean,
+		Format:      format,
+		ContentType: contentType,
+		Ext:         ext,
+		Width:       img.Bounds().Dx(),
+		Height:      img.Bounds().Dy(),
+	}, nil
+}
+
+// jpegKeptSegments are the APPn markers needed to render correctly: JFIF, ICC profile and Adobe
+var jpegKeptSegments = map[byte]bool{
+	0xE0: true,
+	0xE2: true,
+	0xEE: true,
+}
+
+// sanitizeJPEG drops EXIF, XMP, IPTC and comment segments and rejects data after EOI.
+// Rotated photos are re-encoded upright since dropping EXIF loses their orientation.
+func sanitizeJPEG(data []byte) ([]byte, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, ErrCorruptImage
+	}
+
+	var out bytes.Buffer
+	out.Write(data[:2])
+	orientation := 1
+	pos := 2
+	for {
+		if pos+2 > len(data) || data[pos] != 0xFF {
+			return nil, ErrCorruptImage
+		}
+		marker := data[pos+1]
+		if marker == 0xFF {
+			// Fill byte
+			pos++
+			continue
+		}
+		if marker == 0xD9 {
+			out.Write(data[pos : pos+2])
+			pos += 2
+			break
+		}
+		if pos+4 > len(data) {
+			return nil, ErrCorruptImage
+		}
+
+		length := int(binary.BigEndian.Uint16(data[pos+2 : pos+4]))
+		end := pos + 2 + length
+		if length < 2 || end > len(data) {
+			return nil, ErrCorruptImage
+		}
+		segment := data[pos:end]
+
+		switch {
+		case marker == 0xE1:
+			if o := exifOrientation(data[pos+4 : end]); o != 0 {
+				orientation = o
+			}
+		case marker == 0xFE, marker >= 0xE0 && marker <= 0xEF && !jpegKeptSegments[marker]:
+			// Metadata, dropped
+		case marker == 0xDA:
+			// Start of scan, copy the entropy coded data up to the next marker
+			scanEnd := end
+			for scanEnd+1 < len(data) {
+				if data[scanEnd] == 0xFF && data[scanEnd+1] != 0x00 && (data[scanEnd+1] < 0xD0 || data[scanEnd+1] > 0xD7) {
+					break
+				}
+				scanEnd++
+			}
+			if scanEnd+1 >= len(data) {
+				return nil, ErrCorruptImage
+			}
+			out.Write(data[pos:scanEnd])
+			pos = scanEnd
+			continue
+		default:
+			out.Write(segment)
+		}
+		pos = end
+	}
+
+	if hasTrailingData(data[pos:]) {
+		return nil, ErrImageTrailing
+	}
+
+	if orientation > 1 {
+		img, err := imaging.Decode(bytes.NewReader(data), imaging.AutoOrientation(true))
+		if err != nil {
+			return nil, ErrCorruptImage
+		}
+		var buf bytes.Buffer
+		if err := imaging.Encode(&buf, img, imaging.JPEG, imaging.JPEGQuality(92)); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return out.Bytes(), nil
+}
+
+// exifOrientation reads the orientation tag from an APP1 Exif payload, 0 when absent
+func exifOrientation(payload []byte) int {
+	if len(payload) < 14 || string(payload[:6]) != "Exif\x00\x00" {
+		return 0
+	}
+	tiff := payload[6:]
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+	ifd := int(order.Uint32(tiff[4:8]))
+	if ifd+2 > len(tiff) {
+		return 0
+	}
+	entries := int(order.Uint16(tiff[ifd : ifd+2]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		if order.Uint16(tiff[entry:entry+2]) == 0x0112 {
+			o := int(order.Uint16(tiff[entry+8 : entry+10]))
+			if o >= 1 && o <= 8 {
+				return o
+			}
+			return 0
+		}
+	}
+	return 0
+}
+
+// pngDroppedChunks carry text, EXIF or timestamps
+var pngDroppedChunks = map[string]bool{
+	"tEXt": true,
+	"zTXt": true,
+	"iTXt": true,
+	"eXIf": true,
+	"tIME": true,
+}
+
+// sanitizePNG drops metadata chunks and rejects data after IEND
+func sanitizePNG(data []byte) ([]byte, error) {
+	const signature = "\x89PNG\r\n\x1a\n"
+	if len(data) < len(signature) || string(data[:len(signature)]) != signature {
+		return nil, ErrCorruptImage
+	}
+
+	var out bytes.Buffer
+	out.WriteString(signature)
+	pos := len(signature)
+	for {
+		if pos+12 > len(data) {
+			return nil, ErrCorruptImage
+		}
+		length := int(binary.BigEndian.Uint32(data[pos : pos+4]))
+		chunkType := string(data[pos+4 : pos+8])
+		end := pos + 12 + length
+		if length < 0 || end > len(data) {
+			return nil, ErrCorruptImage
+		}
+		if !pngDroppedChunks[chunkType] {
+			out.Write(data[pos:end])
+		}
+		pos = end
+		if chunkType == "IEND" {
+			break
+		}
+	}
+
+	if hasTrailingData(data[pos:]) {
+		return nil, ErrImageTrailing
+	}
+	return out.Bytes(), nil
+}
+
+// maxGIFFrames bounds the frames of an animation, each one is decoded separately
+const maxGIFFrames = 1000
+
+// sanitizeGIF re-encodes every frame, which drops comment and application extensions.
+// The frames are counted first, decoding allocates every one of them at once.
+func sanitizeGIF(data []byte, limits ImageLimits) ([]byte, error) {
+	if err := checkGIFFrames(data, limits); err != nil {
+		return nil, err
+	}
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrCorruptImage
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// checkGIFFrames walks the GIF blocks without decoding any pixels and rejects
+// animations with too many frames or more pixels in total than limits allow,
+// and data after the trailer
+func checkGIFFrames(data []byte, limits ImageLimits) error {
+	if len(data) < 13 {
+		return ErrCorruptImage
+	}
+	pos := 13
+	if flags := data[10]; flags&0x80 != 0 {
+		pos += 3 << (flags&0x07 + 1) // global color table
+	}
+
+	frames, pixels := 0, 0
+	for pos < len(data) {
+		var err error
+		switch data[pos] {
+		case 0x21:
+			// Extension: label, then data sub-blocks
+			pos, err = skipGIFSubBlocks(data, pos+2)
+		case 0x2C:
+			// Image descriptor, then LZW code size and image data sub-blocks
+			if pos+10 > len(data) {
+				return ErrCorruptImage
+			}
+			width := int(binary.LittleEndian.Uint16(data[pos+5 : pos+7]))
+			height := int(binary.LittleEndian.Uint16(data[pos+7 : pos+9]))
+			flags := data[pos+9]
+			pos += 10
+			if flags&0x80 != 0 {
+				pos += 3 << (flags&0x07 + 1) // local color table
+			}
+			frames++
+			pixels += width * height
+			if frames > maxGIFFrames || pixels > limits.MaxPixels {
+				return ErrImageTooLarge
+			}
+			pos, err = skipGIFSubBlocks(data, pos+1)
+		case 0x3B:
+			if hasTrailingData(data[pos+1:]) {
+				return ErrImageTrailing
+			}
+			return nil
+		default:
+			return ErrCorruptImage
+		}
+		if err != nil {
+			return err
+		}
+	}
+	// A missing trailer is left for the decoder to judge
+	return nil
+}
+
+// skipGIFSubBlocks returns the position after the sub-blocks starting at pos
+func skipGIFSubBlocks(data []byte, pos int) (int, error) {
+	for pos < len(data) {
+		size := int(data[pos])
+		pos += 1 + size
+		if size == 0 {
+			return pos, nil
+		}
+	}
+	return 0, ErrCorruptImage
+}
+
+// webpKeptChunks are the RIFF chunks needed to render the image, EXIF, XMP and
+// unknown chunks are dropped
+var webpKeptChunks = map[string]bool{
+	"VP8 ": true,
+	"VP8L": true,
+	"VP8X": true,
+	"ALPH": true,
+	"ANIM": true,
+	"ANMF": true,
+	"ICCP": true,
+}
+
+// VP8X flags announcing EXIF and XMP chunks
+const webpMetadataFlags = 0x08 | 0x04
+
+// sanitizeWebP drops metadata chunks and rejects data after the RIFF container.
+// The bitstream is copied as is, so lossy images are not re-encoded.
+func sanitizeWebP(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, ErrCorruptImage
+	}
+	riffEnd := 8 + int(binary.LittleEndian.Uint32(data[4:8]))
+	if riffEnd > len(data) || riffEnd < 12 {
+		return nil, ErrCorruptImage
+	}
+
+	var out bytes.Buffer
+	out.Write(data[:12])
+	pos := 12
+	for pos < riffEnd {
+		if pos+8 > riffEnd {
+			return nil, ErrCorruptImage
+		}
+		chunkType := string(data[pos : pos+4])
+		length := int(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+		end := pos + 8 + length + length%2 // chunks are padded to an even size
+		if length < 0 || end > riffEnd {
+			return nil, ErrCorruptImage
+		}
+		if webpKeptChunks[chunkType] {
+			start := out.Len()
+			out.Write(data[pos:end])
+			if chunkType == "VP8X" && length > 0 {
+				out.Bytes()[start+8] &^= webpMetadataFlags
+			}
+		}
+		pos = end
+	}
+
+	if hasTrailingData(data[riffEnd:]) {
+		return nil, ErrImageTrailing
+	}
+	clean := out.Bytes()
+	binary.LittleEndian.PutUint32(clean[4:8], uint32(len(clean)-8))
+	return clean, nil
+}
+
+// hasTrailingData reports bytes other than padding after the end of the image
+func hasTrailingData(rest []byte) bool {
+	for _, b := range rest {
+		if b != 0x00 && b != '\n' && b != '\r' {
+			return true
+		}
+	}
+	return false
+}
+
+// sanitizeUpload runs SanitizeImage on a form upload and writes the error response on failure
+func (s *Server) sanitizeUpload(c *gin.Context, file multipart.File, header *multipart.FileHeader) (*SanitizedImage, bool) {
+	upload, err := SanitizeImage(file, header.Filename, s.imageLimits)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrUnsupportedImage), errors.Is(err, ErrImageMismatch),
+			errors.Is(err, ErrImageTooLarge), errors.Is(err, ErrCorruptImage), errors.Is(err, ErrImageTrailing):
+			helpers.BadRequest(c, "Invalid image: "+err.Error())
+		default:
+			helpers.InternalServerError(c, "Failed to read image file")
+		}
+		return nil, false
+	}
+	return upload, true
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,369 @@
+package api
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/HugoSmits86/nativewebp"
+)
+
+var testLimits = ImageLimits{MaxPixels: 1 << 20, MaxDimension: 1000}
+
+// testImage is a width x height image, red on the left half and blue on the right
+func testImage(width, height int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := color.RGBA{R: 255, A: 255}
+			if x >= width/2 {
+				c = color.RGBA{B: 255, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func encodeJPEG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// jpegSegment builds a marker segment with its length
+func jpegSegment(marker byte, payload []byte) []byte {
+	segment := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+// exifPayload is an APP1 Exif payload with only the orientation tag
+func exifPayload(orientation uint16) []byte {
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08\x00\x01")
+	entry := make([]byte, 12)
+	binary.BigEndian.PutUint16(entry[0:], 0x0112)
+	binary.BigEndian.PutUint16(entry[2:], 3)
+	binary.BigEndian.PutUint32(entry[4:], 1)
+	binary.BigEndian.PutUint16(entry[8:], orientation)
+	tiff = append(append(tiff, entry...), 0, 0, 0, 0)
+	return append([]byte("Exif\x00\x00"), tiff...)
+}
+
+// withJPEGSegments inserts segments right after SOI
+func withJPEGSegments(data []byte, segments ...[]byte) []byte {
+	out := append([]byte{}, data[:2]...)
+	for _, segment := range segments {
+		out = append(out, segment...)
+	}
+	return append(out, data[2:]...)
+}
+
+// jpegMarkers lists the markers of the segments before the first scan
+func jpegMarkers(data []byte) []byte {
+	var markers []byte
+	for pos := 2; pos+4 <= len(data) && data[pos] == 0xFF; {
+		markers = append(markers, data[pos+1])
+		if data[pos+1] == 0xDA {
+			break
+		}
+		pos += 2 + int(binary.BigEndian.Uint16(data[pos+2:pos+4]))
+	}
+	return markers
+}
+
+// pngChunk builds a chunk with its CRC
+func pngChunk(chunkType string, payload []byte) []byte {
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(payload)))
+	chunk = append(chunk, chunkType...)
+	chunk = append(chunk, payload...)
+	return binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+}
+
+// pngChunkTypes lists the chunk types of a PNG
+func pngChunkTypes(data []byte) []string {
+	var types []string
+	for pos := 8; pos+12 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[pos : pos+4]))
+		types = append(types, string(data[pos+4:pos+8]))
+		pos += 12 + length
+	}
+	return types
+}
+
+// webpChunk builds a RIFF chunk padded to an even size
+func webpChunk(chunkType string, payload []byte) []byte {
+	chunk := append([]byte(chunkType), binary.LittleEndian.AppendUint32(nil, uint32(len(payload)))...)
+	chunk = append(chunk, payload...)
+	if len(payload)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	return chunk
+}
+
+// webpContainer wraps chunks in a RIFF WEBP header
+func webpContainer(chunks ...[]byte) []byte {
+	body := []byte("WEBP")
+	for _, chunk := range chunks {
+		body = append(body, chunk...)
+	}
+	return append(append([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, uint32(len(body)))...), body...)
+}
+
+// webpChunks maps the chunk types of a WebP to their payloads
+func webpChunks(data []byte) map[string][]byte {
+	chunks := map[string][]byte{}
+	for pos := 12; pos+8 <= len(data); {
+		length := int(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+		chunks[string(data[pos:pos+4])] = data[pos+8 : pos+8+length]
+		pos += 8 + length + length%2
+	}
+	return chunks
+}
+
+// animatedGIF encodes frames of size x size pixels
+func animatedGIF(t *testing.T, size, frames int) []byte {
+	t.Helper()
+	g := &gif.GIF{}
+	for i := 0; i < frames; i++ {
+		frame := image.NewPaletted(image.Rect(0, 0, size, size), palette.Plan9)
+		frame.SetColorIndex(i%size, 0, uint8(i))
+		g.Image = append(g.Image, frame)
+		g.Delay = append(g.Delay, 10)
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestSanitizeImageGIFFrameLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		limits  ImageLimits
+		wantErr error
+	}{
+		{"within limits", animatedGIF(t, 10, 5), ImageLimits{MaxPixels: 500, MaxDimension: 100}, nil},
+		{"total pixels over limit", animatedGIF(t, 10, 6), ImageLimits{MaxPixels: 500, MaxDimension: 100}, ErrImageTooLarge},
+		{"too many frames", animatedGIF(t, 1, maxGIFFrames+1), ImageLimits{MaxPixels: 1 << 20, MaxDimension: 100}, ErrImageTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, err := SanitizeImage(bytes.NewReader(tt.data), "anim.gif", tt.limits)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("SanitizeImage = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil {
+				g, err := gif.DecodeAll(bytes.NewReader(img.Data))
+				if err != nil || len(g.Image) != 5 {
+					t.Fatalf("sanitized GIF has %d frames, %v", len(g.Image), err)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckGIFFramesTruncated(t *testing.T) {
+	data := animatedGIF(t, 10, 2)
+	limits := ImageLimits{MaxPixels: 1000, MaxDimension: 100}
+	if err := checkGIFFrames(data, limits); err != nil {
+		t.Fatalf("complete GIF: %v", err)
+	}
+	for _, cut := range []int{5, 20, len(data) / 2} {
+		if err := checkGIFFrames(data[:cut], limits); !errors.Is(err, ErrCorruptImage) {
+			t.Errorf("GIF cut at %d = %v, want ErrCorruptImage", cut, err)
+		}
+	}
+}
+
+func TestSanitizeJPEGStripsMetadata(t *testing.T) {
+	data := withJPEGSegments(encodeJPEG(t, testImage(20, 10)),
+		jpegSegment(0xE1, exifPayload(1)),
+		jpegSegment(0xE1, []byte("http://ns.adobe.com/xap/1.0/\x00<x:xmpmeta/>")),
+		jpegSegment(0xED, []byte("Photoshop 3.0\x00")),
+		jpegSegment(0xFE, []byte("secret comment")),
+		jpegSegment(0xE2, []byte("ICC_PROFILE\x00")),
+	)
+
+	img, err := SanitizeImage(bytes.NewReader(data), "photo.JPG", testLimits)
+	if err != nil {
+		t.Fatalf("SanitizeImage: %v", err)
+	}
+	for _, marker := range jpegMarkers(img.Data) {
+		if marker == 0xE1 || marker == 0xED || marker == 0xFE {
+			t.Errorf("marker %X kept", marker)
+		}
+	}
+	if !bytes.Contains(img.Data, []byte("ICC_PROFILE")) {
+		t.Error("ICC profile dropped")
+	}
+	if img.Format != "jpeg" || img.ContentType != "image/jpeg" || img.Ext != ".jpg" || img.Width != 20 || img.Height != 10 {
+		t.Fatalf("sanitized = %s %s %s %dx%d", img.Format, img.ContentType, img.Ext, img.Width, img.Height)
+	}
+}
+
+func TestSanitizeJPEGAppliesOrientation(t *testing.T) {
+	// Orientation 6 is displayed rotated 90 degrees clockwise
+	data := withJPEGSegments(encodeJPEG(t, testImage(20, 10)), jpegSegment(0xE1, exifPayload(6)))
+
+	img, err := SanitizeImage(bytes.NewReader(data), "photo.jpeg", testLimits)
+	if err != nil {
+		t.Fatalf("SanitizeImage: %v", err)
+	}
+	if bytes.Contains(img.Data, []byte("Exif")) {
+		t.Fatal("EXIF kept")
+	}
+	decoded, err := jpeg.Decode(bytes.NewReader(img.Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := decoded.Bounds(); b.Dx() != 10 || b.Dy() != 20 {
+		t.Fatalf("oriented image is %dx%d, want 10x20", b.Dx(), b.Dy())
+	}
+	// The red left half is now on top
+	if r, _, b, _ := decoded.At(5, 2).RGBA(); r < b {
+		t.Fatal("image rotated the wrong way")
+	}
+}
+
+func TestSanitizePNGStripsAncillaryChunks(t *testing.T) {
+	data := encodePNG(t, testImage(8, 8))
+	ihdrEnd := 8 + 25
+	var withChunks []byte
+	withChunks = append(withChunks, data[:ihdrEnd]...)
+	withChunks = append(withChunks, pngChunk("tEXt", []byte("Author\x00someone"))...)
+	withChunks = append(withChunks, pngChunk("iTXt", []byte("XML:com.adobe.xmp\x00\x00\x00\x00\x00<x/>"))...)
+	withChunks = append(withChunks, pngChunk("eXIf", exifPayload(1)[6:])...)
+	withChunks = append(withChunks, pngChunk("tIME", []byte{0x07, 0xE8, 1, 2, 3, 4, 5})...)
+	withChunks = append(withChunks, pngChunk("gAMA", []byte{0, 0, 0xB1, 0x8F})...)
+	withChunks = append(withChunks, data[ihdrEnd:]...)
+
+	img, err := SanitizeImage(bytes.NewReader(withChunks), "pic.png", testLimits)
+	if err != nil {
+		t.Fatalf("SanitizeImage: %v", err)
+	}
+	got := pngChunkTypes(img.Data)
+	for _, chunkType := range got {
+		if pngDroppedChunks[chunkType] {
+			t.Errorf("chunk %s kept", chunkType)
+		}
+	}
+	if len(got) != 4 || got[1] != "gAMA" {
+		t.Fatalf("chunks = %v, want IHDR gAMA IDAT IEND", got)
+	}
+	if _, err := png.Decode(bytes.NewReader(img.Data)); err != nil {
+		t.Fatalf("sanitized PNG does not decode: %v", err)
+	}
+}
+
+func TestSanitizeWebPStripsMetadataWithoutReencoding(t *testing.T) {
+	var simple bytes.Buffer
+	if err := nativewebp.Encode(&simple, testImage(8, 4), nil); err != nil {
+		t.Fatal(err)
+	}
+	bitstream := webpChunks(simple.Bytes())["VP8L"]
+	if bitstream == nil {
+		t.Fatal("encoder did not write a VP8L chunk")
+	}
+
+	// Extended format: VP8X announces EXIF and XMP, canvas 8x4
+	vp8x := []byte{webpMetadataFlags, 0, 0, 0, 7, 0, 0, 3, 0, 0}
+	data := webpContainer(
+		webpChunk("VP8X", vp8x),
+		webpChunk("VP8L", bitstream),
+		webpChunk("EXIF", exifPayload(1)[6:]),
+		webpChunk("XMP ", []byte("<x:xmpmeta/>")),
+		webpChunk("ZZZZ", []byte("odd")),
+	)
+
+	img, err := SanitizeImage(bytes.NewReader(data), "pic.webp", testLimits)
+	if err != nil {
+		t.Fatalf("SanitizeImage: %v", err)
+	}
+	chunks := webpChunks(img.Data)
+	if len(chunks) != 2 || chunks["VP8X"] == nil {
+		t.Fatalf("chunks kept = %d, want VP8X and VP8L", len(chunks))
+	}
+	if !bytes.Equal(chunks["VP8L"], bitstream) {
+		t.Fatal("bitstream was re-encoded")
+	}
+	if chunks["VP8X"][0]&webpMetadataFlags != 0 {
+		t.Fatalf("VP8X flags %08b still announce metadata", chunks["VP8X"][0])
+	}
+	if size := binary.LittleEndian.Uint32(img.Data[4:8]); int(size) != len(img.Data)-8 {
+		t.Fatalf("RIFF size %d for %d bytes", size, len(img.Data))
+	}
+	if img.Width != 8 || img.Height != 4 {
+		t.Fatalf("sanitized WebP is %dx%d", img.Width, img.Height)
+	}
+}
+
+func TestSanitizeImageRejectsTrailingData(t *testing.T) {
+	jpegData := encodeJPEG(t, testImage(8, 8))
+	pngData := encodePNG(t, testImage(8, 8))
+	var webpData bytes.Buffer
+	nativewebp.Encode(&webpData, testImage(8, 8), nil)
+	zip := []byte("PK\x03\x04\x14\x00\x00\x00payload.php")
+
+	tests := []struct {
+		name     string
+		filename string
+		data     []byte
+		wantErr  error
+	}{
+		{"JPEG with a zip appended", "a.jpg", append(append([]byte{}, jpegData...), zip...), ErrImageTrailing},
+		{"PNG with a script appended", "a.png", append(append([]byte{}, pngData...), "<?php system($_GET[1]); ?>"...), ErrImageTrailing},
+		{"WebP with a zip appended", "a.webp", append(append([]byte{}, webpData.Bytes()...), zip...), ErrImageTrailing},
+		{"GIF with HTML appended", "a.gif", append(animatedGIF(t, 4, 1), "<script>alert(1)</script>"...), ErrImageTrailing},
+		{"JPEG padded with newlines", "a.jpg", append(append([]byte{}, jpegData...), "\r\n\x00"...), nil},
+		{"HTML named as an image", "a.png", []byte("<html><script>alert(1)</script></html>"), ErrUnsupportedImage},
+		{"JPEG with a truncated segment", "a.jpg", jpegData[:30], ErrCorruptImage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := SanitizeImage(bytes.NewReader(tt.data), tt.filename, testLimits)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("SanitizeImage = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSanitizeImageExtensionMismatch(t *testing.T) {
+	tests := []struct {
+		filename string
+		data     []byte
+	}{
+		{"photo.jpg", encodePNG(t, testImage(4, 4))},
+		{"photo.png", encodeJPEG(t, testImage(4, 4))},
+		{"anim.webp", animatedGIF(t, 4, 1)},
+		{"photo", encodePNG(t, testImage(4, 4))},
+	}
+	for _, tt := range tests {
+		if _, err := SanitizeImage(bytes.NewReader(tt.data), tt.filename, testLimits); !errors.Is(err, ErrImageMismatch) {
+			t.Errorf("SanitizeImage(%s) = %v, want ErrImageMismatch", tt.filename, err)
+		}
+	}
+}
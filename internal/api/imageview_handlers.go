@@ -80,7 +80,7 @@ func (s *Server) updateImageView(ctx *gin.Context) {
 	}()
 
 	var imageView models.ImageView
-	if result := s.db.Where("user_id = ? AND gallery_id = ?", userID, req.GalleryID).First(&imageView); result.Error != nil {
+	if result := tx.Where("user_id = ? AND gallery_id = ?", userID, req.GalleryID).First(&imageView); result.Error != nil {
 		tx.Rollback()
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			helpers.NotFound(ctx, "Image view not found")
@@ -90,7 +90,7 @@ func (s *Server) updateImageView(ctx *gin.Context) {
 		return
 	}
 	imageView.Count = imageView.Count + req.Count
-	if result := s.db.Save(&imageView); result.Error != nil {
+	if result := tx.Save(&imageView); result.Error != nil {
 		tx.Rollback()
 		helpers.InternalServerError(ctx, "Failed to update image view")
 		return
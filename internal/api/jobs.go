@@ -0,0 +1,28 @@
+package api
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// RunJob calls job every interval until ctx is done. Jobs claim their rows, so
+// every instance can run them.
+func (s *Server) RunJob(ctx context.Context, name string, interval time.Duration, job func(now time.Time) error) {
+	if interval <= 0 {
+		log.Printf("⏸️  Background job %s disabled", name)
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := job(now); err != nil {
+				log.Printf("⚠️  Background job %s failed: %v", name, err)
+			}
+		}
+	}
+}
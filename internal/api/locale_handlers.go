@@ -0,0 +1,46 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"mywall-api/internal/helpers"
+	"mywall-api/internal/models"
+	"mywall-api/internal/notify"
+)
+
+// getLocale returns the caller's notification language and the supported ones
+func (s *Server) getLocale(c *gin.Context) {
+	var user models.User
+	if err := s.db.Select("id", "locale").First(&user, c.GetUint("user_id")).Error; err != nil {
+		helpers.NotFound(c, "User not found")
+		return
+	}
+	helpers.Success(c, "Locale retrieved successfully", gin.H{
+		"locale":    user.Locale,
+		"supported": s.templates.Locales(),
+	})
+}
+
+// updateLocale sets the language notifications are rendered in
+func (s *Server) updateLocale(c *gin.Context) {
+	var req struct {
+		Locale string `json:"locale" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		helpers.BadRequest(c, "Invalid request data")
+		return
+	}
+	if !s.templates.Supports(req.Locale) {
+		helpers.ValidationError(c, "Validation failed", map[string]interface{}{
+			"locale":    "Unsupported locale",
+			"supported": s.templates.Locales(),
+		})
+		return
+	}
+
+	locale := notify.NormalizeLocale(req.Locale)
+	if err := s.db.Model(&models.User{}).Where("id = ?", c.GetUint("user_id")).Update("locale", locale).Error; err != nil {
+		helpers.InternalServerError(c, "Failed to update locale")
+		return
+	}
+	helpers.Success(c, "Locale updated successfully", gin.H{"locale": locale})
+}
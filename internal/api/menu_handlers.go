@@ -101,6 +101,8 @@ func (s *Server) updateMenu(c *gin.Context) {
 		ID:       	input.ID,
 		Path: 		input.Path,
 	})
+	// Permissions are cached by menu path
+	s.perms.InvalidateAll()
 	helpers.Success(c, "Menu updated successfully", menu)
 }
 
@@ -113,5 +115,6 @@ func (s *Server) deleteMenu(c *gin.Context) {
 		return
 	}
 	s.db.Delete(&menu)
+	s.perms.InvalidateAll()
 	helpers.Success(c, "Menu deleted", menu)	
 }
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"mywall-api/internal/models"
+	"mywall-api/internal/notify"
+)
+
+// ParseCoalesceWindows parses a spec like "gallery.created:300,comment.created:60"
+// into a window per notification type, invalid entries are skipped
+func ParseCoalesceWindows(spec string) map[string]time.Duration {
+	windows := make(map[string]time.Duration)
+	for _, part := range strings.Split(spec, ",") {
+		notifType, secs, ok := strings.Cut(strings.TrimSpace(part), ":")
+		if !ok {
+			continue
+		}
+		seconds, err := strconv.Atoi(strings.TrimSpace(secs))
+		notifType = strings.TrimSpace(notifType)
+		if err != nil || seconds <= 0 || notifType == "" {
+			continue
+		}
+		windows[notifType] = time.Duration(seconds) * time.Second
+	}
+	return windows
+}
+
+// coalesceStripes is the number of locks coalescing is serialized on
+const coalesceStripes = 64
+
+// coalesceLocks serializes notifications of one user and type, so concurrent
+// uploads find each other's notification instead of each creating one. The
+// set is fixed, pairs that share a stripe only wait on each other briefly.
+var coalesceLocks [coalesceStripes]sync.Mutex
+
+func coalesceLock(userID uint, notifType string) *sync.Mutex {
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%d:%s", userID, notifType)
+	return &coalesceLocks[h.Sum32()%coalesceStripes]
+}
+
+// coalesceInto folds an event into the user's latest notification of the same
+// type created within the window that is neither read nor part of a sent
+// digest. It reports false when there is none. Archived notifications count
+// too, those of users without in-app delivery are archived from the start.
+// Only the stored notification is updated, other channels were already
+// notified by the first event.
+func (h *NotificationHandlers) coalesceInto(userID uint, eventType string, metadata map[string]interface{}, window time.Duration) (bool, error) {
+	pref, err := h.notifier.Preference(userID, eventType)
+	if err != nil || pref.Muted {
+		return false, err
+	}
+
+	now := time.Now()
+	query := h.db.Where("user_id = ? AND type = ? AND is_read = 0 AND created_at >= ?",
+		userID, eventType, now.Add(-window)).
+		Where("(expires_at IS NULL OR expires_at > ?)", now)
+
+	// A digest summarized what came before it, those notifications stay as sent
+	var digests []models.NotificationDigest
+	if err := h.db.Where("user_id = ? AND last_sent_at IS NOT NULL", userID).Limit(1).Find(&digests).Error; err != nil {
+		return false, err
+	}
+	if len(digests) > 0 {
+		query = query.Where("created_at > ?", *digests[0].LastSentAt)
+	}
+
+	var n models.Notification
+	err = query.Order("created_at DESC").First(&n).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	count := n.Count
+	if count < 1 {
+		count = 1
+	}
+	count++
+
+	data := make(map[string]interface{}, len(metadata)+1)
+	for k, v := range metadata {
+		data[k] = v
+	}
+	data["count"] = count
+
+	templateType := eventType + notify.BatchSuffix
+	if !h.templates.Has(templateType) {
+		templateType = eventType
+	}
+	title, body, err := h.render(userID, templateType, data)
+	if err != nil {
+		return false, err
+	}
+	metadataJSON, err := json.Marshal(data)
+	if err != nil {
+		return false, err
+	}
+
+	err = h.db.Model(&models.Notification{}).Where("id = ?", n.ID).Updates(map[string]interface{}{
+		"title":    title,
+		"body":     body,
+		"metadata": string(metadataJSON),
+		"count":    count,
+	}).Error
+	if err != nil {
+		return false, err
+	}
+
+	if !pref.InApp {
+		return true, nil
+	}
+	h.ws.BroadcastNotification(userID, map[string]interface{}{
+		"id":        n.ID,
+		"user_id":   userID,
+		"title":     title,
+		"body":      body,
+		"type":      eventType,
+		"metadata":  string(metadataJSON),
+		"is_read":   0,
+		"count":     count,
+		"coalesced": true,
+	})
+	return true, nil
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"mywall-api/internal/models"
+	"mywall-api/internal/notify"
+)
+
+func TestParseCoalesceWindows(t *testing.T) {
+	got := ParseCoalesceWindows(" gallery.created:300, bad, comment.created:x, zero:0 ,:5,comment.created:60")
+	want := map[string]time.Duration{"gallery.created": 5 * time.Minute, "comment.created": time.Minute}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+// notifyGalleries sends count gallery.created events to the user, concurrently
+func notifyGalleries(t *testing.T, ts *testServer, userID uint, count int) {
+	t.Helper()
+	ts.coalesceWindows = map[string]time.Duration{notify.EventGalleryCreated: time.Minute}
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := ts.notifications().Notify(userID, notify.EventGalleryCreated, map[string]interface{}{"title": "sunset"}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func storedNotifications(t *testing.T, ts *testServer, userID uint) []models.Notification {
+	t.Helper()
+	var notifications []models.Notification
+	if err := ts.db.Where("user_id = ?", userID).Find(&notifications).Error; err != nil {
+		t.Fatal(err)
+	}
+	return notifications
+}
+
+func TestCoalesceInApp(t *testing.T) {
+	ts := newTestServer(t)
+	userID, _ := ts.login(t, "user@example.com", false)
+
+	notifyGalleries(t, ts, userID, 4)
+
+	stored := storedNotifications(t, ts, userID)
+	if len(stored) != 1 || stored[0].Count != 4 {
+		t.Fatalf("stored %d notifications, first %+v", len(stored), stored)
+	}
+}
+
+func TestCoalesceWithoutInApp(t *testing.T) {
+	ts := newTestServer(t)
+	userID, _ := ts.login(t, "user@example.com", false)
+	// Email-only users get their notifications archived on creation
+	ts.db.Create(&models.NotificationPreference{UserID: userID, Type: notify.EventGalleryCreated, Email: true})
+
+	notifyGalleries(t, ts, userID, 3)
+
+	stored := storedNotifications(t, ts, userID)
+	if len(stored) != 1 || stored[0].Count != 3 || stored[0].ArchivedAt == nil {
+		t.Fatalf("stored %d notifications, first %+v", len(stored), stored)
+	}
+}
+
+func TestCoalesceSkipsReadAndDigested(t *testing.T) {
+	ts := newTestServer(t)
+	userID, _ := ts.login(t, "user@example.com", false)
+
+	notifyGalleries(t, ts, userID, 1)
+	ts.db.Model(&models.Notification{}).Where("user_id = ?", userID).Update("is_read", 1)
+	notifyGalleries(t, ts, userID, 1)
+
+	// The digest went out after both, the next event starts a new notification
+	sentAt := time.Now()
+	ts.db.Create(&models.NotificationDigest{UserID: userID, Frequency: models.DigestDaily, NextRunAt: sentAt.Add(time.Hour), LastSentAt: &sentAt})
+	time.Sleep(10 * time.Millisecond)
+	notifyGalleries(t, ts, userID, 2)
+
+	stored := storedNotifications(t, ts, userID)
+	if len(stored) != 3 {
+		t.Fatalf("stored %d notifications, want 3", len(stored))
+	}
+	counts := map[int]int{}
+	for _, n := range stored {
+		counts[n.Count]++
+	}
+	if counts[1] != 2 || counts[2] != 1 {
+		t.Fatalf("counts = %v, want two single and one pair", counts)
+	}
+}
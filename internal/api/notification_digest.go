@@ -0,0 +1,171 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"mywall-api/internal/helpers"
+	"mywall-api/internal/models"
+	"mywall-api/internal/notify"
+)
+
+// digestItemLimit caps the notification titles listed in one digest
+const digestItemLimit = 10
+
+// digestEventTypes maps a digest frequency to its notification type
+var digestEventTypes = map[string]string{
+	models.DigestDaily:  notify.EventDigestDaily,
+	models.DigestWeekly: notify.EventDigestWeekly,
+}
+
+// nextDigestRun returns the first digest time after t, at hour o'clock every
+// day or every Monday
+func nextDigestRun(frequency string, t time.Time, hour int) time.Time {
+	next := time.Date(t.Year(), t.Month(), t.Day(), hour, 0, 0, 0, t.Location())
+	if frequency == models.DigestWeekly {
+		daysToMonday := (int(time.Monday) - int(next.Weekday()) + 7) % 7
+		next = next.AddDate(0, 0, daysToMonday)
+		if !next.After(t) {
+			next = next.AddDate(0, 0, 7)
+		}
+		return next
+	}
+	if !next.After(t) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// getNotificationDigest returns the caller's digest subscription
+func (s *Server) getNotificationDigest(c *gin.Context) {
+	var digest models.NotificationDigest
+	err := s.db.Where("user_id = ?", c.GetUint("user_id")).First(&digest).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		helpers.Success(c, "Digest retrieved successfully", gin.H{"frequency": "off"})
+		return
+	}
+	if err != nil {
+		helpers.InternalServerError(c, "Failed to retrieve digest")
+		return
+	}
+	helpers.Success(c, "Digest retrieved successfully", digest)
+}
+
+// updateNotificationDigest subscribes the caller to daily or weekly digests, or
+// unsubscribes them with "off"
+func (s *Server) updateNotificationDigest(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	var req struct {
+		Frequency string `json:"frequency" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		helpers.BadRequest(c, "Invalid request data")
+		return
+	}
+
+	if req.Frequency == "off" {
+		if err := s.db.Unscoped().Where("user_id = ?", userID).Delete(&models.NotificationDigest{}).Error; err != nil {
+			helpers.InternalServerError(c, "Failed to update digest")
+			return
+		}
+		helpers.Success(c, "Digest disabled successfully", gin.H{"frequency": "off"})
+		return
+	}
+	if _, ok := digestEventTypes[req.Frequency]; !ok {
+		helpers.ValidationError(c, "Validation failed", map[string]string{
+			"frequency": "Frequency must be daily, weekly or off",
+		})
+		return
+	}
+
+	var digest models.NotificationDigest
+	if err := s.db.Where("user_id = ?", userID).FirstOrInit(&digest, models.NotificationDigest{UserID: userID}).Error; err != nil {
+		helpers.InternalServerError(c, "Failed to retrieve digest")
+		return
+	}
+	digest.Frequency = req.Frequency
+	digest.NextRunAt = nextDigestRun(req.Frequency, time.Now(), s.cfg.DigestHour)
+	if err := s.db.Save(&digest).Error; err != nil {
+		helpers.InternalServerError(c, "Failed to update digest")
+		return
+	}
+	helpers.Success(c, "Digest updated successfully", digest)
+}
+
+// SendDueDigests creates the digest notification of every subscription due at
+// now. Each subscription is claimed by moving its next run, so several
+// instances can run this concurrently without sending a digest twice.
+func (s *Server) SendDueDigests(now time.Time) error {
+	var due []models.NotificationDigest
+	if err := s.db.Where("next_run_at <= ?", now).Find(&due).Error; err != nil {
+		return err
+	}
+
+	for _, digest := range due {
+		claim := s.db.Model(&models.NotificationDigest{}).
+			Where("id = ? AND next_run_at = ?", digest.ID, digest.NextRunAt).
+			Updates(map[string]interface{}{
+				"next_run_at":  nextDigestRun(digest.Frequency, now, s.cfg.DigestHour),
+				"last_sent_at": now,
+			})
+		if claim.Error != nil {
+			return claim.Error
+		}
+		if claim.RowsAffected == 0 {
+			continue // claimed by another instance
+		}
+
+		since := now.AddDate(0, 0, -1)
+		if digest.Frequency == models.DigestWeekly {
+			since = now.AddDate(0, 0, -7)
+		}
+		if digest.LastSentAt != nil {
+			since = *digest.LastSentAt
+		}
+		if err := s.sendDigest(digest, since, now); err != nil {
+			log.Printf("⚠️  Failed to send %s digest to user %d: %v", digest.Frequency, digest.UserID, err)
+		}
+	}
+	return nil
+}
+
+// sendDigest summarizes the unread notifications received in (since, until],
+// nothing is sent when there are none
+func (s *Server) sendDigest(digest models.NotificationDigest, since, until time.Time) error {
+	query := func() *gorm.DB {
+		return s.userNotifications(digest.UserID).
+			Where("is_read = 0 AND archived_at IS NULL AND created_at > ? AND created_at <= ?", since, until).
+			Where("type NOT IN ?", []string{notify.EventDigestDaily, notify.EventDigestWeekly})
+	}
+
+	var total int64
+	if err := query().Select("COALESCE(SUM(count), 0)").Scan(&total).Error; err != nil {
+		return err
+	}
+	if total == 0 {
+		return nil
+	}
+
+	var types []struct {
+		Type  string `json:"type"`
+		Count int64  `json:"count"`
+	}
+	if err := query().Select("type, SUM(count) AS count").Group("type").Order("count DESC").Scan(&types).Error; err != nil {
+		return err
+	}
+
+	var items []string
+	if err := query().Order("created_at DESC").Limit(digestItemLimit).Pluck("title", &items).Error; err != nil {
+		return err
+	}
+
+	return s.notifications().Notify(digest.UserID, digestEventTypes[digest.Frequency], map[string]interface{}{
+		"count": total,
+		"types": types,
+		"items": items,
+		"since": since,
+	})
+}
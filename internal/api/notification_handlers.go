@@ -3,41 +3,83 @@ package api
 import (
     "encoding/json"
     "log"
+    "time"
 
     "github.com/gin-gonic/gin"
     "github.com/google/uuid"
     "gorm.io/gorm"
     "mywall-api/internal/models"
     "mywall-api/internal/helpers"
+    "mywall-api/internal/notify"
 )
 	
-// PERBAIKAN: Struct NotificationHandlers hanya berisi db
+// NotificationHandlers membuat notifikasi dan mengirimnya lewat channel pilihan user
 type NotificationHandlers struct {
-    db *gorm.DB
+	db        *gorm.DB
+	ws        *WebSocketManager
+	notifier  *notify.Dispatcher
+	templates *notify.Templates
+	coalesce  map[string]time.Duration
 }
 
-// listNotifications: ambil semua notifikasi user
-func (h *Server) listNotifications(c *gin.Context) {
-    userIDVal, exists := c.Get("user_id")
-    if !exists {	
-        helpers.Unauthorized(c, "unauthorized")
-        return
-    }
-    userID := userIDVal.(uint)
+// notifications: NotificationHandlers yang memakai db, WebSocket manager, dispatcher dan template server
+func (s *Server) notifications() *NotificationHandlers {
+	return &NotificationHandlers{db: s.db, ws: s.ws, notifier: s.notifier, templates: s.templates, coalesce: s.coalesceWindows}
+}
 
-    var notifs []models.Notification
-    if err := h.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&notifs).Error; err != nil {
-        helpers.InternalServerError(c, "failed to fetch notifications")
-        return
-    }
-    helpers.Success(c, "notifications fetched", notifs)
+// Notify: render template eventType dalam bahasa user dengan metadata, lalu buat notifikasinya.
+// Type yang punya coalescing window digabung ke notifikasi belum dibaca yang masih dalam window.
+func (h *NotificationHandlers) Notify(userID uint, eventType string, metadata map[string]interface{}) error {
+	if window := h.coalesce[eventType]; window > 0 {
+		lock := coalesceLock(userID, eventType)
+		lock.Lock()
+		defer lock.Unlock()
+
+		coalesced, err := h.coalesceInto(userID, eventType, metadata, window)
+		if err != nil || coalesced {
+			return err
+		}
+	}
+
+	title, body, err := h.render(userID, eventType, metadata)
+	if err != nil {
+		return err
+	}
+	return h.CreateNotificationDirect(userID, title, body, eventType, metadata)
+}
+
+// render: pilih locale user, template jatuh ke bahasa default kalau locale belum ada
+func (h *NotificationHandlers) render(userID uint, eventType string, metadata map[string]interface{}) (string, string, error) {
+	var user models.User
+	if err := h.db.Select("id", "locale").First(&user, userID).Error; err != nil {
+		return "", "", err
+	}
+	return h.templates.Render(eventType, user.Locale, metadata)
 }
 
 // PERBAIKAN: Method CreateNotificationDirect sekarang bisa akses h.db
+// Preferensi user untuk Type menentukan channel: muted tidak disimpan sama sekali,
+// tanpa in-app notifikasi langsung diarsipkan dan tidak di-broadcast
 func (h *NotificationHandlers) CreateNotificationDirect(userID uint, title, body, notifType string, metadata map[string]interface{}) error {
+	_, err := h.CreateNotificationUntil(userID, title, body, notifType, metadata, nil)
+	return err
+}
+
+// CreateNotificationUntil: sama dengan CreateNotificationDirect, tapi notifikasi disembunyikan
+// setelah expiresAt lalu dihapus oleh retention job. Hasilnya nil kalau Type di-mute user.
+func (h *NotificationHandlers) CreateNotificationUntil(userID uint, title, body, notifType string, metadata map[string]interface{}, expiresAt *time.Time) (*models.Notification, error) {
+    pref, err := h.notifier.Preference(userID, notifType)
+    if err != nil {
+        return nil, err
+    }
+    if pref.Muted {
+        log.Printf("Notification type %q muted for user %d", notifType, userID)
+        return nil, nil
+    }
+
     metadataJSON, err := json.Marshal(metadata)
     if err != nil {
-        return err
+        return nil, err
     }
 
     n := models.Notification{
@@ -48,13 +90,23 @@ func (h *NotificationHandlers) CreateNotificationDirect(userID uint, title, body
         Type:     notifType,
         Metadata: string(metadataJSON),
         IsRead:   0,
+        Count:    1,
+        ExpiresAt: expiresAt,
+    }
+    if !pref.InApp {
+        now := time.Now()
+        n.ArchivedAt = &now
     }
     
     if err := h.db.Create(&n).Error; err != nil {
-        return err
+        return nil, err
     }
+    h.notifier.Deliver(n, metadata, pref)
 
-    BroadcastNotification(map[string]interface{}{
+    if !pref.InApp {
+        return &n, nil
+    }
+    h.ws.BroadcastNotification(n.UserID, map[string]interface{}{
         "id":       n.ID,
         "user_id":  n.UserID,
         "title":    n.Title,
@@ -62,10 +114,11 @@ func (h *NotificationHandlers) CreateNotificationDirect(userID uint, title, body
         "type":     n.Type,
         "metadata": n.Metadata,
         "is_read":  n.IsRead,
+        "expires_at": n.ExpiresAt,
     })
     
     log.Printf("Broadcasted new notification for user %d", userID)
-    return nil
+    return &n, nil
 }
 
 // createNotification: buat notifikasi baru dan broadcast via WebSocket
@@ -76,15 +129,68 @@ func (h *Server) createNotification(c *gin.Context) {
         Body     string                 `json:"body"`
         Type     string                 `json:"type"`
         Metadata map[string]interface{} `json:"metadata"`
+        SendAt    *time.Time            `json:"send_at"`    // Kosong atau sudah lewat berarti kirim sekarang
+        ExpiresAt *time.Time            `json:"expires_at"`
     }
     if err := c.ShouldBindJSON(&input); err != nil {
         helpers.BadRequest(c, "invalid payload")
         return
     }
 
+    // Penerima wajib user yang ada
+    if input.UserID == 0 {
+        helpers.ValidationError(c, "Validation failed", map[string]string{
+            "userId": "User ID is required",
+        })
+        return
+    }
+    var recipients int64
+    if err := h.db.Model(&models.User{}).Where("id = ?", input.UserID).Count(&recipients).Error; err != nil {
+        helpers.InternalServerError(c, "failed to look up user")
+        return
+    }
+    if recipients == 0 {
+        helpers.ValidationError(c, "Validation failed", map[string]string{
+            "userId": "User not found",
+        })
+        return
+    }
+
+    now := time.Now()
+    if input.ExpiresAt != nil {
+        if !input.ExpiresAt.After(now) {
+            helpers.ValidationError(c, "Validation failed", map[string]string{
+                "expires_at": "Expiry must be in the future",
+            })
+            return
+        }
+        if input.SendAt != nil && !input.ExpiresAt.After(*input.SendAt) {
+            helpers.ValidationError(c, "Validation failed", map[string]string{
+                "expires_at": "Expiry must be after send_at",
+            })
+            return
+        }
+    }
+
+    // Tanpa title, pakai template milik Type dalam bahasa penerima
+    notifs := h.notifications()
+    if input.Title == "" && h.templates.Has(input.Type) {
+        title, body, err := notifs.render(input.UserID, input.Type, input.Metadata)
+        if err != nil {
+            helpers.BadRequest(c, "failed to render notification template: "+err.Error())
+            return
+        }
+        input.Title, input.Body = title, body
+    }
+
+    // send_at di masa depan: simpan dulu, scheduler yang mengirim saat waktunya tiba
+    if input.SendAt != nil && input.SendAt.After(now) {
+        h.scheduleNotification(c, input.UserID, input.Title, input.Body, input.Type, input.Metadata, *input.SendAt, input.ExpiresAt)
+        return
+    }
+
     // PERBAIKAN: Panggil CreateNotificationDirect dengan benar
-    notifHandler := &NotificationHandlers{db: h.db}
-    if err := notifHandler.CreateNotificationDirect(input.UserID, input.Title, input.Body, input.Type, input.Metadata); err != nil {
+    if _, err := notifs.CreateNotificationUntil(input.UserID, input.Title, input.Body, input.Type, input.Metadata, input.ExpiresAt); err != nil {
         helpers.InternalServerError(c, "failed to create notification")
         return
     }
@@ -96,35 +202,6 @@ func (h *Server) createNotification(c *gin.Context) {
         "type":     input.Type,
         "metadata": input.Metadata,
         "is_read":  0,
+        "expires_at": input.ExpiresAt,
     })
 }
-
-// markRead: tandai notifikasi sebagai dibaca
-func (h *Server) markRead(c *gin.Context) {
-    var input struct {
-        UserID  uint   `json:"user_Id"`   // PERBAIKAN: Ubah ke uint
-        NotifID string `json:"notif_Id"`
-    }
-    if err := c.ShouldBindJSON(&input); err != nil {
-        helpers.BadRequest(c, "invalid payload")
-        return
-    }
-	log.Printf("Marking notification %s as read for user %d", input.NotifID, input.UserID)
-    if err := h.db.Model(&models.Notification{}).
-        Where("id = ? AND user_id = ?", input.NotifID, input.UserID).
-        Update("is_read", 1).Error; err != nil {
-        helpers.InternalServerError(c, "failed to mark read")
-        return
-    }
-
-    // Broadcast badge update
-    var unreadCount int64
-    h.db.Model(&models.Notification{}).
-        Where("user_id = ? AND is_read = 0", input.UserID).
-        Count(&unreadCount)
-    BroadcastBadgeUpdate(input.UserID, unreadCount)
-    helpers.Success(c, "notification marked read", map[string]interface{}{
-        "user_id": input.UserID,
-        "unread":  unreadCount,
-    })
-}
\ No newline at end of file
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"mywall-api/internal/models"
+	"mywall-api/internal/notify"
+)
+
+func TestNotificationUsesRecipientLocale(t *testing.T) {
+	ts := newTestServer(t)
+	_, adminToken := ts.login(t, "admin@example.com", true)
+	budiID, _ := ts.login(t, "budi@example.com", false)
+	annID, _ := ts.login(t, "ann@example.com", false)
+	ts.db.Model(&models.User{}).Where("id = ?", budiID).Update("locale", "id")
+	// A locale without templates falls back to English
+	ts.db.Model(&models.User{}).Where("id = ?", annID).Update("locale", "fr")
+
+	for _, userID := range []uint{budiID, annID} {
+		if err := ts.notifications().Notify(userID, notify.EventGalleryCreated, map[string]interface{}{"title": "Sunset"}); err != nil {
+			t.Fatal(err)
+		}
+		// Without a title POST /api/notifications renders the template of its type
+		code, resp := ts.do(t, "POST", "/api/notifications", adminToken, gin.H{
+			"userId": userID, "type": notify.EventGalleryCreated, "metadata": gin.H{"title": "Forest"},
+		})
+		if code != http.StatusOK {
+			t.Fatalf("create = %d %v", code, resp)
+		}
+	}
+
+	want := map[uint][]string{
+		budiID: {`Galeri "Sunset" berhasil dibuat.`, `Galeri "Forest" berhasil dibuat.`},
+		annID:  {`Your gallery "Sunset" has been created.`, `Your gallery "Forest" has been created.`},
+	}
+	for userID, bodies := range want {
+		stored := storedNotifications(t, ts, userID)
+		if len(stored) != 2 {
+			t.Fatalf("user %d has %d notifications", userID, len(stored))
+		}
+		for i, n := range stored {
+			if n.Body != bodies[i] {
+				t.Errorf("user %d notification %d = %q, want %q", userID, i, n.Body, bodies[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,359 @@
+package api
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"mywall-api/internal/helpers"
+	"mywall-api/internal/models"
+)
+
+const (
+	defaultNotificationLimit = 20
+	maxNotificationLimit     = 100
+	// maxBulkNotificationIDs caps the IDs accepted by a single request
+	maxBulkNotificationIDs = 500
+)
+
+// Bulk actions accepted by POST /api/notifications/bulk
+const (
+	bulkActionRead      = "read"
+	bulkActionUnread    = "unread"
+	bulkActionArchive   = "archive"
+	bulkActionUnarchive = "unarchive"
+	bulkActionDelete    = "delete"
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// notificationCursor points at the last notification of a page, ordered by
+// created_at then id, both descending
+type notificationCursor struct {
+	createdAt time.Time
+	id        string
+}
+
+func (nc notificationCursor) encode() string {
+	raw := fmt.Sprintf("%d:%s", nc.createdAt.UnixNano(), nc.id)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeNotificationCursor(value string) (notificationCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return notificationCursor{}, errInvalidCursor
+	}
+	nanos, id, ok := strings.Cut(string(raw), ":")
+	if !ok || id == "" {
+		return notificationCursor{}, errInvalidCursor
+	}
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return notificationCursor{}, errInvalidCursor
+	}
+	return notificationCursor{createdAt: time.Unix(0, n), id: id}, nil
+}
+
+// notificationFilter holds the inbox filters shared by listing and mark-all-read
+type notificationFilter struct {
+	types    []string
+	read     string // "true", "false" or empty for both
+	archived string // "true", "false" or "all", defaults to "false"
+}
+
+func parseNotificationFilter(c *gin.Context) (notificationFilter, error) {
+	f := notificationFilter{
+		read:     strings.ToLower(c.Query("read")),
+		archived: strings.ToLower(c.DefaultQuery("archived", "false")),
+	}
+	for _, t := range strings.Split(c.Query("type"), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			f.types = append(f.types, t)
+		}
+	}
+	if f.read != "" && f.read != "true" && f.read != "false" {
+		return f, errors.New("read must be true or false")
+	}
+	if f.archived != "true" && f.archived != "false" && f.archived != "all" {
+		return f, errors.New("archived must be true, false or all")
+	}
+	return f, nil
+}
+
+func (f notificationFilter) apply(db *gorm.DB) *gorm.DB {
+	if len(f.types) > 0 {
+		db = db.Where("type IN ?", f.types)
+	}
+	switch f.read {
+	case "true":
+		db = db.Where("is_read = 1")
+	case "false":
+		db = db.Where("is_read = 0")
+	}
+	switch f.archived {
+	case "true":
+		db = db.Where("archived_at IS NOT NULL")
+	case "false":
+		db = db.Where("archived_at IS NULL")
+	}
+	return db
+}
+
+// validateNotificationIDs returns why a list of IDs is rejected, or an empty string
+func validateNotificationIDs(ids []string) string {
+	if len(ids) == 0 {
+		return "At least one ID is required"
+	}
+	if len(ids) > maxBulkNotificationIDs {
+		return fmt.Sprintf("At most %d IDs are allowed", maxBulkNotificationIDs)
+	}
+	return ""
+}
+
+// userNotifications scopes a query to the caller's notifications, expired ones
+// are hidden until the retention job purges them
+func (s *Server) userNotifications(userID uint) *gorm.DB {
+	return s.db.Model(&models.Notification{}).
+		Where("user_id = ?", userID).
+		Where("(expires_at IS NULL OR expires_at > ?)", time.Now())
+}
+
+// unreadNotificationCount counts unread notifications still in the inbox
+func (s *Server) unreadNotificationCount(userID uint) (int64, error) {
+	var unread int64
+	err := s.userNotifications(userID).
+		Where("is_read = 0 AND archived_at IS NULL").
+		Count(&unread).Error
+	return unread, err
+}
+
+// publishUnreadCount pushes the new badge count after the read state changed
+func (s *Server) publishUnreadCount(userID uint) int64 {
+	unread, err := s.unreadNotificationCount(userID)
+	if err != nil {
+		return 0
+	}
+	s.ws.BroadcastBadgeUpdate(userID, unread)
+	return unread
+}
+
+// listNotifications returns the caller's inbox newest first, a page at a time
+func (s *Server) listNotifications(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultNotificationLimit)))
+	if err != nil || limit < 1 || limit > maxNotificationLimit {
+		limit = defaultNotificationLimit
+	}
+
+	filter, err := parseNotificationFilter(c)
+	if err != nil {
+		helpers.BadRequest(c, err.Error())
+		return
+	}
+
+	query := filter.apply(s.userNotifications(userID))
+	if value := c.Query("cursor"); value != "" {
+		cursor, err := decodeNotificationCursor(value)
+		if err != nil {
+			helpers.BadRequest(c, "Invalid cursor")
+			return
+		}
+		query = query.Where("(created_at < ? OR (created_at = ? AND id < ?))",
+			cursor.createdAt, cursor.createdAt, cursor.id)
+	}
+
+	// One extra row tells whether another page follows
+	var notifs []models.Notification
+	if err := query.Order("created_at DESC, id DESC").Limit(limit + 1).Find(&notifs).Error; err != nil {
+		helpers.InternalServerError(c, "Failed to retrieve notifications")
+		return
+	}
+
+	hasNext := len(notifs) > limit
+	nextCursor := ""
+	if hasNext {
+		notifs = notifs[:limit]
+		last := notifs[len(notifs)-1]
+		nextCursor = notificationCursor{createdAt: last.CreatedAt, id: last.ID}.encode()
+	}
+
+	helpers.Success(c, "Notifications retrieved successfully", gin.H{
+		"data": notifs,
+		"pagination": gin.H{
+			"items_per_page": limit,
+			"has_next":       hasNext,
+			"next_cursor":    nextCursor,
+		},
+		"filters": gin.H{
+			"type":     filter.types,
+			"read":     filter.read,
+			"archived": filter.archived,
+		},
+	})
+}
+
+// getUnreadCount returns the number of unread notifications in the inbox
+func (s *Server) getUnreadCount(c *gin.Context) {
+	unread, err := s.unreadNotificationCount(c.GetUint("user_id"))
+	if err != nil {
+		helpers.InternalServerError(c, "Failed to count notifications")
+		return
+	}
+	helpers.Success(c, "Unread count retrieved successfully", gin.H{"unread": unread})
+}
+
+// markRead marks the given notifications of the caller as read, notif_Id is
+// still accepted for clients sending a single ID
+func (s *Server) markRead(c *gin.Context) {
+	var input struct {
+		IDs     []string `json:"ids"`
+		NotifID string   `json:"notif_Id"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		helpers.BadRequest(c, "Invalid request data")
+		return
+	}
+	if input.NotifID != "" {
+		input.IDs = append(input.IDs, input.NotifID)
+	}
+	if msg := validateNotificationIDs(input.IDs); msg != "" {
+		helpers.ValidationError(c, "Validation failed", map[string]string{"ids": msg})
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	result := s.userNotifications(userID).Where("id IN ?", input.IDs).Update("is_read", 1)
+	if result.Error != nil {
+		helpers.InternalServerError(c, "Failed to update notifications")
+		return
+	}
+
+	helpers.Success(c, "Notifications marked as read", gin.H{
+		"affected": result.RowsAffected,
+		"unread":   s.publishUnreadCount(userID),
+	})
+}
+
+// markAllRead marks every unread notification in the inbox as read, optionally
+// only those of the given types
+func (s *Server) markAllRead(c *gin.Context) {
+	filter, err := parseNotificationFilter(c)
+	if err != nil {
+		helpers.BadRequest(c, err.Error())
+		return
+	}
+	filter.read = "false"
+	filter.archived = "false"
+
+	userID := c.GetUint("user_id")
+	result := filter.apply(s.userNotifications(userID)).Update("is_read", 1)
+	if result.Error != nil {
+		helpers.InternalServerError(c, "Failed to update notifications")
+		return
+	}
+
+	helpers.Success(c, "All notifications marked as read", gin.H{
+		"affected": result.RowsAffected,
+		"unread":   s.publishUnreadCount(userID),
+	})
+}
+
+// bulkNotifications applies one action to several notifications of the caller
+func (s *Server) bulkNotifications(c *gin.Context) {
+	var input struct {
+		Action string   `json:"action"`
+		IDs    []string `json:"ids"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		helpers.BadRequest(c, "Invalid request data")
+		return
+	}
+	errorMessages := make(map[string]string)
+	switch input.Action {
+	case bulkActionRead, bulkActionUnread, bulkActionArchive, bulkActionUnarchive, bulkActionDelete:
+	default:
+		errorMessages["action"] = "Action must be one of read, unread, archive, unarchive or delete"
+	}
+	if msg := validateNotificationIDs(input.IDs); msg != "" {
+		errorMessages["ids"] = msg
+	}
+	if len(errorMessages) > 0 {
+		helpers.ValidationError(c, "Validation failed", errorMessages)
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	query := s.userNotifications(userID).Where("id IN ?", input.IDs)
+
+	var result *gorm.DB
+	switch input.Action {
+	case bulkActionRead:
+		result = query.Update("is_read", 1)
+	case bulkActionUnread:
+		result = query.Update("is_read", 0)
+	case bulkActionArchive:
+		result = query.Where("archived_at IS NULL").Update("archived_at", time.Now())
+	case bulkActionUnarchive:
+		result = query.Where("archived_at IS NOT NULL").Update("archived_at", nil)
+	case bulkActionDelete:
+		result = query.Delete(&models.Notification{})
+	}
+	if result.Error != nil {
+		helpers.InternalServerError(c, "Failed to update notifications")
+		return
+	}
+
+	helpers.Success(c, "Notifications updated successfully", gin.H{
+		"action":   input.Action,
+		"affected": result.RowsAffected,
+		"unread":   s.publishUnreadCount(userID),
+	})
+}
+
+// archiveNotification moves one notification out of the inbox
+func (s *Server) archiveNotification(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var notif models.Notification
+	if err := s.userNotifications(userID).Where("id = ?", c.Param("id")).First(&notif).Error; err != nil {
+		helpers.NotFound(c, "Notification not found")
+		return
+	}
+
+	if notif.ArchivedAt == nil {
+		now := time.Now()
+		if err := s.userNotifications(userID).Where("id = ?", notif.ID).Update("archived_at", now).Error; err != nil {
+			helpers.InternalServerError(c, "Failed to archive notification")
+			return
+		}
+		notif.ArchivedAt = &now
+		s.publishUnreadCount(userID)
+	}
+
+	helpers.Success(c, "Notification archived successfully", notif)
+}
+
+// deleteNotification soft deletes one notification of the caller
+func (s *Server) deleteNotification(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	result := s.userNotifications(userID).Where("id = ?", c.Param("id")).Delete(&models.Notification{})
+	if result.Error != nil {
+		helpers.InternalServerError(c, "Failed to delete notification")
+		return
+	}
+	if result.RowsAffected == 0 {
+		helpers.NotFound(c, "Notification not found")
+		return
+	}
+
+	s.publishUnreadCount(userID)
+	helpers.Success(c, "Notification deleted successfully", nil)
+}
@@ -0,0 +1,228 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"mywall-api/internal/models"
+)
+
+// seedNotification stores a notification with a fixed id and creation time
+func seedNotification(t *testing.T, ts *testServer, userID uint, id, notifType string, createdAt time.Time, read bool) {
+	t.Helper()
+	n := models.Notification{ID: id, UserID: userID, Title: id, Body: "x", Type: notifType}
+	n.CreatedAt = createdAt
+	if read {
+		n.IsRead = 1
+	}
+	if err := ts.db.Create(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// listIDs fetches one inbox page and returns its ids and next cursor
+func listIDs(t *testing.T, ts *testServer, token, query string) ([]string, string) {
+	t.Helper()
+	code, resp := ts.do(t, "GET", "/api/notifications?"+query, token, nil)
+	if code != http.StatusOK {
+		t.Fatalf("GET ?%s = %d %v", query, code, resp)
+	}
+	page := resp["data"].(map[string]interface{})
+	var ids []string
+	for _, n := range page["data"].([]interface{}) {
+		ids = append(ids, n.(map[string]interface{})["id"].(string))
+	}
+	return ids, page["pagination"].(map[string]interface{})["next_cursor"].(string)
+}
+
+func TestNotificationCursorPaginationEqualTimestamps(t *testing.T) {
+	ts := newTestServer(t)
+	userID, token := ts.login(t, "user@example.com", false)
+
+	// Five notifications in the same instant, ordered by id among themselves
+	now := time.Now().Truncate(time.Second)
+	var want []string
+	for i := 5; i >= 1; i-- {
+		id := fmt.Sprintf("n%d", i)
+		seedNotification(t, ts, userID, id, "system", now, false)
+		want = append(want, id)
+	}
+	seedNotification(t, ts, userID, "older", "system", now.Add(-time.Minute), false)
+	seedNotification(t, ts, userID, "newer", "system", now.Add(time.Minute), false)
+	want = append([]string{"newer"}, append(want, "older")...)
+
+	for _, limit := range []int{1, 2, 3, 7} {
+		var got []string
+		cursor := ""
+		for pages := 0; ; pages++ {
+			if pages > len(want) {
+				t.Fatalf("limit %d: pagination does not end", limit)
+			}
+			ids, next := listIDs(t, ts, token, fmt.Sprintf("limit=%d&cursor=%s", limit, cursor))
+			got = append(got, ids...)
+			if next == "" {
+				break
+			}
+			cursor = next
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("limit %d: got %v, want %v", limit, got, want)
+		}
+	}
+
+	if code, _ := ts.do(t, "GET", "/api/notifications?cursor=not-a-cursor", token, nil); code != http.StatusBadRequest {
+		t.Fatalf("invalid cursor = %d, want 400", code)
+	}
+}
+
+func TestNotificationFilters(t *testing.T) {
+	ts := newTestServer(t)
+	userID, token := ts.login(t, "user@example.com", false)
+	now := time.Now()
+	seedNotification(t, ts, userID, "gallery-unread", "gallery.created", now, false)
+	seedNotification(t, ts, userID, "gallery-read", "gallery.created", now.Add(-time.Second), true)
+	seedNotification(t, ts, userID, "system-unread", "system", now.Add(-2*time.Second), false)
+	seedNotification(t, ts, userID, "comment-archived", "comment.created", now.Add(-3*time.Second), false)
+	ts.db.Model(&models.Notification{}).Where("id = ?", "comment-archived").Update("archived_at", now)
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"gallery-unread", "gallery-read", "system-unread"}},
+		{"type=gallery.created", []string{"gallery-unread", "gallery-read"}},
+		{"type=system,comment.created", []string{"system-unread"}},
+		{"read=false", []string{"gallery-unread", "system-unread"}},
+		{"read=true", []string{"gallery-read"}},
+		{"type=gallery.created&read=false", []string{"gallery-unread"}},
+		{"archived=true", []string{"comment-archived"}},
+		{"archived=all&read=false", []string{"gallery-unread", "system-unread", "comment-archived"}},
+	}
+	for _, tt := range tests {
+		if got, _ := listIDs(t, ts, token, tt.query); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("?%s = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+
+	for _, query := range []string{"read=maybe", "archived=never"} {
+		if code, _ := ts.do(t, "GET", "/api/notifications?"+query, token, nil); code != http.StatusBadRequest {
+			t.Errorf("?%s = %d, want 400", query, code)
+		}
+	}
+
+	// mark-all-read honours the type filter
+	code, resp := ts.do(t, "POST", "/api/notifications/read-all?type=system", token, nil)
+	if code != http.StatusOK || resp["data"].(map[string]interface{})["affected"].(float64) != 1 {
+		t.Fatalf("read-all = %d %v", code, resp)
+	}
+	if got, _ := listIDs(t, ts, token, "read=false"); !reflect.DeepEqual(got, []string{"gallery-unread"}) {
+		t.Fatalf("unread after read-all = %v", got)
+	}
+}
+
+// bulk posts a bulk action and returns the affected and unread counts
+func bulk(t *testing.T, ts *testServer, token, action string, ids ...string) (float64, float64) {
+	t.Helper()
+	code, resp := ts.do(t, "POST", "/api/notifications/bulk", token, gin.H{"action": action, "ids": ids})
+	if code != http.StatusOK {
+		t.Fatalf("bulk %s = %d %v", action, code, resp)
+	}
+	data := resp["data"].(map[string]interface{})
+	return data["affected"].(float64), data["unread"].(float64)
+}
+
+func TestNotificationBulkActions(t *testing.T) {
+	ts := newTestServer(t)
+	userID, token := ts.login(t, "user@example.com", false)
+	now := time.Now()
+	for i, id := range []string{"a", "b", "c", "d"} {
+		seedNotification(t, ts, userID, id, "system", now.Add(-time.Duration(i)*time.Second), false)
+	}
+
+	steps := []struct {
+		action   string
+		ids      []string
+		affected float64
+		unread   float64
+		inbox    []string
+	}{
+		{bulkActionRead, []string{"a", "b"}, 2, 2, []string{"a", "b", "c", "d"}},
+		{bulkActionUnread, []string{"b"}, 1, 3, []string{"a", "b", "c", "d"}},
+		{bulkActionArchive, []string{"b", "c"}, 2, 1, []string{"a", "d"}},
+		// Already archived rows are not counted again
+		{bulkActionArchive, []string{"c", "d"}, 1, 0, []string{"a"}},
+		{bulkActionUnarchive, []string{"c"}, 1, 1, []string{"a", "c"}},
+		{bulkActionDelete, []string{"a", "b"}, 2, 1, []string{"c"}},
+	}
+	for _, step := range steps {
+		affected, unread := bulk(t, ts, token, step.action, step.ids...)
+		if affected != step.affected || unread != step.unread {
+			t.Fatalf("%s %v: affected %v unread %v, want %v %v", step.action, step.ids, affected, unread, step.affected, step.unread)
+		}
+		if got, _ := listIDs(t, ts, token, ""); !reflect.DeepEqual(got, step.inbox) {
+			t.Fatalf("%s %v: inbox %v, want %v", step.action, step.ids, got, step.inbox)
+		}
+	}
+	if got, _ := listIDs(t, ts, token, "archived=true"); !reflect.DeepEqual(got, []string{"d"}) {
+		t.Fatalf("archive = %v", got)
+	}
+
+	for _, body := range []gin.H{
+		{"action": "explode", "ids": []string{"c"}},
+		{"action": bulkActionRead, "ids": []string{}},
+		{"action": bulkActionRead, "ids": make([]string, maxBulkNotificationIDs+1)},
+	} {
+		if code, resp := ts.do(t, "POST", "/api/notifications/bulk", token, body); code != http.StatusUnprocessableEntity {
+			t.Errorf("bulk %v = %d %v, want 422", body["action"], code, resp)
+		}
+	}
+}
+
+func TestNotificationActionsAreScopedToOwner(t *testing.T) {
+	ts := newTestServer(t)
+	aliceID, aliceToken := ts.login(t, "alice@example.com", false)
+	bobID, _ := ts.login(t, "bob@example.com", false)
+	now := time.Now()
+	seedNotification(t, ts, aliceID, "alice-1", "system", now, false)
+	seedNotification(t, ts, bobID, "bob-1", "system", now, false)
+	seedNotification(t, ts, bobID, "bob-2", "system", now, false)
+
+	if got, _ := listIDs(t, ts, aliceToken, "archived=all"); !reflect.DeepEqual(got, []string{"alice-1"}) {
+		t.Fatalf("alice lists %v", got)
+	}
+
+	// Alice sends bob's ids to every action
+	for _, action := range []string{bulkActionRead, bulkActionArchive, bulkActionDelete} {
+		if affected, _ := bulk(t, ts, aliceToken, action, "bob-1", "bob-2"); affected != 0 {
+			t.Errorf("bulk %s on bob's ids affected %v", action, affected)
+		}
+	}
+	code, resp := ts.do(t, "POST", "/api/notifications/read", aliceToken, gin.H{"ids": []string{"bob-1"}, "notif_Id": "bob-2"})
+	if code != http.StatusOK || resp["data"].(map[string]interface{})["affected"].(float64) != 0 {
+		t.Errorf("read bob's ids = %d %v", code, resp)
+	}
+	if code, _ := ts.do(t, "POST", "/api/notifications/"+url.PathEscape("bob-1")+"/archive", aliceToken, nil); code != http.StatusNotFound {
+		t.Errorf("archive bob's notification = %d, want 404", code)
+	}
+	if code, _ := ts.do(t, "DELETE", "/api/notifications/bob-1", aliceToken, nil); code != http.StatusNotFound {
+		t.Errorf("delete bob's notification = %d, want 404", code)
+	}
+	// Mark-all-read only touches alice's inbox
+	ts.do(t, "POST", "/api/notifications/read-all", aliceToken, nil)
+
+	var bobs []models.Notification
+	ts.db.Where("user_id = ?", bobID).Order("id").Find(&bobs)
+	if len(bobs) != 2 {
+		t.Fatalf("bob has %d notifications left", len(bobs))
+	}
+	for _, n := range bobs {
+		if n.IsRead != 0 || n.ArchivedAt != nil {
+			t.Errorf("bob's %s changed: read %d archived %v", n.ID, n.IsRead, n.ArchivedAt)
+		}
+	}
+}
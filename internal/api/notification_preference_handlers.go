@@ -0,0 +1,136 @@
+package api
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"mywall-api/internal/helpers"
+	"mywall-api/internal/models"
+	"mywall-api/internal/notify"
+)
+
+// NotificationPreferenceRequest sets the channels of one notification type
+type NotificationPreferenceRequest struct {
+	InApp      bool   `json:"in_app"`
+	Email      bool   `json:"email"`
+	Webhook    bool   `json:"webhook"`
+	WebhookURL string `json:"webhook_url" binding:"max=500"`
+	Muted      bool   `json:"muted"`
+}
+
+// listNotificationPreferences returns the caller's preferences, along with the
+// one applied to types without their own row
+func (s *Server) listNotificationPreferences(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var prefs []models.NotificationPreference
+	if err := s.db.Where("user_id = ?", userID).Order("type").Find(&prefs).Error; err != nil {
+		helpers.InternalServerError(c, "Failed to retrieve notification preferences")
+		return
+	}
+
+	fallback := models.DefaultNotificationPreference(userID, models.NotificationTypeDefault)
+	for _, p := range prefs {
+		if p.Type == models.NotificationTypeDefault {
+			fallback = p
+		}
+	}
+
+	helpers.Success(c, "Notification preferences retrieved successfully", gin.H{
+		"data":    prefs,
+		"default": fallback,
+	})
+}
+
+// updateNotificationPreference creates or replaces the preference of a type,
+// "*" sets the default for every type without its own preference
+func (s *Server) updateNotificationPreference(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	notifType := strings.TrimSpace(c.Param("type"))
+	if notifType == "" || len(notifType) > 100 {
+		helpers.BadRequest(c, "Invalid notification type")
+		return
+	}
+
+	var req NotificationPreferenceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		helpers.BadRequest(c, "Invalid request data")
+		return
+	}
+	req.WebhookURL = strings.TrimSpace(req.WebhookURL)
+	if req.Webhook && req.WebhookURL == "" {
+		helpers.ValidationError(c, "Validation failed", map[string]string{
+			"webhook_url": "Webhook URL is required when webhook is enabled",
+		})
+		return
+	}
+	if req.WebhookURL != "" {
+		if err := notify.ValidateWebhookURL(req.WebhookURL); err != nil {
+			helpers.ValidationError(c, "Validation failed", map[string]string{
+				"webhook_url": "Webhook URL must be a public https URL",
+			})
+			return
+		}
+	}
+
+	var pref models.NotificationPreference
+	err := s.db.Where("user_id = ? AND type = ?", userID, notifType).
+		Attrs(models.NotificationPreference{UserID: userID, Type: notifType}).
+		FirstOrInit(&pref).Error
+	if err != nil {
+		helpers.InternalServerError(c, "Failed to retrieve notification preference")
+		return
+	}
+
+	pref.InApp = req.InApp
+	pref.Email = req.Email
+	pref.Webhook = req.Webhook
+	pref.WebhookURL = req.WebhookURL
+	pref.Muted = req.Muted
+	if err := s.db.Save(&pref).Error; err != nil {
+		helpers.InternalServerError(c, "Failed to save notification preference")
+		return
+	}
+
+	helpers.Success(c, "Notification preference saved successfully", pref)
+}
+
+// deleteNotificationPreference resets a type to the caller's default preference
+func (s *Server) deleteNotificationPreference(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	// Unscoped so a later update can recreate the row despite the unique index
+	result := s.db.Unscoped().
+		Where("user_id = ? AND type = ?", userID, c.Param("type")).
+		Delete(&models.NotificationPreference{})
+	if result.Error != nil {
+		helpers.InternalServerError(c, "Failed to delete notification preference")
+		return
+	}
+	if result.RowsAffected == 0 {
+		helpers.NotFound(c, "Notification preference not found")
+		return
+	}
+
+	helpers.Success(c, "Notification preference reset successfully", nil)
+}
+
+// listNotificationDeliveries returns the delivery log of one of the caller's notifications
+func (s *Server) listNotificationDeliveries(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var count int64
+	if err := s.userNotifications(userID).Where("id = ?", c.Param("id")).Count(&count).Error; err != nil || count == 0 {
+		helpers.NotFound(c, "Notification not found")
+		return
+	}
+
+	var deliveries []models.NotificationDelivery
+	if err := s.db.Where("notification_id = ? AND user_id = ?", c.Param("id"), userID).
+		Order("created_at").Find(&deliveries).Error; err != nil {
+		helpers.InternalServerError(c, "Failed to retrieve deliveries")
+		return
+	}
+
+	helpers.Success(c, "Deliveries retrieved successfully", deliveries)
+}
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"mywall-api/internal/helpers"
+	"mywall-api/internal/models"
+)
+
+const (
+	// scheduledBatchSize caps the scheduled notifications delivered per run
+	scheduledBatchSize = 100
+	// scheduledStaleAfter releases claims of an instance that died while sending
+	scheduledStaleAfter = 10 * time.Minute
+	// retentionBatchSize caps the expired notifications purged per statement
+	retentionBatchSize = 1000
+)
+
+// scheduleNotification stores a notification to be delivered at sendAt
+func (s *Server) scheduleNotification(c *gin.Context, userID uint, title, body, notifType string, metadata map[string]interface{}, sendAt time.Time, expiresAt *time.Time) {
+	metadataJSON, err := json.Marshal(metadata)
+	if err != nil {
+		helpers.BadRequest(c, "invalid metadata")
+		return
+	}
+
+	scheduled := models.ScheduledNotification{
+		UserID:    userID,
+		CreatedBy: c.GetUint("user_id"),
+		Title:     title,
+		Body:      body,
+		Type:      notifType,
+		Metadata:  string(metadataJSON),
+		SendAt:    sendAt,
+		ExpiresAt: expiresAt,
+		Status:    models.ScheduledPending,
+	}
+	if err := s.db.Create(&scheduled).Error; err != nil {
+		helpers.InternalServerError(c, "failed to schedule notification")
+		return
+	}
+	helpers.Created(c, "Notification scheduled successfully", scheduled)
+}
+
+// listScheduledNotifications returns the notifications the caller scheduled
+// that were not delivered yet
+func (s *Server) listScheduledNotifications(c *gin.Context) {
+	var scheduled []models.ScheduledNotification
+	err := s.db.Where("created_by = ? AND status IN ?", c.GetUint("user_id"),
+		[]string{models.ScheduledPending, models.ScheduledSending, models.ScheduledFailed}).
+		Order("send_at").
+		Find(&scheduled).Error
+	if err != nil {
+		helpers.InternalServerError(c, "Failed to retrieve scheduled notifications")
+		return
+	}
+	helpers.Success(c, "Scheduled notifications retrieved successfully", scheduled)
+}
+
+// cancelScheduledNotification cancels a pending notification the caller scheduled
+func (s *Server) cancelScheduledNotification(c *gin.Context) {
+	result := s.db.Model(&models.ScheduledNotification{}).
+		Where("id = ? AND created_by = ? AND status = ?", c.Param("id"), c.GetUint("user_id"), models.ScheduledPending).
+		Update("status", models.ScheduledCancelled)
+	if result.Error != nil {
+		helpers.InternalServerError(c, "Failed to cancel scheduled notification")
+		return
+	}
+	if result.RowsAffected == 0 {
+		helpers.NotFound(c, "Pending scheduled notification not found")
+		return
+	}
+	helpers.Success(c, "Scheduled notification cancelled successfully", nil)
+}
+
+// DeliverDueNotifications turns scheduled notifications whose send time has
+// come into notifications. Each row is claimed before sending so several
+// instances never deliver it twice.
+func (s *Server) DeliverDueNotifications(now time.Time) error {
+	var due []models.ScheduledNotification
+	err := s.db.Where("send_at <= ?", now).
+		Where("status = ? OR (status = ? AND updated_at < ?)",
+			models.ScheduledPending, models.ScheduledSending, now.Add(-scheduledStaleAfter)).
+		Order("send_at").
+		Limit(scheduledBatchSize).
+		Find(&due).Error
+	if err != nil {
+		return err
+	}
+
+	notifs := s.notifications()
+	for _, scheduled := range due {
+		claim := s.db.Model(&models.ScheduledNotification{}).
+			Where("id = ? AND status = ? AND updated_at = ?", scheduled.ID, scheduled.Status, scheduled.UpdatedAt).
+			Updates(map[string]interface{}{"status": models.ScheduledSending, "updated_at": now})
+		if claim.Error != nil {
+			return claim.Error
+		}
+		if claim.RowsAffected == 0 {
+			continue // claimed by another instance
+		}
+
+		updates := map[string]interface{}{"status": models.ScheduledSent}
+		if scheduled.ExpiresAt != nil && !scheduled.ExpiresAt.After(now) {
+			// Expired while waiting, nobody would ever see it
+			updates["last_error"] = "expired before delivery"
+		} else {
+			var metadata map[string]interface{}
+			if scheduled.Metadata != "" {
+				json.Unmarshal([]byte(scheduled.Metadata), &metadata)
+			}
+			n, err := notifs.CreateNotificationUntil(scheduled.UserID, scheduled.Title, scheduled.Body,
+				scheduled.Type, metadata, scheduled.ExpiresAt)
+			if err != nil {
+				log.Printf("⚠️  Failed to deliver scheduled notification %d: %v", scheduled.ID, err)
+				updates["status"] = models.ScheduledFailed
+				updates["last_error"] = err.Error()
+			} else if n != nil {
+				updates["notification_id"] = n.ID
+			}
+		}
+		if err := s.db.Model(&models.ScheduledNotification{}).Where("id = ?", scheduled.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PurgeExpiredNotifications permanently deletes expired notifications along
+// with their delivery logs
+func (s *Server) PurgeExpiredNotifications(now time.Time) error {
+	purged := 0
+	for {
+		var ids []string
+		err := s.db.Unscoped().Model(&models.Notification{}).
+			Where("expires_at <= ?", now).
+			Limit(retentionBatchSize).
+			Pluck("id", &ids).Error
+		if err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			break
+		}
+
+		if err := s.db.Unscoped().Where("notification_id IN ?", ids).Delete(&models.NotificationDelivery{}).Error; err != nil {
+			return err
+		}
+		if err := s.db.Unscoped().Where("id IN ?", ids).Delete(&models.Notification{}).Error; err != nil {
+			return err
+		}
+		purged += len(ids)
+		if len(ids) < retentionBatchSize {
+			break
+		}
+	}
+	if purged > 0 {
+		log.Printf("🧹 Purged %d expired notifications", purged)
+	}
+	return nil
+}
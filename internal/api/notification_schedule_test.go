@@ -0,0 +1,159 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"mywall-api/internal/models"
+)
+
+// schedule posts a notification for userID sent at sendAt and returns the scheduled row id
+func schedule(t *testing.T, ts *testServer, token string, userID uint, sendAt time.Time, expiresAt *time.Time) uint {
+	t.Helper()
+	body := gin.H{"userId": userID, "title": "Maintenance", "body": "Tonight", "type": "system", "send_at": sendAt}
+	if expiresAt != nil {
+		body["expires_at"] = expiresAt
+	}
+	code, resp := ts.do(t, "POST", "/api/notifications", token, body)
+	if code != http.StatusCreated {
+		t.Fatalf("schedule = %d %v", code, resp)
+	}
+	return uint(resp["data"].(map[string]interface{})["ID"].(float64))
+}
+
+func scheduledRow(t *testing.T, ts *testServer, id uint) models.ScheduledNotification {
+	t.Helper()
+	var scheduled models.ScheduledNotification
+	if err := ts.db.First(&scheduled, id).Error; err != nil {
+		t.Fatal(err)
+	}
+	return scheduled
+}
+
+func TestScheduledNotificationDelivery(t *testing.T) {
+	ts := newTestServer(t)
+	_, adminToken := ts.login(t, "admin@example.com", true)
+	userID, _ := ts.login(t, "user@example.com", false)
+	sendAt := time.Now().Add(time.Hour)
+	id := schedule(t, ts, adminToken, userID, sendAt, nil)
+
+	if err := ts.DeliverDueNotifications(sendAt.Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if stored := storedNotifications(t, ts, userID); len(stored) != 0 {
+		t.Fatalf("delivered %d notifications before send_at", len(stored))
+	}
+
+	if err := ts.DeliverDueNotifications(sendAt); err != nil {
+		t.Fatal(err)
+	}
+	stored := storedNotifications(t, ts, userID)
+	if len(stored) != 1 || stored[0].Title != "Maintenance" {
+		t.Fatalf("delivered %+v", stored)
+	}
+	scheduled := scheduledRow(t, ts, id)
+	if scheduled.Status != models.ScheduledSent || scheduled.NotificationID != stored[0].ID {
+		t.Fatalf("scheduled = %s %q", scheduled.Status, scheduled.NotificationID)
+	}
+
+	// A later run does not deliver it again
+	if err := ts.DeliverDueNotifications(sendAt.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if stored := storedNotifications(t, ts, userID); len(stored) != 1 {
+		t.Fatalf("%d notifications after a second run", len(stored))
+	}
+}
+
+func TestScheduledNotificationExpiredBeforeDelivery(t *testing.T) {
+	ts := newTestServer(t)
+	_, adminToken := ts.login(t, "admin@example.com", true)
+	userID, _ := ts.login(t, "user@example.com", false)
+	sendAt := time.Now().Add(time.Hour)
+	expiresAt := sendAt.Add(time.Hour)
+	id := schedule(t, ts, adminToken, userID, sendAt, &expiresAt)
+
+	// The scheduler was down until after the expiry
+	if err := ts.DeliverDueNotifications(expiresAt.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if stored := storedNotifications(t, ts, userID); len(stored) != 0 {
+		t.Fatalf("delivered %d expired notifications", len(stored))
+	}
+	if scheduled := scheduledRow(t, ts, id); scheduled.Status != models.ScheduledSent || scheduled.LastError == "" {
+		t.Fatalf("scheduled = %s %q", scheduled.Status, scheduled.LastError)
+	}
+}
+
+func TestCancelScheduledNotification(t *testing.T) {
+	ts := newTestServer(t)
+	_, adminToken := ts.login(t, "admin@example.com", true)
+	_, otherAdminToken := ts.login(t, "other@example.com", true)
+	userID, _ := ts.login(t, "user@example.com", false)
+	sendAt := time.Now().Add(time.Hour)
+	id := schedule(t, ts, adminToken, userID, sendAt, nil)
+	path := "/api/notifications/scheduled/" + strconv.FormatUint(uint64(id), 10)
+
+	// Only the admin who scheduled it sees and cancels it
+	if code, resp := ts.do(t, "GET", "/api/notifications/scheduled", otherAdminToken, nil); code != http.StatusOK || len(resp["data"].([]interface{})) != 0 {
+		t.Fatalf("other admin lists %d %v", code, resp)
+	}
+	if code, _ := ts.do(t, "DELETE", path, otherAdminToken, nil); code != http.StatusNotFound {
+		t.Fatalf("other admin cancel = %d, want 404", code)
+	}
+	if code, resp := ts.do(t, "DELETE", path, adminToken, nil); code != http.StatusOK {
+		t.Fatalf("cancel = %d %v", code, resp)
+	}
+	if code, _ := ts.do(t, "DELETE", path, adminToken, nil); code != http.StatusNotFound {
+		t.Fatalf("second cancel = %d, want 404", code)
+	}
+	if code, resp := ts.do(t, "GET", "/api/notifications/scheduled", adminToken, nil); code != http.StatusOK || len(resp["data"].([]interface{})) != 0 {
+		t.Fatalf("list after cancel = %d %v", code, resp)
+	}
+
+	if err := ts.DeliverDueNotifications(sendAt.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if stored := storedNotifications(t, ts, userID); len(stored) != 0 {
+		t.Fatalf("delivered %d cancelled notifications", len(stored))
+	}
+	if scheduled := scheduledRow(t, ts, id); scheduled.Status != models.ScheduledCancelled {
+		t.Fatalf("status = %s", scheduled.Status)
+	}
+}
+
+func TestExpiredNotificationsHiddenAndPurged(t *testing.T) {
+	ts := newTestServer(t)
+	userID, token := ts.login(t, "user@example.com", false)
+	now := time.Now()
+	seedNotification(t, ts, userID, "current", "system", now, false)
+	seedNotification(t, ts, userID, "expiring", "system", now.Add(-time.Second), false)
+	seedNotification(t, ts, userID, "expired", "system", now.Add(-2*time.Second), false)
+	ts.db.Model(&models.Notification{}).Where("id = ?", "expiring").Update("expires_at", now.Add(time.Hour))
+	ts.db.Model(&models.Notification{}).Where("id = ?", "expired").Update("expires_at", now.Add(-time.Minute))
+
+	ids, _ := listIDs(t, ts, token, "archived=all")
+	if len(ids) != 2 || ids[0] != "current" || ids[1] != "expiring" {
+		t.Fatalf("inbox = %v", ids)
+	}
+	code, resp := ts.do(t, "GET", "/api/notifications/unread-count", token, nil)
+	if code != http.StatusOK || resp["data"].(map[string]interface{})["unread"].(float64) != 2 {
+		t.Fatalf("unread-count = %d %v", code, resp)
+	}
+	// Expired notifications cannot be acted on either
+	if affected, _ := bulk(t, ts, token, bulkActionRead, "expired"); affected != 0 {
+		t.Fatalf("marked an expired notification read")
+	}
+
+	if err := ts.PurgeExpiredNotifications(now); err != nil {
+		t.Fatal(err)
+	}
+	var remaining []string
+	ts.db.Unscoped().Model(&models.Notification{}).Order("id").Pluck("id", &remaining)
+	if len(remaining) != 2 || remaining[0] != "current" || remaining[1] != "expiring" {
+		t.Fatalf("after purge = %v", remaining)
+	}
+}
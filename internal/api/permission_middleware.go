@@ -0,0 +1,275 @@
+package api
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"mywall-api/internal/auth"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"mywall-api/internal/helpers"
+	"mywall-api/internal/models"
+)
+
+// Permission actions stored in PermissionStruct
+const (
+	ActionRead   = "read"
+	ActionEdit   = "edit"
+	ActionDelete = "delete"
+	ActionCreate = "create"
+	ActionSearch = "search"
+)
+
+// superRole bypasses rbac checks so permissions can be bootstrapped
+const superRole = "admin"
+
+// selfServiceRoutes only require authentication, they act on the caller's own
+// data. Keyed by method and route so other methods on the same route, such as
+// creating notifications for anyone, still go through rbac. The value is the
+// API key scope resource the route still requires, key management needs
+// api-keys:read or api-keys:write. The others are open to a key of any scope,
+// /api/events only streams the topics its scopes allow.
+var selfServiceRoutes = map[string]string{
+	"POST /api/regenerate-api-key":               "api-keys",
+	"GET /api/api-keys":                          "api-keys",
+	"POST /api/api-keys":                         "api-keys",
+	"DELETE /api/api-keys/:id":                   "api-keys",
+	"GET /api/notifications":                     "",
+	"POST /api/notifications/read":               "",
+	"POST /api/notifications/read-all":           "",
+	"GET /api/notifications/scheduled":           "",
+	"DELETE /api/notifications/scheduled/:id":    "",
+	"GET /api/notifications/unread-count":        "",
+	"POST /api/notifications/bulk":               "",
+	"DELETE /api/notifications/:id":              "",
+	"POST /api/notifications/:id/archive":        "",
+	"GET /api/notifications/:id/deliveries":      "",
+	"GET /api/notification-digest":               "",
+	"PUT /api/notification-digest":               "",
+	"GET /api/notification-preferences":          "",
+	"PUT /api/notification-preferences/:type":    "",
+	"DELETE /api/notification-preferences/:type": "",
+	"GET /api/locale":                            "",
+	"PUT /api/locale":                            "",
+	"GET /api/events":                            "",
+}
+
+// menuAliases maps a route resource to the menu path guarding it
+var menuAliases = map[string]string{
+	"images": "/galleries",
+}
+
+// listQueryParams are query params that do not turn a read into a search
+var listQueryParams = map[string]bool{
+	"page":       true,
+	"cursor":     true,
+	"limit":      true,
+	"sort_by":    true,
+	"sort_order": true,
+}
+
+// PermissionCache caches resolved permissions per role, keyed by menu path
+type PermissionCache struct {
+	db    *gorm.DB
+	mu    sync.RWMutex
+	roles map[string]map[string]PermissionStruct
+}
+
+// NewPermissionCache creates a new permission cache
+func NewPermissionCache(db *gorm.DB) *PermissionCache {
+	return &PermissionCache{
+		db:    db,
+		roles: make(map[string]map[string]PermissionStruct),
+	}
+}
+
+// Get returns the permissions of a role, loading them from the database on a miss
+func (pc *PermissionCache) Get(roleID string) (map[string]PermissionStruct, error) {
+	pc.mu.RLock()
+	perms, ok := pc.roles[roleID]
+	pc.mu.RUnlock()
+	if ok {
+		return perms, nil
+	}
+
+	perms, err := pc.load(roleID)
+	if err != nil {
+		return nil, err
+	}
+
+	pc.mu.Lock()
+	pc.roles[roleID] = perms
+	pc.mu.Unlock()
+	return perms, nil
+}
+
+// Invalidate drops the cached permissions of a role
+func (pc *PermissionCache) Invalidate(roleID string) {
+	pc.mu.Lock()
+	delete(pc.roles, roleID)
+	pc.mu.Unlock()
+}
+
+// InvalidateAll drops every cached role
+func (pc *PermissionCache) InvalidateAll() {
+	pc.mu.Lock()
+	pc.roles = make(map[string]map[string]PermissionStruct)
+	pc.mu.Unlock()
+}
+
+func (pc *PermissionCache) load(roleID string) (map[string]PermissionStruct, error) {
+	var rows []struct {
+		Path       string
+		Permission string
+	}
+	err := pc.db.Model(&models.Rbac{}).
+		Select("menus.path, rbacs.permission").
+		Joins("JOIN menus ON menus.id = rbacs.menu_id AND menus.deleted_at IS NULL").
+		Where("rbacs.role_id = ?", roleID).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	perms := make(map[string]PermissionStruct)
+	for _, row := range rows {
+		var p PermissionStruct
+		if err := json.Unmarshal([]byte(row.Permission), &p); err != nil {
+			continue
+		}
+		// Several rbac rows for the same menu are merged
+		perms[row.Path] = mergePermissions(perms[row.Path], p)
+	}
+	return perms, nil
+}
+
+func mergePermissions(a, b PermissionStruct) PermissionStruct {
+	return PermissionStruct{
+		Read:   a.Read || b.Read,
+		Edit:   a.Edit || b.Edit,
+		Delete: a.Delete || b.Delete,
+		Create: a.Create || b.Create,
+		Search: a.Search || b.Search,
+	}
+}
+
+// Allows reports whether the permission grants the given action
+func (p PermissionStruct) Allows(action string) bool {
+	switch action {
+	case ActionRead:
+		return p.Read
+	case ActionEdit:
+		return p.Edit
+	case ActionDelete:
+		return p.Delete
+	case ActionCreate:
+		return p.Create
+	case ActionSearch:
+		return p.Search
+	}
+	return false
+}
+
+// menuPathFor maps a route like /api/galleries/:id to its menu path /galleries
+func menuPathFor(fullPath string) string {
+	resource := strings.TrimPrefix(fullPath, "/api/")
+	if i := strings.Index(resource, "/"); i != -1 {
+		resource = resource[:i]
+	}
+	if alias, ok := menuAliases[resource]; ok {
+		return alias
+	}
+	return "/" + resource
+}
+
+// actionFor maps the request method to a permission action
+func actionFor(c *gin.Context) string {
+	switch c.Request.Method {
+	case "POST":
+		return ActionCreate
+	case "PUT", "PATCH":
+		return ActionEdit
+	case "DELETE":
+		return ActionDelete
+	}
+	// Only filtering a collection counts as a search
+	if len(c.Params) > 0 {
+		return ActionRead
+	}
+	for key := range c.Request.URL.Query() {
+		if !listQueryParams[key] {
+			return ActionSearch
+		}
+	}
+	return ActionRead
+}
+
+// scopeAction maps a permission action to the API key scope verb
+func scopeAction(action string) string {
+	if action == ActionRead || action == ActionSearch {
+		return auth.ScopeRead
+	}
+	return auth.ScopeWrite
+}
+
+// permissionMiddleware checks the caller's roles against the rbac table, must run after authMiddleware
+func (s *Server) permissionMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		fullPath := c.FullPath()
+		menuPath := menuPathFor(fullPath)
+		action := actionFor(c)
+
+		scopeResource := strings.TrimPrefix(menuPath, "/")
+		selfResource, selfService := selfServiceRoutes[c.Request.Method+" "+fullPath]
+		if selfService {
+			scopeResource = selfResource
+		}
+
+		// API keys are limited to their scopes on top of the owner's permissions
+		if scopes, ok := c.Get("api_key_scopes"); ok && scopeResource != "" {
+			if !auth.HasScope(scopes.([]string), scopeResource, scopeAction(action)) {
+				helpers.Forbidden(c, "API key scope does not allow "+action+" on /"+scopeResource)
+				c.Abort()
+				return
+			}
+		}
+
+		if selfService {
+			c.Next()
+			return
+		}
+
+		roles := c.GetStringSlice("user_roles")
+		if len(roles) == 0 {
+			helpers.Forbidden(c, "No role assigned")
+			c.Abort()
+			return
+		}
+
+		allowed := false
+		for _, role := range roles {
+			if role == superRole {
+				allowed = true
+				break
+			}
+			perms, err := s.perms.Get(role)
+			if err != nil {
+				helpers.InternalServerError(c, "Failed to resolve permissions")
+				c.Abort()
+				return
+			}
+			if perms[menuPath].Allows(action) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			helpers.Forbidden(c, "Permission denied: "+action+" on "+menuPath)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
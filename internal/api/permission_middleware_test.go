@@ -0,0 +1,170 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"mywall-api/internal/models"
+)
+
+// rbacFixture is a server with an "editor" role that may read /galleries
+type rbacFixture struct {
+	*testServer
+	adminID     uint
+	adminToken  string
+	editorToken string
+	rbacID      uint
+}
+
+func newRbacFixture(t *testing.T) *rbacFixture {
+	t.Helper()
+	ts := newTestServer(t)
+	adminID, adminToken := ts.login(t, "admin@example.com", true)
+	editorID, editorToken := ts.login(t, "editor@example.com", false)
+
+	for _, role := range []models.Role{{ID: "editor", Name: "Editor"}, {ID: "viewer", Name: "Viewer"}} {
+		role.UserID = adminID
+		if err := ts.db.Create(&role).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ts.db.Create(&models.Menu{ID: "galleries", Path: "/galleries", UserID: adminID}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.db.Create(&models.UserRole{UserID: editorID, RoleID: "editor"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	f := &rbacFixture{testServer: ts, adminID: adminID, adminToken: adminToken, editorToken: editorToken}
+	f.rbacID = f.grant(t, "editor", PermissionStruct{Read: true})
+	return f
+}
+
+// grant adds an rbac row for the galleries menu, owner_id has no model field
+func (f *rbacFixture) grant(t *testing.T, roleID string, perm PermissionStruct) uint {
+	t.Helper()
+	permission, _ := json.Marshal(perm)
+	err := f.db.Exec("INSERT INTO rbacs (menu_id, permission, user_id, owner_id, role_id) VALUES (?, ?, ?, ?, ?)",
+		"galleries", string(permission), f.adminID, f.adminID, roleID).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rbac models.Rbac
+	f.db.Order("id DESC").First(&rbac)
+	return rbac.ID
+}
+
+// expect checks whether the request got past the middleware, the handler may
+// still answer 404 or 204
+func (f *rbacFixture) expect(t *testing.T, method, path, token string, allowed bool) {
+	t.Helper()
+	code, resp := f.do(t, method, path, token, nil)
+	if (code != http.StatusForbidden) != allowed || code == http.StatusUnauthorized || code >= 500 {
+		t.Fatalf("%s %s = %d %v, want allowed %v", method, path, code, resp, allowed)
+	}
+}
+
+func TestPermissionMiddlewareAllowsAndDenies(t *testing.T) {
+	f := newRbacFixture(t)
+
+	f.expect(t, "GET", "/api/galleries", f.editorToken, true)
+	f.expect(t, "GET", "/api/galleries/1", f.editorToken, true)
+	f.expect(t, "DELETE", "/api/galleries/1", f.editorToken, false)
+	f.expect(t, "GET", "/api/categories", f.editorToken, false)
+
+	// Paging is a read, any other query param filters and is a search
+	f.expect(t, "GET", "/api/galleries?page=2&limit=5", f.editorToken, true)
+	f.expect(t, "GET", "/api/galleries?title=sunset", f.editorToken, false)
+
+	f.expect(t, "GET", "/api/categories?q=x", f.adminToken, true)
+	f.expect(t, "GET", "/api/roles", f.adminToken, true)
+}
+
+func TestPermissionMiddlewareWithoutRoles(t *testing.T) {
+	f := newRbacFixture(t)
+	userID, token := f.login(t, "norole@example.com", false)
+	// Without user_roles the legacy users.role column is used
+	f.db.Model(&models.User{}).Where("id = ?", userID).Update("role", "")
+
+	code, resp := f.do(t, "GET", "/api/galleries", token, nil)
+	if code != http.StatusForbidden || resp["message"] != "No role assigned" {
+		t.Fatalf("GET /api/galleries = %d %v", code, resp)
+	}
+
+	// Self-service routes only need authentication, other methods on them do not
+	f.expect(t, "GET", "/api/notifications", token, true)
+	f.expect(t, "GET", "/api/notifications/unread-count", token, true)
+	f.expect(t, "POST", "/api/notifications", token, false)
+}
+
+func TestPermissionCacheInvalidatedByRbacUpdate(t *testing.T) {
+	f := newRbacFixture(t)
+	f.expect(t, "GET", "/api/galleries?title=x", f.editorToken, false)
+
+	permission, _ := json.Marshal(PermissionStruct{Read: true, Search: true})
+	path := "/api/rbacs/" + strconv.FormatUint(uint64(f.rbacID), 10)
+	if code, resp := f.do(t, "PUT", path, f.adminToken, gin.H{"permission": string(permission)}); code != http.StatusOK {
+		t.Fatalf("update rbac = %d %v", code, resp)
+	}
+	f.expect(t, "GET", "/api/galleries?title=x", f.editorToken, true)
+
+	// Moving the row to another role takes the permission away from the previous one
+	if code, resp := f.do(t, "PUT", path, f.adminToken, gin.H{"role_id": "viewer"}); code != http.StatusOK {
+		t.Fatalf("move rbac = %d %v", code, resp)
+	}
+	f.expect(t, "GET", "/api/galleries", f.editorToken, false)
+}
+
+func TestPermissionCacheInvalidatedByRoleUpdate(t *testing.T) {
+	f := newRbacFixture(t)
+	f.expect(t, "GET", "/api/galleries", f.editorToken, true)
+
+	// A change the cache does not see until the role is updated
+	f.db.Exec("DELETE FROM rbacs WHERE id = ?", f.rbacID)
+	f.expect(t, "GET", "/api/galleries", f.editorToken, true)
+
+	if code, resp := f.do(t, "PUT", "/api/roles/editor", f.adminToken, gin.H{"name": "Editors"}); code != http.StatusOK {
+		t.Fatalf("update role = %d %v", code, resp)
+	}
+	f.expect(t, "GET", "/api/galleries", f.editorToken, false)
+}
+
+func TestPermissionMiddlewareAPIKeyScopes(t *testing.T) {
+	f := newRbacFixture(t)
+	var editor models.User
+	f.db.Where("email = ?", "editor@example.com").First(&editor)
+	apiKey, _, err := f.auth.CreateAPIKey(editor.ID, "reader", []string{"galleries:read"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The owner may also search and delete, the key only read and search
+	f.grant(t, "editor", PermissionStruct{Read: true, Search: true, Delete: true})
+
+	expect := func(method, path string, allowed bool) {
+		t.Helper()
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("X-API-Key", apiKey)
+		w := httptest.NewRecorder()
+		f.router.ServeHTTP(w, req)
+		if (w.Code != http.StatusForbidden) != allowed || w.Code == http.StatusUnauthorized || w.Code >= 500 {
+			t.Fatalf("%s %s = %d %s, want allowed %v", method, path, w.Code, w.Body.String(), allowed)
+		}
+	}
+
+	expect("GET", "/api/galleries", true)
+	expect("GET", "/api/galleries?title=x", true)
+	expect("DELETE", "/api/galleries/1", false)
+
+	// Self-service routes are open to a key of any scope
+	expect("GET", "/api/notifications", true)
+	expect("GET", "/api/notifications/unread-count", true)
+	expect("GET", "/api/locale", true)
+	expect("GET", "/api/notification-preferences", true)
+
+	// except key management, which needs an api-keys scope
+	expect("GET", "/api/api-keys", false)
+	expect("POST", "/api/regenerate-api-key", false)
+}
@@ -1,13 +1,15 @@
 package api
 
 import (
-    "fmt"
+    "errors"
+    "mime"
     "net/http"
-    "os"
     "path/filepath"
     "strings"
+    "time"
     "mywall-api/internal/models"
     "mywall-api/internal/helpers"
+    "mywall-api/internal/storage"
     
     "github.com/gin-gonic/gin"
 )
@@ -20,7 +22,7 @@ func (s *Server) serveImage(c *gin.Context) {
     day := c.Param("day")
     filename := c.Param("filename")
     // pathfilename := filepath.Join("uploads", "\"", year, "\"", month, "\"", day, "\"", filename)
-    imagePath := filepath.Join("uploads", year, month, day, filename)
+    imagePath := storage.UploadPrefix + "/" + year + "/" + month + "/" + day + "/" + filename
 
     // Basic validation
     if year == "" || month == "" || day == "" || filename == "" {
@@ -29,7 +31,7 @@ func (s *Server) serveImage(c *gin.Context) {
     }
     
     // Security: prevent directory traversal attacks
-    if strings.Contains(filename, "..") || strings.Contains(filename, "/") {
+    if strings.Contains(filename, "..") || strings.Contains(filename, "/") || strings.Contains(filename, "\\") {
         c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid filename"})
         return
     }
@@ -38,6 +40,14 @@ func (s *Server) serveImage(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Gallery not found"})
 		return
 	}
+
+	// Pick the requested rendition, older galleries only have the original
+	size := c.Query("size")
+	renditionPath, ok := gallery.RenditionKey(size)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown image size"})
+		return
+	}
     service := helpers.NewImageViewService(s.db)        
     _, err := service.CreateOrUpdateImageView(gallery.ID, userID, 1)
     if err != nil {
@@ -45,20 +55,97 @@ func (s *Server) serveImage(c *gin.Context) {
         return
     }
     
-    // Construct the file path
-    fmt.Println("path",imagePath)
-    // Check if file exists
-    fileInfo, err := os.Stat(imagePath)
-    if os.IsNotExist(err) {
+    // Without an explicit format the response depends on what the client accepts
+    negotiated := ""
+    if c.Query("format") == "" {
+        c.Header("Vary", "Accept")
+        negotiated = negotiateImageFormat(c.GetHeader("Accept"), renditionPath)
+    }
+
+    // Resize, crop or re-encode on demand
+    if transformRequested(c) || negotiated != "" {
+        s.serveTransformedImage(c, renditionPath, negotiated)
+        return
+    }
+
+    // Hand out a signed URL when the backend supports it, otherwise stream through the API
+    expiry := time.Duration(s.cfg.SignedURLExpiryMinutes) * time.Minute
+    if url, err := s.storage.SignedURL(c.Request.Context(), renditionPath, expiry); err == nil {
+        c.Header("Cache-Control", "private, max-age=60")
+        c.Redirect(http.StatusFound, url)
+        return
+    } else if !errors.Is(err, storage.ErrNotSupported) {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sign image URL"})
+        return
+    }
+
+    info, err := s.storage.Stat(c.Request.Context(), renditionPath)
+    if errors.Is(err, storage.ErrNotFound) {
         c.JSON(http.StatusNotFound, gin.H{"error": "Image not found"})
         return
     }
-    
-    // Optional: Set appropriate headers
-    c.Header("Content-Type", "image/jpeg") // or detect MIME type
-    c.Header("Content-Length", fmt.Sprintf("%d", fileInfo.Size()))
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read image"})
+        return
+    }
+
     c.Header("Cache-Control", "public, max-age=31536000") // Cache for 1 year
-    
+    if notModified(c, info.ETag, info.LastModified) {
+        return
+    }
+
+    reader, info, err := s.storage.Open(c.Request.Context(), renditionPath)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read image"})
+        return
+    }
+    defer reader.Close()
+
     // Serve the file
-    c.File(imagePath)
-}
\ No newline at end of file
+    c.Header("X-Content-Type-Options", "nosniff")
+    c.DataFromReader(http.StatusOK, info.Size, imageContentType(info), reader, nil)
+}
+
+// imageContentType prefers the stored content type and falls back to the key extension
+func imageContentType(info *storage.ObjectInfo) string {
+	if strings.HasPrefix(info.ContentType, "image/") {
+		return info.ContentType
+	}
+	if contentType := mime.TypeByExtension(filepath.Ext(info.Key)); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
+
+// notModified sets ETag and Last-Modified and answers 304 when the client copy is current
+func notModified(c *gin.Context, etag string, lastModified time.Time) bool {
+	if etag != "" {
+		c.Header("ETag", etag)
+	}
+	if !lastModified.IsZero() {
+		c.Header("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	// If-None-Match takes precedence over If-Modified-Since
+	if inm := c.GetHeader("If-None-Match"); inm != "" {
+		if etag == "" {
+			return false
+		}
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == "*" || candidate == strings.TrimPrefix(etag, "W/") {
+				c.Status(http.StatusNotModified)
+				return true
+			}
+		}
+		return false
+	}
+
+	if ims := c.GetHeader("If-Modified-Since"); ims != "" && !lastModified.IsZero() {
+		if t, err := http.ParseTime(ims); err == nil && !lastModified.Truncate(time.Second).After(t) {
+			c.Status(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
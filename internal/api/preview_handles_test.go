@@ -0,0 +1,94 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"mywall-api/internal/models"
+)
+
+// imageRequest serves GET path with the extra headers
+func imageRequest(t *testing.T, ts *testServer, token, path string, headers map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest("GET", path, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	w := httptest.NewRecorder()
+	ts.router.ServeHTTP(w, req)
+	return w
+}
+
+func TestServeImageConditionalRequests(t *testing.T) {
+	ts, token, category := newGalleryTestServer(t)
+	key := "uploads/2026/01/02/photo.png"
+	data := encodePNG(t, testImage(8, 8))
+	ts.storage.Save(context.Background(), key, bytes.NewReader(data), int64(len(data)), "image/png")
+	ts.db.Create(&models.Gallery{Title: "Photo", ImageURL: key, CategoryID: category.ID, UserID: category.UserID})
+	path := "/api/images/2026/01/02/photo.png"
+
+	w := imageRequest(t, ts, token, path, nil)
+	if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), data) {
+		t.Fatalf("GET = %d, %d bytes", w.Code, w.Body.Len())
+	}
+	if got := w.Header().Get("Content-Type"); got != "image/png" {
+		t.Fatalf("Content-Type = %q", got)
+	}
+	if w.Header().Get("X-Content-Type-Options") != "nosniff" {
+		t.Fatal("nosniff not set")
+	}
+	etag, lastModified := w.Header().Get("ETag"), w.Header().Get("Last-Modified")
+	modified, err := http.ParseTime(lastModified)
+	if etag == "" || err != nil {
+		t.Fatalf("ETag %q, Last-Modified %q", etag, lastModified)
+	}
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    int
+	}{
+		{"matching etag", map[string]string{"If-None-Match": etag}, http.StatusNotModified},
+		{"weak etag in a list", map[string]string{"If-None-Match": `"other", W/` + etag}, http.StatusNotModified},
+		{"any etag", map[string]string{"If-None-Match": "*"}, http.StatusNotModified},
+		{"stale etag", map[string]string{"If-None-Match": `"other"`}, http.StatusOK},
+		{"not modified since", map[string]string{"If-Modified-Since": lastModified}, http.StatusNotModified},
+		{"modified since", map[string]string{"If-Modified-Since": modified.Add(-time.Second).Format(http.TimeFormat)}, http.StatusOK},
+		{"invalid date", map[string]string{"If-Modified-Since": "yesterday"}, http.StatusOK},
+		// If-None-Match takes precedence over If-Modified-Since
+		{"stale etag, not modified since", map[string]string{"If-None-Match": `"other"`, "If-Modified-Since": lastModified}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := imageRequest(t, ts, token, path, tt.headers)
+			if w.Code != tt.want {
+				t.Fatalf("GET = %d, want %d", w.Code, tt.want)
+			}
+			if w.Header().Get("ETag") != etag || w.Header().Get("Last-Modified") != lastModified {
+				t.Fatalf("validators = %q %q", w.Header().Get("ETag"), w.Header().Get("Last-Modified"))
+			}
+			if tt.want == http.StatusNotModified && w.Body.Len() != 0 {
+				t.Fatalf("304 with a %d byte body", w.Body.Len())
+			}
+		})
+	}
+}
+
+func TestServeImageContentTypeFromExtension(t *testing.T) {
+	ts, token, category := newGalleryTestServer(t)
+	key := "uploads/2026/01/02/anim.gif"
+	data := animatedGIF(t, 4, 2)
+	// Stored without a content type, as older uploads were
+	ts.storage.Save(context.Background(), key, bytes.NewReader(data), int64(len(data)), "")
+	ts.db.Create(&models.Gallery{Title: "Anim", ImageURL: key, CategoryID: category.ID, UserID: category.UserID})
+
+	w := imageRequest(t, ts, token, "/api/images/2026/01/02/anim.gif", nil)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/gif" {
+		t.Fatalf("GET = %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+}
@@ -106,6 +106,7 @@ func (s *Server) createRbac(c *gin.Context) {
 		helpers.InternalServerError(c,"Failed to create rbac")
 		return
 	}
+	s.perms.Invalidate(rbac.RoleID)
 	helpers.Created(c,"Rbac created successfully",rbac)
 }
 
@@ -124,11 +125,24 @@ func (s *Server) updateRbac(c *gin.Context) {
 		return
 	}
 
+	if input.RoleID != "" {
+		var role models.Role
+		if err := s.db.Where("id = ?", input.RoleID).First(&role).Error; err != nil {
+			helpers.NotFound(c, "Invalid role")
+			return
+		}
+	}
+
+	// The row may move to another role, both lose their cached permissions
+	previousRoleID := rbac.RoleID
 	s.db.Model(&rbac).Updates(models.Rbac{
 		MenuID:       	input.MenuID,
 		Permission: 	input.Permission,
 		UserID:      	userID,
+		RoleID:      	input.RoleID,
 	})
+	s.perms.Invalidate(previousRoleID)
+	s.perms.Invalidate(rbac.RoleID)
 	helpers.Success(c, "Rbac updated successfully", rbac)
 }
 
@@ -141,5 +155,6 @@ func (s *Server) deleteRbac(c *gin.Context) {
 		return
 	}
 	s.db.Delete(&rbac)
+	s.perms.Invalidate(rbac.RoleID)
 	helpers.Success(c, "Rbac deleted", rbac)	
 }
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HugoSmits86/nativewebp"
+	"github.com/google/uuid"
+	"mywall-api/internal/storage"
+)
+
+// Rendition is a resized copy of an uploaded image fitting in MaxSize x MaxSize
+type Rendition struct {
+	Name    string
+	MaxSize int
+}
+
+// ParseRenditions parses a spec like "thumbnail:200,medium:1024", invalid entries are skipped
+func ParseRenditions(spec string) []Rendition {
+	var renditions []Rendition
+	for _, part := range strings.Split(spec, ",") {
+		name, size, ok := strings.Cut(strings.TrimSpace(part), ":")
+		if !ok {
+			continue
+		}
+		maxSize, err := strconv.Atoi(strings.TrimSpace(size))
+		name = strings.TrimSpace(name)
+		if err != nil || maxSize <= 0 || name == "" || name == "original" {
+			continue
+		}
+		renditions = append(renditions, Rendition{Name: name, MaxSize: maxSize})
+	}
+	return renditions
+}
+
+// SaveImageWithRenditions stores the original upload and one resized copy per rendition.
+// It returns the original key and the JSON map of rendition keys recorded on the gallery.
+func SaveImageWithRenditions(ctx context.Context, store storage.Storage, renditions []Rendition, upload *SanitizedImage) (string, string, error) {
+	base := uuid.New().String()
+	now := time.Now()
+
+	originalKey := storage.DateKey(now, base+upload.Ext)
+	if err := store.Save(ctx, originalKey, bytes.NewReader(upload.Data), int64(len(upload.Data)), upload.ContentType); err != nil {
+		return "", "", fmt.Errorf("failed to save file: %w", err)
+	}
+	keys := map[string]string{"original": originalKey}
+
+	cleanup := func() {
+		for _, key := range keys {
+			store.Delete(ctx, key)
+		}
+	}
+
+	if len(renditions) > 0 {
+		img, format, err := image.Decode(bytes.NewReader(upload.Data))
+		if err != nil {
+			cleanup()
+			return "", "", fmt.Errorf("failed to decode image: %w", err)
+		}
+
+		for _, rendition := range renditions {
+			data, contentType, renditionExt, err := encodeRendition(resizeImage(img, rendition.MaxSize, rendition.MaxSize), format)
+			if err != nil {
+				cleanup()
+				return "", "", err
+			}
+			key := storage.DateKey(now, base+"_"+rendition.Name+renditionExt)
+			if err := store.Save(ctx, key, bytes.NewReader(data), int64(len(data)), contentType); err != nil {
+				cleanup()
+				return "", "", fmt.Errorf("failed to save %s rendition: %w", rendition.Name, err)
+			}
+			keys[rendition.Name] = key
+		}
+	}
+
+	renditionsJSON, err := json.Marshal(keys)
+	if err != nil {
+		cleanup()
+		return "", "", err
+	}
+	return originalKey, string(renditionsJSON), nil
+}
+
+// DeleteRenditions removes every stored rendition of a gallery image
+func DeleteRenditions(ctx context.Context, store storage.Storage, renditionsJSON string) {
+	keys := map[string]string{}
+	if renditionsJSON == "" || json.Unmarshal([]byte(renditionsJSON), &keys) != nil {
+		return
+	}
+	for _, key := range keys {
+		store.Delete(ctx, key)
+	}
+}
+
+// encodeRendition keeps PNG and WebP in their format and encodes everything else as JPEG
+func encodeRendition(img image.Image, format string) ([]byte, string, string, error) {
+	var buf bytes.Buffer
+	if format == "webp" {
+		if err := nativewebp.Encode(&buf, img, nil); err != nil {
+			return nil, "", "", fmt.Errorf("failed to encode image: %w", err)
+		}
+		return buf.Bytes(), "image/webp", ".webp", nil
+	}
+	if format == "png" {
+		encoder := png.Encoder{CompressionLevel: png.BestCompression}
+		if err := encoder.Encode(&buf, img); err != nil {
+			return nil, "", "", fmt.Errorf("failed to encode image: %w", err)
+		}
+		return buf.Bytes(), "image/png", ".png", nil
+	}
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 80}); err != nil {
+		return nil, "", "", fmt.Errorf("failed to encode image: %w", err)
+	}
+	return buf.Bytes(), "image/jpeg", ".jpg", nil
+}
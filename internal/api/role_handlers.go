@@ -101,6 +101,8 @@ func (s *Server) updateRole(c *gin.Context) {
 		ID:       	input.ID,
 		Name: 		input.Name,
 	})
+	// Role ID may have changed, drop every cached role
+	s.perms.InvalidateAll()
 	helpers.Success(c, "Role updated successfully", role)
 }
 
@@ -113,5 +115,6 @@ func (s *Server) deleteRole(c *gin.Context) {
 		return
 	}
 	s.db.Delete(&role)
+	s.perms.Invalidate(role.ID)
 	helpers.Success(c, "Role deleted", role)	
 }
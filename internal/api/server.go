@@ -1,68 +1,63 @@
 package api
 
 import (
-	"log"
+	"context"
+	"errors"
+	"mywall-api/config"
 	"mywall-api/internal/auth"
+	"mywall-api/internal/events"
+	"mywall-api/internal/models"
+	"mywall-api/internal/notify"
+	"mywall-api/internal/storage"
 	"net/http"
 	"strings"
-	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/gorilla/websocket"
 	"gorm.io/gorm"
 	"mywall-api/internal/helpers"
 )
 
 // Server represents the HTTP server
 type Server struct {
-	router *gin.Engine
-	db     *gorm.DB
-	auth   *auth.Service
-	ws     *WebSocketManager 
-}
-
-// WebSocketManager manages WebSocket connections
-type WebSocketManager struct {
-	clients   map[*websocket.Conn]bool
-	broadcast chan Message
-	mu        sync.RWMutex
-}
-
-// Message represents a WebSocket message
-type Message struct {
-	Type    string      `json:"type"`
-	Payload interface{} `json:"payload"`
-}
-
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		return true // Allow all origins for development
-	},
-}
-
-var wsManager *WebSocketManager
-
-func init() {
-	wsManager = &WebSocketManager{
-		clients:   make(map[*websocket.Conn]bool),
-		broadcast: make(chan Message),
-	}
-	go wsManager.startBroadcasting()
-}
-
-// NewWebSocketManager creates a new WebSocket manager
-func NewWebSocketManager() *WebSocketManager {
-	return wsManager
+	router          *gin.Engine
+	db              *gorm.DB
+	auth            *auth.Service
+	ws              *WebSocketManager
+	perms           *PermissionCache
+	cfg             *config.Config
+	storage         storage.Storage
+	renditions      []Rendition
+	imageLimits     ImageLimits
+	transforms      *transformCache
+	httpServer      *http.Server
+	notifier        *notify.Dispatcher
+	templates       *notify.Templates
+	coalesceWindows map[string]time.Duration
 }
 
 // NewServer creates a new server instance
-func NewServer(db *gorm.DB, auth *auth.Service) *Server {
+func NewServer(db *gorm.DB, auth *auth.Service, cfg *config.Config, store storage.Storage, bus events.Bus, notifier *notify.Dispatcher) *Server {
 	server := &Server{
-		router: gin.Default(),
-		db:     db,
-		auth:   auth,
-		ws:     NewWebSocketManager(),
+		router:     newRouter(),
+		db:         db,
+		auth:       auth,
+		ws:         NewWebSocketManager(),
+		perms:      NewPermissionCache(db),
+		cfg:        cfg,
+		storage:    store,
+		renditions: ParseRenditions(cfg.ImageRenditions),
+		imageLimits: ImageLimits{
+			MaxPixels:    cfg.MaxImagePixels,
+			MaxDimension: cfg.MaxImageDimension,
+		},
+		transforms:      newTransformCache(cfg.ImageCacheDir, int64(cfg.ImageCacheMaxMB)<<20),
+		notifier:        notifier,
+		templates:       notify.DefaultTemplates(),
+		coalesceWindows: ParseCoalesceWindows(cfg.NotificationCoalesce),
 	}
+	server.ws.UseBus(bus)
+	server.ws.SetReplayLimit(cfg.EventReplayLimit)
 	server.setupRoutes()
 	return server
 }
@@ -74,22 +69,48 @@ func (s *Server) setupRoutes() {
 	{
 		authRoutes.POST("/register", s.handleRegister)
 		authRoutes.POST("/login", s.handleLogin)
+		authRoutes.POST("/refresh", s.handleRefresh)
+		authRoutes.POST("/logout", s.handleLogout)
 	}
 	// WebSocket route
 	s.router.GET("/ws", s.handleWebSocket)
 
 	// Protected routes
 	apiRoutes := s.router.Group("/api")
-	apiRoutes.Use(s.authMiddleware())
+	apiRoutes.Use(s.authMiddleware(), s.permissionMiddleware())
 	{
 		// API key management
 		apiRoutes.POST("/regenerate-api-key", s.handleRegenerateApiKey)
+		apiRoutes.GET("/api-keys", s.listApiKeys)
+		apiRoutes.POST("/api-keys", s.createApiKey)
+		apiRoutes.DELETE("/api-keys/:id", s.revokeApiKey)
 
 		apiRoutes.GET("/images/:year/:month/:day/:filename", s.serveImage)
 		
 		apiRoutes.GET("/notifications", s.listNotifications)
 		apiRoutes.POST("/notifications", s.createNotification)
+		apiRoutes.GET("/notifications/unread-count", s.getUnreadCount)
+		apiRoutes.GET("/notifications/scheduled", s.listScheduledNotifications)
+		apiRoutes.DELETE("/notifications/scheduled/:id", s.cancelScheduledNotification)
 		apiRoutes.POST("/notifications/read", s.markRead)
+		apiRoutes.POST("/notifications/read-all", s.markAllRead)
+		apiRoutes.POST("/notifications/bulk", s.bulkNotifications)
+		apiRoutes.POST("/notifications/:id/archive", s.archiveNotification)
+		apiRoutes.DELETE("/notifications/:id", s.deleteNotification)
+		apiRoutes.GET("/notifications/:id/deliveries", s.listNotificationDeliveries)
+
+		apiRoutes.GET("/locale", s.getLocale)
+		apiRoutes.PUT("/locale", s.updateLocale)
+
+		apiRoutes.GET("/notification-digest", s.getNotificationDigest)
+		apiRoutes.PUT("/notification-digest", s.updateNotificationDigest)
+
+		apiRoutes.GET("/notification-preferences", s.listNotificationPreferences)
+		apiRoutes.PUT("/notification-preferences/:type", s.updateNotificationPreference)
+		apiRoutes.DELETE("/notification-preferences/:type", s.deleteNotificationPreference)
+
+		// Server-Sent Events, the same messages as /ws
+		apiRoutes.GET("/events", s.streamEvents)
 		
 		// Other API routes
 		apiRoutes.GET("/galleries", s.getGalleries)
@@ -121,12 +142,32 @@ func (s *Server) setupRoutes() {
 		apiRoutes.GET("/roles/:id", s.getRole)
 		apiRoutes.PUT("/roles/:id", s.updateRole)
 		apiRoutes.DELETE("/roles/:id", s.deleteRole)
+
+		apiRoutes.GET("/users/:id/roles", s.getUserRoles)
+		apiRoutes.POST("/users/:id/roles", s.assignUserRole)
+		apiRoutes.DELETE("/users/:id/roles/:role_id", s.revokeUserRole)
 	}
 }
 
-// Start starts the HTTP server
+// Start starts the HTTP server, it returns http.ErrServerClosed after Shutdown
 func (s *Server) Start(port string) error {
-	return s.router.Run(":" + port)
+	s.httpServer = &http.Server{
+		Addr:    ":" + port,
+		Handler: s.router,
+	}
+	return s.httpServer.ListenAndServe()
+}
+
+// Shutdown closes WebSocket connections, which the HTTP server does not track
+// once upgraded, then stops accepting requests and waits for in-flight ones
+func (s *Server) Shutdown(ctx context.Context) error {
+	wsErr := s.ws.Shutdown(ctx)
+	if s.httpServer != nil {
+		if err := s.httpServer.Shutdown(ctx); err != nil {
+			return err
+		}
+	}
+	return wsErr
 }
 
 // Authentication middleware
@@ -139,8 +180,7 @@ func (s *Server) authMiddleware() gin.HandlerFunc {
 				token := strings.TrimPrefix(authHeader, "Bearer ")
 				user, err := s.auth.ValidateJWT(token)
 				if err == nil {
-					c.Set("user_id", user.ID)
-					c.Next()
+					s.setAuthenticatedUser(c, user)
 					return
 				}
 			}
@@ -149,10 +189,20 @@ func (s *Server) authMiddleware() gin.HandlerFunc {
 		// If no valid JWT, check for API key
 		apiKey := c.GetHeader("X-API-Key")
 		if apiKey != "" {
-			user, err := s.auth.ValidateAPIKey(apiKey)
+			user, key, err := s.auth.ValidateAPIKey(apiKey)
 			if err == nil {
-				c.Set("user_id", user.ID)
-				c.Next()
+				c.Set("api_key_scopes", key.ScopeList())
+				s.setAuthenticatedUser(c, user)
+				return
+			}
+			switch {
+			case errors.Is(err, auth.ErrExpiredAPIKey):
+				helpers.Unauthorized(c, "API key expired")
+				c.Abort()
+				return
+			case errors.Is(err, auth.ErrInactiveAPIKey):
+				helpers.Unauthorized(c, "API key inactive")
+				c.Abort()
 				return
 			}
 		}
@@ -161,109 +211,15 @@ func (s *Server) authMiddleware() gin.HandlerFunc {
 	}
 }
 
-// WebSocket handler
-func (s *Server) handleWebSocket(c *gin.Context) {
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+// setAuthenticatedUser stores the caller and its roles on the context and continues the chain
+func (s *Server) setAuthenticatedUser(c *gin.Context, user *models.User) {
+	roles, err := s.auth.UserRoles(user)
 	if err != nil {
-		log.Printf("WebSocket upgrade error: %v", err)
+		helpers.InternalServerError(c, "Failed to resolve user roles")
+		c.Abort()
 		return
 	}
-	defer conn.Close()
-
-	// Register client
-	wsManager.mu.Lock()
-	wsManager.clients[conn] = true
-	wsManager.mu.Unlock()
-
-	log.Printf("WebSocket client connected: %s", conn.RemoteAddr())
-	
-	// Send welcome message
-	welcomeMsg := Message{
-		Type:    "connected",
-		Payload: "Connected to WebSocket server",
-	}
-	conn.WriteJSON(welcomeMsg)
-
-	for {
-		var msg Message
-		err := conn.ReadJSON(&msg)
-		if err != nil {
-			log.Printf("WebSocket read error: %v", err)
-			wsManager.mu.Lock()
-			delete(wsManager.clients, conn)
-			wsManager.mu.Unlock()
-			break
-		}
-
-		// Handle different message types from client
-		switch msg.Type {
-		case "join_galleries":
-			log.Printf("Client joined galleries room")
-		case "ping":
-			// Respond to ping
-			conn.WriteJSON(Message{Type: "pong", Payload: "pong"})
-		}
-	}
-}
-
-func (wm *WebSocketManager) startBroadcasting() {
-	for {
-		message := <-wm.broadcast
-		wm.mu.RLock()
-		for client := range wm.clients {
-			err := client.WriteJSON(message)
-			if err != nil {
-				log.Printf("WebSocket write error: %v", err)
-				client.Close()
-				delete(wm.clients, client)
-			}
-		}
-		wm.mu.RUnlock()
-	}
-}
-
-// Helper functions untuk broadcast
-func BroadcastNewGallery(gallery map[string]interface{}) {
-	message := Message{
-		Type:    "new_gallery",
-		Payload: gallery,
-	}
-	wsManager.broadcast <- message
-	log.Printf("Broadcasted new gallery: %v", gallery["title"])
+	c.Set("user_id", user.ID)
+	c.Set("user_roles", roles)
+	c.Next()
 }
-
-func BroadcastUpdateGallery(gallery map[string]interface{}) {
-	message := Message{
-		Type:    "update_gallery",
-		Payload: gallery,
-	}
-	wsManager.broadcast <- message
-	log.Printf("Broadcasted updated gallery: %v", gallery["title"])
-}
-
-func BroadcastDeleteGallery(galleryID string) {
-	message := Message{
-		Type:    "delete_gallery",
-		Payload: map[string]string{"id": galleryID},
-	}
-	wsManager.broadcast <- message
-	log.Printf("Broadcasted deleted gallery ID: %s", galleryID)
-}
-
-func BroadcastNotification(notification map[string]interface{}) {
-	message := Message{
-		Type:    "notification",
-		Payload: notification,
-	}
-	wsManager.broadcast <- message
-	log.Printf("Broadcasted notification: %v", notification["title"])
-}
-
-func BroadcastBadgeUpdate(userID uint, unreadCount int64) {
-	message := Message{
-		Type:    "badge_update",
-		Payload: map[string]interface{}{"user_id": userID, "unread": unreadCount},
-	}
-	wsManager.broadcast <- message
-	log.Printf("Broadcasted badge update for user %d: %d unread", userID, unreadCount)
-}
\ No newline at end of file
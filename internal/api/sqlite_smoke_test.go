@@ -0,0 +1,177 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"mywall-api/config"
+	"mywall-api/internal/auth"
+	"mywall-api/internal/database"
+	"mywall-api/internal/events"
+	"mywall-api/internal/models"
+	"mywall-api/internal/notify"
+	"mywall-api/migrations"
+)
+
+// testServer is a Server backed by a migrated in-memory SQLite database
+type testServer struct {
+	*Server
+	db   *gorm.DB
+	auth *auth.Service
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	db, err := database.Connect(database.DriverSQLite, ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrator := database.NewMigrator(db, migrations.FS)
+	migrator.SetOutput(io.Discard)
+	if err := migrator.Up(); err != nil {
+		t.Fatalf("migrations: %v", err)
+	}
+
+	cfg := config.New()
+	cfg.JWTSecret = "test-secret"
+	authService := auth.NewService(db, cfg.JWTSecret, time.Hour, time.Hour)
+	notifier := notify.NewDispatcher(db, notify.RetryPolicy{MaxAttempts: 1})
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		notifier.Shutdown(ctx)
+	})
+	bus := events.NewMemoryBus()
+	t.Cleanup(func() { bus.Close() })
+
+	return &testServer{Server: NewServer(db, authService, cfg, nil, bus, notifier), db: db, auth: authService}
+}
+
+// login registers a user, optionally with the admin role, and returns its id and access token
+func (ts *testServer) login(t *testing.T, email string, admin bool) (uint, string) {
+	t.Helper()
+	user, _, err := ts.auth.Register(email, "password123", "Test User")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if admin {
+		if err := ts.db.FirstOrCreate(&models.Role{ID: superRole, Name: "Administrator", UserID: user.ID}, "id = ?", superRole).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := ts.db.Create(&models.UserRole{UserID: user.ID, RoleID: superRole}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	tokens, err := ts.auth.Login(email, "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user.ID, tokens.AccessToken
+}
+
+// do sends a request through the router and decodes the response data
+func (ts *testServer) do(t *testing.T, method, path, token string, body interface{}) (int, map[string]interface{}) {
+	t.Helper()
+	var reader io.Reader
+	if body != nil {
+		raw, _ := json.Marshal(body)
+		reader = bytes.NewReader(raw)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	ts.router.ServeHTTP(w, req)
+
+	var resp map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return w.Code, resp
+}
+
+func TestSQLiteNotificationFlow(t *testing.T) {
+	ts := newTestServer(t)
+	adminID, adminToken := ts.login(t, "admin@example.com", true)
+	userID, userToken := ts.login(t, "user@example.com", false)
+
+	// Creating notifications for others needs the create permission
+	code, _ := ts.do(t, "POST", "/api/notifications", userToken, gin.H{"userId": adminID, "title": "spam", "body": "x", "type": "system"})
+	if code != http.StatusForbidden {
+		t.Fatalf("user create = %d, want 403", code)
+	}
+	code, _ = ts.do(t, "POST", "/api/notifications", adminToken, gin.H{"userId": 9999, "title": "t", "body": "x", "type": "system"})
+	if code == http.StatusOK {
+		t.Fatal("created a notification for an unknown user")
+	}
+	for i := 0; i < 3; i++ {
+		code, resp := ts.do(t, "POST", "/api/notifications", adminToken, gin.H{"userId": userID, "title": "hello", "body": "x", "type": "system"})
+		if code != http.StatusOK {
+			t.Fatalf("admin create = %d %v", code, resp)
+		}
+	}
+
+	code, resp := ts.do(t, "GET", "/api/notifications/unread-count", userToken, nil)
+	if code != http.StatusOK || resp["data"].(map[string]interface{})["unread"].(float64) != 3 {
+		t.Fatalf("unread-count = %d %v", code, resp)
+	}
+
+	code, resp = ts.do(t, "GET", "/api/notifications?limit=2", userToken, nil)
+	if code != http.StatusOK {
+		t.Fatalf("list = %d %v", code, resp)
+	}
+	page := resp["data"].(map[string]interface{})
+	if len(page["data"].([]interface{})) != 2 || page["pagination"].(map[string]interface{})["has_next"] != true {
+		t.Fatalf("first page = %v", page)
+	}
+	cursor := page["pagination"].(map[string]interface{})["next_cursor"].(string)
+	code, resp = ts.do(t, "GET", "/api/notifications?limit=2&cursor="+cursor, userToken, nil)
+	if code != http.StatusOK || len(resp["data"].(map[string]interface{})["data"].([]interface{})) != 1 {
+		t.Fatalf("second page = %d %v", code, resp)
+	}
+
+	code, resp = ts.do(t, "POST", "/api/notifications/read-all", userToken, nil)
+	if code != http.StatusOK || resp["data"].(map[string]interface{})["unread"].(float64) != 0 {
+		t.Fatalf("read-all = %d %v", code, resp)
+	}
+}
+
+func TestSQLiteUpdateImageViewDoesNotDeadlock(t *testing.T) {
+	ts := newTestServer(t)
+	userID, _ := ts.login(t, "user@example.com", false)
+
+	// With a single connection, a query outside the open transaction would
+	// wait for it forever and so would every later query
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		body, _ := json.Marshal(gin.H{"gallery_id": "1", "count": 2})
+		c.Request = httptest.NewRequest("PUT", "/", bytes.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Set("user_id", userID)
+		ts.updateImageView(c)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("updateImageView deadlocked")
+	}
+
+	var users int64
+	if err := ts.db.Model(&models.User{}).Count(&users).Error; err != nil || users != 1 {
+		t.Fatalf("database unusable after updateImageView: %d users, %v", users, err)
+	}
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"mywall-api/internal/auth"
+	"mywall-api/internal/events"
+)
+
+// streamClient is a single authenticated WebSocket or SSE connection.
+// Messages are queued on send, and only its writer goroutine writes to the connection.
+type streamClient struct {
+	conn       *websocket.Conn // nil for SSE
+	remoteAddr string
+	userID     uint
+	scopes     []string // nil for JWT sessions, which are not scoped
+
+	send      chan Message
+	done      chan struct{}
+	closeOnce sync.Once
+	closeCode int
+	closeText string
+
+	mu     sync.Mutex
+	topics map[string]bool
+}
+
+func newStreamClient(conn *websocket.Conn, remoteAddr string, userID uint, scopes []string, queueSize int) *streamClient {
+	return &streamClient{
+		conn:       conn,
+		remoteAddr: remoteAddr,
+		userID:     userID,
+		scopes:     scopes,
+		send:       make(chan Message, queueSize),
+		done:       make(chan struct{}),
+		topics:     defaultTopics(),
+	}
+}
+
+// accepts reports whether the client may read the event and subscribed to one of its topics
+func (c *streamClient) accepts(event events.Event) bool {
+	if c.scopes != nil && !auth.HasScope(c.scopes, event.Resource, "read") {
+		return false
+	}
+	return c.subscribedToAny(event.Topics)
+}
+
+// enqueue queues a message without blocking, false means the queue is full or the client closed
+func (c *streamClient) enqueue(message Message) bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+	}
+	select {
+	case c.send <- message:
+		return true
+	default:
+		return false
+	}
+}
+
+// close asks the writer to send a close frame and drop the connection, only the first call counts
+func (c *streamClient) close(code int, text string) {
+	c.closeOnce.Do(func() {
+		c.closeCode = code
+		c.closeText = text
+		close(c.done)
+	})
+}
+
+// writePump writes queued messages to a WebSocket connection and keepalive pings until the client is closed
+// or a write fails. Closing conn also ends the read loop in handleWebSocket.
+func (c *streamClient) writePump() {
+	ticker := time.NewTicker(wsPingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case message := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := c.conn.WriteJSON(message); err != nil {
+				log.Printf("WebSocket write error: %v", err)
+				c.close(websocket.CloseAbnormalClosure, "")
+				return
+			}
+		case <-ticker.C:
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+				c.close(websocket.CloseAbnormalClosure, "")
+				return
+			}
+		case <-c.done:
+			if c.closeCode != websocket.CloseAbnormalClosure {
+				c.conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(c.closeCode, c.closeText),
+					time.Now().Add(wsWriteWait))
+			}
+			return
+		}
+	}
+}
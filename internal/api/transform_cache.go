@@ -0,0 +1,111 @@
+package api
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// transformCacheLowWater is the share of maxBytes eviction trims the cache to,
+// so that not every new file triggers another eviction
+const transformCacheLowWater = 0.9
+
+// transformCache keeps the disk used by cached transformations under maxBytes.
+// Once a new file takes it over the limit, the least recently served files are
+// removed. Files served before this process started count by their mtime.
+type transformCache struct {
+	dir      string
+	maxBytes int64
+
+	mu       sync.Mutex
+	size     int64 // -1 until the directory was scanned
+	lastUsed map[string]time.Time
+}
+
+func newTransformCache(dir string, maxBytes int64) *transformCache {
+	return &transformCache{
+		dir:      filepath.Clean(dir),
+		maxBytes: maxBytes,
+		size:     -1,
+		lastUsed: make(map[string]time.Time),
+	}
+}
+
+// touch records that the cache file at path was served
+func (tc *transformCache) touch(path string) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	tc.lastUsed[path] = time.Now()
+}
+
+// added accounts for a new cache file of size bytes, evicting old files when over the limit
+func (tc *transformCache) added(path string, size int64) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	tc.lastUsed[path] = time.Now()
+	if tc.maxBytes <= 0 {
+		return
+	}
+	if tc.size >= 0 {
+		tc.size += size
+		if tc.size <= tc.maxBytes {
+			return
+		}
+	}
+	tc.evictLocked()
+}
+
+// evictLocked rescans the cache, other instances may share it, and removes
+// the least recently served files until it is under the low water mark
+func (tc *transformCache) evictLocked() {
+	type cacheFile struct {
+		path string
+		size int64
+		used time.Time
+	}
+	var files []cacheFile
+	var total int64
+	// Files removed elsewhere drop out of lastUsed
+	lastUsed := make(map[string]time.Time)
+	filepath.WalkDir(tc.dir, func(path string, d fs.DirEntry, err error) error {
+		// Temp files of renders in progress start with a dot
+		if err != nil || d.IsDir() || strings.HasPrefix(d.Name(), ".") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		used, ok := tc.lastUsed[path]
+		if !ok {
+			used = info.ModTime()
+		}
+		lastUsed[path] = used
+		files = append(files, cacheFile{path: path, size: info.Size(), used: used})
+		total += info.Size()
+		return nil
+	})
+
+	tc.lastUsed = lastUsed
+	tc.size = total
+	if total <= tc.maxBytes {
+		return
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].used.Before(files[j].used) })
+	target := int64(float64(tc.maxBytes) * transformCacheLowWater)
+	for _, f := range files {
+		if tc.size <= target {
+			break
+		}
+		if err := os.Remove(f.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		tc.size -= f.size
+		delete(tc.lastUsed, f.path)
+	}
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func writeCacheFile(t *testing.T, dir, name string, size int, age time.Duration) string {
+	t.Helper()
+	path := filepath.Join(dir, name[:2], name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Now().Add(-age)
+	os.Chtimes(path, mtime, mtime)
+	return path
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestTransformCacheEvictsLeastRecentlyServed(t *testing.T) {
+	dir := t.TempDir()
+	oldest := writeCacheFile(t, dir, "aa-oldest.jpg", 400, 3*time.Hour)
+	served := writeCacheFile(t, dir, "bb-served.jpg", 400, 2*time.Hour)
+	recent := writeCacheFile(t, dir, "cc-recent.jpg", 400, time.Hour)
+	temp := writeCacheFile(t, dir, ".transform-123", 400, 4*time.Hour)
+
+	tc := newTransformCache(dir, 1000)
+	tc.touch(served)
+	fresh := writeCacheFile(t, dir, "dd-fresh.jpg", 400, 0)
+	tc.added(fresh, 400)
+
+	// 1600 bytes over a 1000 byte limit, trimmed to 900 from the least recently served
+	for path, want := range map[string]bool{oldest: false, recent: false, served: true, fresh: true, temp: true} {
+		if exists(path) != want {
+			t.Errorf("%s exists = %v, want %v", filepath.Base(path), !want, want)
+		}
+	}
+	if tc.size != 800 {
+		t.Fatalf("size = %d, want 800", tc.size)
+	}
+
+	// Under the limit nothing is scanned or removed
+	small := writeCacheFile(t, dir, "ee-small.jpg", 100, 0)
+	tc.added(small, 100)
+	if tc.size != 900 || !exists(served) {
+		t.Fatalf("size = %d, served exists = %v", tc.size, exists(served))
+	}
+}
+
+func TestTransformCacheWithoutLimit(t *testing.T) {
+	dir := t.TempDir()
+	old := writeCacheFile(t, dir, "aa-old.jpg", 4000, time.Hour)
+	tc := newTransformCache(dir, 0)
+	tc.added(writeCacheFile(t, dir, "bb-new.jpg", 4000, 0), 4000)
+	if !exists(old) {
+		t.Fatal("file evicted without a limit")
+	}
+}
+
+func TestParseImageTransformQuantizes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		query string
+		want  ImageTransform
+	}{
+		{"w=100", ImageTransform{Width: 128, Fit: "contain", Format: "jpeg", Quality: 80}},
+		{"w=1&h=64&q=81&format=jpg", ImageTransform{Width: 64, Height: 64, Fit: "contain", Format: "jpeg", Quality: 90}},
+		{"w=4000&h=4096&fit=cover&q=1", ImageTransform{Width: 4032, Height: 4096, Fit: "cover", Format: "jpeg", Quality: 10}},
+		{"w=300&format=png&q=55", ImageTransform{Width: 320, Fit: "contain", Format: "png"}},
+		{"h=10&format=webp", ImageTransform{Height: 64, Fit: "contain", Format: "webp"}},
+	}
+	for _, tt := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("GET", "/img?"+tt.query, nil)
+		got, err := parseImageTransform(c, "uploads/a.jpg", "")
+		if err != nil {
+			t.Fatalf("%s: %v", tt.query, err)
+		}
+		if *got != tt.want {
+			t.Errorf("%s = %+v, want %+v", tt.query, *got, tt.want)
+		}
+	}
+}
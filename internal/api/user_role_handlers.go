@@ -0,0 +1,105 @@
+package api
+
+import (
+	"errors"
+	"mywall-api/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
+	"mywall-api/internal/helpers"
+)
+
+type UserRoleRequest struct {
+	RoleID string `json:"role_id" binding:"required,max=20"`
+}
+
+func (s *Server) getUserRoles(c *gin.Context) {
+	id := c.Param("id")
+	var user models.User
+	if err := s.db.First(&user, id).Error; err != nil {
+		helpers.NotFound(c, "User not found")
+		return
+	}
+
+	var roles []models.Role
+	if err := s.db.Joins("JOIN user_roles ON user_roles.role_id = roles.id").
+		Where("user_roles.user_id = ?", user.ID).
+		Find(&roles).Error; err != nil {
+		helpers.InternalServerError(c, "Failed to retrieve user roles")
+		return
+	}
+	helpers.Success(c, "User roles retrieved successfully", roles)
+}
+
+func (s *Server) assignUserRole(c *gin.Context) {
+	assignerID := c.GetUint("user_id")
+	id := c.Param("id")
+	var req UserRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		if validationErrors, ok := err.(validator.ValidationErrors); ok {
+			errorMessages := make(map[string]string)
+			for _, e := range validationErrors {
+				switch e.Field() {
+				case "RoleID":
+					if e.Tag() == "required" {
+						errorMessages["role_id"] = "Role ID is required"
+					}
+				}
+			}
+			helpers.ValidationError(c, "Validation failed", errorMessages)
+			return
+		}
+		helpers.BadRequest(c, "Invalid request data")
+		return
+	}
+
+	var user models.User
+	if err := s.db.First(&user, id).Error; err != nil {
+		helpers.NotFound(c, "User not found")
+		return
+	}
+
+	var role models.Role
+	if err := s.db.Where("id = ?", req.RoleID).First(&role).Error; err != nil {
+		helpers.NotFound(c, "Invalid role")
+		return
+	}
+
+	var existing models.UserRole
+	err := s.db.Where("user_id = ? AND role_id = ?", user.ID, role.ID).First(&existing).Error
+	if err == nil {
+		helpers.BadRequest(c, "Role already assigned")
+		return
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		helpers.InternalServerError(c, "Database error")
+		return
+	}
+
+	userRole := models.UserRole{
+		UserID:     user.ID,
+		RoleID:     role.ID,
+		AssignedBy: assignerID,
+	}
+	if err := s.db.Create(&userRole).Error; err != nil {
+		helpers.InternalServerError(c, "Failed to assign role")
+		return
+	}
+	helpers.Created(c, "Role assigned successfully", userRole)
+}
+
+func (s *Server) revokeUserRole(c *gin.Context) {
+	id := c.Param("id")
+	roleID := c.Param("role_id")
+	var userRole models.UserRole
+	if err := s.db.Where("user_id = ? AND role_id = ?", id, roleID).First(&userRole).Error; err != nil {
+		helpers.NotFound(c, "Role not assigned to user")
+		return
+	}
+	if err := s.db.Where("user_id = ? AND role_id = ?", userRole.UserID, userRole.RoleID).Delete(&models.UserRole{}).Error; err != nil {
+		helpers.InternalServerError(c, "Failed to revoke role")
+		return
+	}
+	helpers.Success(c, "Role revoked", userRole)
+}
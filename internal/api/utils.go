@@ -2,117 +2,85 @@
 package api
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"image"
 	"image/jpeg"
 	"image/png"
 	_ "image/gif"
-	"io"
 	"mime/multipart"
-	"os"
 	"path/filepath"
 	"strings"
 	"time"
 
+	"github.com/HugoSmits86/nativewebp"
 	"github.com/disintegration/imaging"
 	"github.com/google/uuid"
+	"mywall-api/internal/storage"
 )
 
-// Helper function to save uploaded file with structured path /2025/06/05/filename.jpg
-func SaveUploadedFile(file multipart.File, header *multipart.FileHeader) (string, error) {
-	// Get current date for directory structure
-	now := time.Now()
-	dateDir := fmt.Sprintf("/%d/%02d/%02d", now.Year(), now.Month(), now.Day())
-	
-	// Create base upload directory
-	baseDir := "uploads" // You can configure this path
-	fullDir := filepath.Join(baseDir, dateDir)
-	
-	// Create directory if it doesn't exist
-	if err := os.MkdirAll(fullDir, 0755); err != nil {
-		return "", fmt.Errorf("failed to create directory: %v", err)
-	}
-	
+// Helper function to save uploaded file with structured key uploads/2025/06/05/filename.jpg
+func SaveUploadedFile(ctx context.Context, store storage.Storage, file multipart.File, header *multipart.FileHeader) (string, error) {
 	// Generate unique filename to avoid conflicts
 	ext := strings.ToLower(filepath.Ext(header.Filename))
 	uniqueFilename := fmt.Sprintf("%s%s", uuid.New().String(), ext)
-	
-	// Full file path
-	filePath := filepath.Join(fullDir, uniqueFilename)
-	
-	// Create the file
-	dst, err := os.Create(filePath)
-	if err != nil {
-		return "", fmt.Errorf("failed to create file: %v", err)
-	}
-	defer dst.Close()
-	
-	// Copy uploaded file to destination
-	if _, err := io.Copy(dst, file); err != nil {
-		// Clean up on error
-		os.Remove(filePath)
+	key := storage.DateKey(time.Now(), uniqueFilename)
+
+	// Copy uploaded file to storage
+	if err := store.Save(ctx, key, file, header.Size, header.Header.Get("Content-Type")); err != nil {
 		return "", fmt.Errorf("failed to save file: %v", err)
 	}
-	
-	return filePath, nil
+
+	return key, nil
 }
 
 // SaveAndOptimizeImage saves and optimizes the uploaded image with compression and resize
-func SaveAndOptimizeImage(file multipart.File, header *multipart.FileHeader) (string, error) {
+// to fit within maxSize x maxSize
+func SaveAndOptimizeImage(ctx context.Context, store storage.Storage, upload *SanitizedImage, maxSize int) (string, error) {
 	// Decode the image
-	img, format, err := image.Decode(file)
+	img, format, err := image.Decode(bytes.NewReader(upload.Data))
 	if err != nil {
 		return "", fmt.Errorf("failed to decode image: %w", err)
 	}
 
-	// Resize image to maximum dimensions (800x800) while maintaining aspect ratio
-	maxWidth := 50
-	maxHeight := 50
-	img = resizeImage(img, maxWidth, maxHeight)
-
-	// Get current date for directory structure
-	now := time.Now()
-	dateDir := fmt.Sprintf("/%d/%02d/%02d", now.Year(), now.Month(), now.Day())
-	
-	// Create base upload directory
-	baseDir := "uploads"
-	fullDir := filepath.Join(baseDir, dateDir)
-	
-	// Create directory if it doesn't exist
-	if err := os.MkdirAll(fullDir, 0755); err != nil {
-		return "", fmt.Errorf("failed to create directory: %w", err)
-	}
-
-	// Generate unique filename
-	ext := strings.ToLower(filepath.Ext(header.Filename))
-	uniqueFilename := fmt.Sprintf("%s%s", uuid.New().String(), ext)
-	filePath := filepath.Join(fullDir, uniqueFilename)
-	
-	// Create output file
-	outFile, err := os.Create(filePath)
-	if err != nil {
-		return "", fmt.Errorf("failed to create file: %w", err)
-	}
-	defer outFile.Close()
+	// Resize image to maximum dimensions while maintaining aspect ratio
+	img = resizeImage(img, maxSize, maxSize)
 
 	// Encode with compression based on format
+	var buf bytes.Buffer
+	contentType := "image/jpeg"
+	ext := upload.Ext
 	switch format {
 	case "jpeg", "jpg":
-		err = jpeg.Encode(outFile, img, &jpeg.Options{Quality: 80})
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 80})
 	case "png":
 		encoder := png.Encoder{CompressionLevel: png.BestCompression}
-		err = encoder.Encode(outFile, img)
+		err = encoder.Encode(&buf, img)
+		contentType = "image/png"
+	case "webp":
+		// Lossless, the only WebP encoding available in pure Go
+		err = nativewebp.Encode(&buf, img, nil)
+		contentType = "image/webp"
 	default:
 		// Default to JPEG for other formats
-		err = jpeg.Encode(outFile, img, &jpeg.Options{Quality: 80})
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 80})
+		ext = ".jpg"
 	}
 
 	if err != nil {
-		os.Remove(filePath) // Clean up on error
 		return "", fmt.Errorf("failed to encode image: %w", err)
 	}
 
-	return filePath, nil
+	// Generate unique filename
+	uniqueFilename := fmt.Sprintf("%s%s", uuid.New().String(), ext)
+	key := storage.DateKey(time.Now(), uniqueFilename)
+
+	if err := store.Save(ctx, key, &buf, int64(buf.Len()), contentType); err != nil {
+		return "", fmt.Errorf("failed to save file: %w", err)
+	}
+
+	return key, nil
 }
 
 // resizeImage resizes an image maintaining aspect ratio
@@ -0,0 +1,457 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"mywall-api/internal/auth"
+	"mywall-api/internal/events"
+	"mywall-api/internal/models"
+)
+
+// WebSocket timeouts, variables so tests can shorten them
+var (
+	wsAuthTimeout = 10 * time.Second // time to send the auth message
+	wsWriteWait   = 10 * time.Second // time allowed to write one message
+	wsPongWait    = 60 * time.Second // time allowed between pongs
+	wsPingPeriod  = wsPongWait * 9 / 10
+)
+
+// WebSocket limits
+const (
+	wsMaxMessageSize = 4096 // largest client message
+	wsSendQueueSize  = 64   // queued messages before a client counts as slow
+
+	eventPublishTimeout = 2 * time.Second
+)
+
+// WebSocketManager tracks authenticated WebSocket and SSE connections per user.
+// Publishing never blocks: each connection has its own bounded queue and writer
+// goroutine, and a connection whose queue is full is evicted.
+type WebSocketManager struct {
+	clients  map[uint]map[*streamClient]bool
+	bus      events.Bus
+	mu       sync.RWMutex
+	closing  bool
+	handlers sync.WaitGroup
+
+	// Replay of missed events, see websocket_replay.go
+	logs        map[uint]*eventLog
+	replayLimit int
+	firstID     uint64 // first event this instance saw
+	lastID      uint64
+	recorded    int
+}
+
+// Message represents a WebSocket message, events carry the ID clients resume from
+type Message struct {
+	ID      uint64      `json:"id,omitempty"`
+	Type    string      `json:"type"`
+	Payload interface{} `json:"payload"`
+}
+
+// wsAuthMessage is the first message of a connection that did not authenticate in the URL
+type wsAuthMessage struct {
+	Type    string `json:"type"`
+	Payload struct {
+		Token       string   `json:"token"`
+		APIKey      string   `json:"api_key"`
+		LastEventID *uint64  `json:"last_event_id"`
+		Topics      []string `json:"topics"`
+	} `json:"payload"`
+}
+
+// wsResume is what a connecting client asks for besides authentication
+type wsResume struct {
+	lastEventID uint64
+	replay      bool // last_event_id was given
+	topics      []string
+}
+
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool {
+		return true // Allow all origins for development
+	},
+}
+
+// NewWebSocketManager creates a WebSocket manager, UseBus connects it to the event bus
+func NewWebSocketManager() *WebSocketManager {
+	return &WebSocketManager{
+		clients:     make(map[uint]map[*streamClient]bool),
+		logs:        make(map[uint]*eventLog),
+		replayLimit: defaultReplayLimit,
+	}
+}
+
+// UseBus routes the Broadcast methods through bus, so events reach the
+// connections of every instance subscribed to it
+func (wm *WebSocketManager) UseBus(bus events.Bus) {
+	bus.Subscribe(wm.publish)
+	wm.mu.Lock()
+	wm.bus = bus
+	wm.mu.Unlock()
+}
+
+// dispatch publishes an event on the bus, delivery happens when the bus hands it back
+func (wm *WebSocketManager) dispatch(event events.Event) {
+	wm.mu.RLock()
+	bus := wm.bus
+	wm.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), eventPublishTimeout)
+	defer cancel()
+	if err := bus.Publish(ctx, event); err != nil {
+		log.Printf("Failed to publish %s event: %v", event.Type, err)
+	}
+}
+
+// register adds a client, it fails once the manager is shutting down.
+// With replay the missed events are queued before any live event.
+func (wm *WebSocketManager) register(client *streamClient, resume wsResume) bool {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	if wm.closing {
+		return false
+	}
+	if wm.clients[client.userID] == nil {
+		wm.clients[client.userID] = make(map[*streamClient]bool)
+	}
+	wm.clients[client.userID][client] = true
+	wm.handlers.Add(1)
+	if resume.replay {
+		wm.replayLocked(client, resume.lastEventID)
+	}
+	return true
+}
+
+// queueSize leaves room for a full replay on top of the live queue
+func (wm *WebSocketManager) queueSize() int {
+	wm.mu.RLock()
+	defer wm.mu.RUnlock()
+	if wm.replayLimit > 0 {
+		return wsSendQueueSize + wm.replayLimit + 2
+	}
+	return wsSendQueueSize
+}
+
+func (wm *WebSocketManager) unregister(client *streamClient) {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	if !wm.clients[client.userID][client] {
+		return
+	}
+	delete(wm.clients[client.userID], client)
+	if len(wm.clients[client.userID]) == 0 {
+		delete(wm.clients, client.userID)
+	}
+	wm.handlers.Done()
+}
+
+// recipientsLocked collects the local connections an event is routed to, callers hold wm.mu
+func (wm *WebSocketManager) recipientsLocked(event events.Event) []*streamClient {
+	seen := make(map[*streamClient]bool)
+	var targets []*streamClient
+	for _, userID := range event.UserIDs {
+		for client := range wm.clients[userID] {
+			if !seen[client] && client.accepts(event) {
+				targets = append(targets, client)
+			}
+			seen[client] = true
+		}
+	}
+	return targets
+}
+
+// publish records an event for replay and queues it on every local recipient
+// without waiting for any of them
+func (wm *WebSocketManager) publish(event events.Event) {
+	wm.mu.Lock()
+	wm.recordLocked(event)
+	targets := wm.recipientsLocked(event)
+	wm.mu.Unlock()
+
+	message := Message{ID: event.ID, Type: event.Type, Payload: event.Payload}
+	for _, client := range targets {
+		if !client.enqueue(message) {
+			log.Printf("Event stream client %s (user %d) too slow, disconnecting", client.remoteAddr, client.userID)
+			client.close(websocket.ClosePolicyViolation, "slow consumer")
+		}
+	}
+}
+
+// Shutdown closes every connection with a going away frame and waits for their
+// handlers to finish or ctx to expire. New connections are refused from then on.
+func (wm *WebSocketManager) Shutdown(ctx context.Context) error {
+	wm.mu.Lock()
+	wm.closing = true
+	var clients []*streamClient
+	for _, conns := range wm.clients {
+		for client := range conns {
+			clients = append(clients, client)
+		}
+	}
+	wm.mu.Unlock()
+
+	for _, client := range clients {
+		client.close(websocket.CloseGoingAway, "server shutting down")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wm.handlers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// WebSocket handler
+func (s *Server) handleWebSocket(c *gin.Context) {
+	resume, err := wsResumeParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Credentials in the URL or headers are checked before upgrading
+	token, apiKey := wsCredentials(c)
+	var user *models.User
+	var scopes []string
+	if token != "" || apiKey != "" {
+		user, scopes, err = s.authenticateWebSocket(token, apiKey)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization token or API key"})
+			return
+		}
+	}
+
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Printf("WebSocket upgrade error: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	// Limits hold from the first frame on, an unauthenticated client gets
+	// wsAuthTimeout and wsMaxMessageSize like everyone else
+	conn.SetReadLimit(wsMaxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(wsAuthTimeout))
+
+	// Otherwise the first message must carry them
+	if user == nil {
+		user, scopes, err = s.readWebSocketAuth(conn, &resume)
+		if err != nil {
+			conn.WriteJSON(Message{Type: "error", Payload: "Invalid authorization token or API key"})
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "unauthorized"),
+				time.Now().Add(time.Second))
+			return
+		}
+	}
+
+	client := newStreamClient(conn, conn.RemoteAddr().String(), user.ID, scopes, s.ws.queueSize())
+	// Topics asked for up front are part of the replay
+	for _, topic := range resume.topics {
+		if s.authorizeTopic(client, topic) == nil {
+			client.subscribe(topic)
+		}
+	}
+
+	// Send welcome message, it precedes any replayed event
+	client.enqueue(Message{
+		Type:    "connected",
+		Payload: map[string]interface{}{"user_id": user.ID, "topics": client.topicList()},
+	})
+
+	if !s.ws.register(client, resume) {
+		conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"),
+			time.Now().Add(time.Second))
+		return
+	}
+	defer s.ws.unregister(client)
+	defer client.close(websocket.CloseNormalClosure, "")
+
+	// All writes go through the writer goroutine from here on
+	go client.writePump()
+
+	log.Printf("WebSocket client connected: %s (user %d)", conn.RemoteAddr(), user.ID)
+
+	// Every pong from the client extends the read deadline
+	conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	for {
+		var msg Message
+		err := conn.ReadJSON(&msg)
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.Printf("WebSocket read error: %v", err)
+			}
+			break
+		}
+		conn.SetReadDeadline(time.Now().Add(wsPongWait))
+
+		// Handle different message types from client
+		switch msg.Type {
+		case "subscribe", "unsubscribe":
+			client.enqueue(s.handleSubscription(client, msg.Type, payloadString(msg.Payload, "topic")))
+		case "join_galleries":
+			// Kept for older clients, same as subscribing to the galleries topic
+			client.enqueue(s.handleSubscription(client, "subscribe", TopicGalleries))
+		case "ping":
+			// Respond to ping
+			client.enqueue(Message{Type: "pong", Payload: "pong"})
+		}
+	}
+}
+
+// wsCredentials reads a JWT or API key from the query string or the usual headers.
+// Browsers cannot set headers on a WebSocket handshake, hence the query params,
+// which the access log redacts.
+func wsCredentials(c *gin.Context) (string, string) {
+	token := c.Query("token")
+	if header := c.GetHeader("Authorization"); token == "" && strings.HasPrefix(header, "Bearer ") {
+		token = strings.TrimPrefix(header, "Bearer ")
+	}
+	apiKey := c.Query("api_key")
+	if apiKey == "" {
+		apiKey = c.GetHeader("X-API-Key")
+	}
+	return token, apiKey
+}
+
+// wsResumeParams reads the last_event_id and comma separated topics query params
+func wsResumeParams(c *gin.Context) (wsResume, error) {
+	var resume wsResume
+	if raw := c.Query("last_event_id"); raw != "" {
+		id, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			return resume, errors.New("invalid last_event_id")
+		}
+		resume.lastEventID = id
+		resume.replay = true
+	}
+	for _, topic := range strings.Split(c.Query("topics"), ",") {
+		if topic = strings.TrimSpace(topic); topic != "" {
+			resume.topics = append(resume.topics, topic)
+		}
+	}
+	return resume, nil
+}
+
+// readWebSocketAuth waits for an auth message like {"type":"auth","payload":{"token":"..."}},
+// its last_event_id and topics override the query params. The read deadline set after
+// the upgrade bounds the wait.
+func (s *Server) readWebSocketAuth(conn *websocket.Conn, resume *wsResume) (*models.User, []string, error) {
+	var msg wsAuthMessage
+	if err := conn.ReadJSON(&msg); err != nil {
+		return nil, nil, err
+	}
+	if msg.Type != "auth" {
+		return nil, nil, auth.ErrUnauthorized
+	}
+	if msg.Payload.LastEventID != nil {
+		resume.lastEventID = *msg.Payload.LastEventID
+		resume.replay = true
+	}
+	if msg.Payload.Topics != nil {
+		resume.topics = msg.Payload.Topics
+	}
+	return s.authenticateWebSocket(msg.Payload.Token, msg.Payload.APIKey)
+}
+
+// authenticateWebSocket validates a JWT or API key, API keys also return their scopes
+func (s *Server) authenticateWebSocket(token, apiKey string) (*models.User, []string, error) {
+	if token != "" {
+		user, err := s.auth.ValidateJWT(token)
+		if err == nil || apiKey == "" {
+			return user, nil, err
+		}
+	}
+	if apiKey == "" {
+		return nil, nil, auth.ErrUnauthorized
+	}
+	user, key, err := s.auth.ValidateAPIKey(apiKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	scopes := key.ScopeList()
+	if scopes == nil {
+		scopes = []string{}
+	}
+	return user, scopes, nil
+}
+
+// Helper functions untuk broadcast
+func (wm *WebSocketManager) BroadcastNewGallery(gallery models.Gallery, payload map[string]interface{}) {
+	wm.dispatch(events.Event{
+		Type:     "new_gallery",
+		Payload:  payload,
+		Resource: "galleries",
+		UserIDs:  []uint{gallery.UserID},
+		Topics:   galleryTopics(gallery.ID, gallery.CategoryID),
+	})
+	log.Printf("Broadcasted new gallery: %v", payload["title"])
+}
+
+// BroadcastUpdateGallery also reaches subscribers of the previous category when the gallery moved
+func (wm *WebSocketManager) BroadcastUpdateGallery(gallery models.Gallery, previousCategoryID uint, payload map[string]interface{}) {
+	wm.dispatch(events.Event{
+		Type:     "update_gallery",
+		Payload:  payload,
+		Resource: "galleries",
+		UserIDs:  []uint{gallery.UserID},
+		Topics:   galleryTopics(gallery.ID, gallery.CategoryID, previousCategoryID),
+	})
+	log.Printf("Broadcasted updated gallery: %v", payload["title"])
+}
+
+func (wm *WebSocketManager) BroadcastDeleteGallery(gallery models.Gallery) {
+	wm.dispatch(events.Event{
+		Type:     "delete_gallery",
+		Payload:  map[string]string{"id": strconv.FormatUint(uint64(gallery.ID), 10)},
+		Resource: "galleries",
+		UserIDs:  []uint{gallery.UserID},
+		Topics:   galleryTopics(gallery.ID, gallery.CategoryID),
+	})
+	log.Printf("Broadcasted deleted gallery ID: %d", gallery.ID)
+}
+
+// BroadcastNotification delivers a notification to its recipient's connections only
+func (wm *WebSocketManager) BroadcastNotification(userID uint, notification map[string]interface{}) {
+	wm.dispatch(events.Event{
+		Type:     "notification",
+		Payload:  notification,
+		Resource: "notifications",
+		UserIDs:  []uint{userID},
+		Topics:   []string{TopicNotifications},
+	})
+	log.Printf("Broadcasted notification: %v", notification["title"])
+}
+
+// BroadcastBadgeUpdate delivers the unread count to the user's connections only
+func (wm *WebSocketManager) BroadcastBadgeUpdate(userID uint, unreadCount int64) {
+	wm.dispatch(events.Event{
+		Type:     "badge_update",
+		Payload:  map[string]interface{}{"user_id": userID, "unread": unreadCount},
+		Resource: "notifications",
+		UserIDs:  []uint{userID},
+		Topics:   []string{TopicNotifications},
+	})
+	log.Printf("Broadcasted badge update for user %d: %d unread", userID, unreadCount)
+}
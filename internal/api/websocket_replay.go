@@ -0,0 +1,109 @@
+package api
+
+import (
+	"time"
+
+	"mywall-api/internal/events"
+)
+
+const (
+	// defaultReplayLimit is the number of events kept per user for reconnecting clients
+	defaultReplayLimit = 100
+	// eventLogIdleTTL drops the log of a user who received nothing for this long
+	eventLogIdleTTL = 24 * time.Hour
+	// eventLogSweepEvery is how many events pass between sweeps of idle logs
+	eventLogSweepEvery = 1000
+)
+
+// eventLog keeps the latest events of one user, oldest first
+type eventLog struct {
+	events    []events.Event
+	droppedID uint64 // newest event that no longer fits in the log
+	updatedAt time.Time
+}
+
+func (l *eventLog) append(event events.Event, limit int) {
+	l.events = append(l.events, event)
+	if over := len(l.events) - limit; over > 0 {
+		l.droppedID = l.events[over-1].ID
+		copy(l.events, l.events[over:])
+		l.events = l.events[:limit]
+	}
+	l.updatedAt = time.Now()
+}
+
+// SetReplayLimit sets how many events are kept per user, 0 or less disables replay
+func (wm *WebSocketManager) SetReplayLimit(limit int) {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	wm.replayLimit = limit
+	if limit <= 0 {
+		wm.logs = make(map[uint]*eventLog)
+	}
+}
+
+// recordLocked appends an event to the log of each recipient, callers hold wm.mu
+func (wm *WebSocketManager) recordLocked(event events.Event) {
+	if wm.firstID == 0 {
+		wm.firstID = event.ID
+	}
+	wm.lastID = event.ID
+	if wm.replayLimit <= 0 {
+		return
+	}
+
+	for _, userID := range event.UserIDs {
+		l := wm.logs[userID]
+		if l == nil {
+			l = &eventLog{}
+			wm.logs[userID] = l
+		}
+		l.append(event, wm.replayLimit)
+	}
+
+	wm.recorded++
+	if wm.recorded%eventLogSweepEvery == 0 {
+		cutoff := time.Now().Add(-eventLogIdleTTL)
+		for userID, l := range wm.logs {
+			if l.updatedAt.Before(cutoff) {
+				delete(wm.logs, userID)
+			}
+		}
+	}
+}
+
+// replayLocked queues the events a reconnecting client missed after lastEventID,
+// followed by replay_complete. When the log cannot cover the gap, for example
+// after a restart or because too many events passed, replay_truncated comes
+// first so the client knows to reload over the REST API. Callers hold wm.mu.
+func (wm *WebSocketManager) replayLocked(client *streamClient, lastEventID uint64) {
+	l := wm.logs[client.userID]
+	truncated := wm.replayLimit <= 0 ||
+		lastEventID > wm.lastID ||
+		lastEventID+1 < wm.firstID ||
+		(l != nil && lastEventID < l.droppedID)
+	if wm.firstID == 0 && lastEventID > 0 {
+		// Nothing seen since this instance started
+		truncated = true
+	}
+	if truncated {
+		client.enqueue(Message{
+			Type:    "replay_truncated",
+			Payload: map[string]interface{}{"last_event_id": lastEventID},
+		})
+	}
+
+	replayed := 0
+	if l != nil {
+		for _, event := range l.events {
+			if event.ID > lastEventID && client.accepts(event) {
+				client.enqueue(Message{ID: event.ID, Type: event.Type, Payload: event.Payload})
+				replayed++
+			}
+		}
+	}
+	client.enqueue(Message{
+		Type:    "replay_complete",
+		Payload: map[string]interface{}{"replayed": replayed, "last_event_id": wm.lastID},
+	})
+}
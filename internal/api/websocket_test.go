@@ -0,0 +1,288 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"mywall-api/internal/events"
+)
+
+// newWSTestServer serves a testServer's router on a real listener
+func newWSTestServer(t *testing.T) (*testServer, *httptest.Server) {
+	t.Helper()
+	ts := newTestServer(t)
+	srv := httptest.NewServer(ts.router)
+	t.Cleanup(srv.Close)
+	// Runs before srv.Close, which waits for the WebSocket handlers
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		ts.ws.Shutdown(ctx)
+	})
+	return ts, srv
+}
+
+// shortenWSTimeouts lowers the WebSocket timeouts for the rest of the test
+func shortenWSTimeouts(t *testing.T, auth, pong time.Duration) {
+	t.Helper()
+	prevAuth, prevPong, prevPing := wsAuthTimeout, wsPongWait, wsPingPeriod
+	wsAuthTimeout, wsPongWait, wsPingPeriod = auth, pong, pong*9/10
+	t.Cleanup(func() {
+		wsAuthTimeout, wsPongWait, wsPingPeriod = prevAuth, prevPong, prevPing
+	})
+}
+
+func dialWS(t *testing.T, srv *httptest.Server, query string) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws"+query, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// readWS reads the next message, failing the test if none arrives in time
+func readWS(t *testing.T, conn *websocket.Conn) Message {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var msg Message
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	return msg
+}
+
+// readUntilClosed reads until the server ends the connection and returns the close error
+func readUntilClosed(t *testing.T, conn *websocket.Conn, within time.Duration) ([]Message, error) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(within))
+	var messages []Message
+	for {
+		var msg Message
+		if err := conn.ReadJSON(&msg); err != nil {
+			var netErr interface{ Timeout() bool }
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				t.Fatalf("connection still open after %s", within)
+			}
+			return messages, err
+		}
+		messages = append(messages, msg)
+	}
+}
+
+func TestWebSocketDeliversToOwnConnectionsOnly(t *testing.T) {
+	ts, srv := newWSTestServer(t)
+	aliceID, aliceToken := ts.login(t, "alice@example.com", false)
+	bobID, bobToken := ts.login(t, "bob@example.com", false)
+
+	var alice []*websocket.Conn
+	for i := 0; i < 3; i++ {
+		conn := dialWS(t, srv, "?token="+aliceToken)
+		if msg := readWS(t, conn); msg.Type != "connected" {
+			t.Fatalf("first message = %+v", msg)
+		}
+		alice = append(alice, conn)
+	}
+	bob := dialWS(t, srv, "?token="+bobToken)
+	readWS(t, bob)
+
+	ts.ws.BroadcastNotification(aliceID, map[string]interface{}{"title": "for alice"})
+	ts.ws.BroadcastNotification(bobID, map[string]interface{}{"title": "for bob"})
+
+	for i, conn := range alice {
+		msg := readWS(t, conn)
+		if msg.Type != "notification" || msg.Payload.(map[string]interface{})["title"] != "for alice" {
+			t.Fatalf("alice connection %d got %+v", i, msg)
+		}
+	}
+	// Bob's first event is his own, alice's never reached him
+	if msg := readWS(t, bob); msg.Payload.(map[string]interface{})["title"] != "for bob" {
+		t.Fatalf("bob got %+v", msg)
+	}
+}
+
+func TestWebSocketQueueKeepsOrder(t *testing.T) {
+	ts, srv := newWSTestServer(t)
+	userID, token := ts.login(t, "alice@example.com", false)
+	conn := dialWS(t, srv, "?token="+token)
+	readWS(t, conn)
+
+	const count = wsSendQueueSize
+	for i := 0; i < count; i++ {
+		ts.ws.BroadcastBadgeUpdate(userID, int64(i))
+	}
+	var lastID uint64
+	for i := 0; i < count; i++ {
+		msg := readWS(t, conn)
+		unread := msg.Payload.(map[string]interface{})["unread"].(float64)
+		if msg.Type != "badge_update" || int(unread) != i || msg.ID <= lastID {
+			t.Fatalf("message %d = %+v after id %d", i, msg, lastID)
+		}
+		lastID = msg.ID
+	}
+}
+
+func TestWebSocketEvictsSlowConsumer(t *testing.T) {
+	wm := NewWebSocketManager()
+	wm.UseBus(events.NewMemoryBus())
+	wm.SetReplayLimit(0)
+
+	// Neither client has a writer, the test drains fast's queue and never slow's
+	slow := newStreamClient(nil, "slow", 1, nil, wm.queueSize())
+	fast := newStreamClient(nil, "fast", 1, nil, wm.queueSize())
+	wm.register(slow, wsResume{})
+	wm.register(fast, wsResume{})
+	defer wm.unregister(slow)
+	defer wm.unregister(fast)
+
+	const count = wsSendQueueSize + 10
+	for i := 0; i < count; i++ {
+		wm.BroadcastBadgeUpdate(1, int64(i))
+		select {
+		case <-fast.send:
+		default:
+			t.Fatalf("fast consumer missed message %d", i)
+		}
+	}
+
+	select {
+	case <-slow.done:
+	default:
+		t.Fatal("slow consumer was not evicted")
+	}
+	if slow.closeCode != websocket.ClosePolicyViolation {
+		t.Fatalf("slow consumer closed with %d", slow.closeCode)
+	}
+	select {
+	case <-fast.done:
+		t.Fatal("fast consumer was evicted")
+	default:
+	}
+}
+
+func TestWebSocketPongKeepsConnectionOpen(t *testing.T) {
+	shortenWSTimeouts(t, time.Second, 300*time.Millisecond)
+	ts, srv := newWSTestServer(t)
+	_, token := ts.login(t, "alice@example.com", false)
+	conn := dialWS(t, srv, "?token="+token)
+	readWS(t, conn)
+
+	// The client answers pings while it reads, so it outlives several pong waits
+	messages := make(chan Message)
+	go func() {
+		defer close(messages)
+		for {
+			var msg Message
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			messages <- msg
+		}
+	}()
+	time.Sleep(time.Second)
+
+	if err := conn.WriteJSON(Message{Type: "ping"}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	select {
+	case msg, ok := <-messages:
+		if !ok || msg.Type != "pong" {
+			t.Fatalf("got %+v, open %v", msg, ok)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no pong")
+	}
+}
+
+func TestWebSocketMissingPongClosesConnection(t *testing.T) {
+	shortenWSTimeouts(t, time.Second, 300*time.Millisecond)
+	ts, srv := newWSTestServer(t)
+	_, token := ts.login(t, "alice@example.com", false)
+	conn := dialWS(t, srv, "?token="+token)
+	conn.SetPingHandler(func(string) error { return nil })
+	readWS(t, conn)
+
+	if _, err := readUntilClosed(t, conn, 2*time.Second); err == nil {
+		t.Fatal("connection without pongs stayed open")
+	}
+}
+
+func TestWebSocketFirstMessageAuth(t *testing.T) {
+	ts, srv := newWSTestServer(t)
+	userID, token := ts.login(t, "alice@example.com", false)
+	conn := dialWS(t, srv, "")
+
+	if err := conn.WriteJSON(map[string]interface{}{"type": "auth", "payload": map[string]string{"token": token}}); err != nil {
+		t.Fatal(err)
+	}
+	msg := readWS(t, conn)
+	if msg.Type != "connected" || msg.Payload.(map[string]interface{})["user_id"].(float64) != float64(userID) {
+		t.Fatalf("got %+v", msg)
+	}
+}
+
+func TestWebSocketAuthTimeout(t *testing.T) {
+	shortenWSTimeouts(t, 200*time.Millisecond, time.Minute)
+	_, srv := newWSTestServer(t)
+	conn := dialWS(t, srv, "")
+
+	messages, err := readUntilClosed(t, conn, 2*time.Second)
+	if len(messages) != 1 || messages[0].Type != "error" || !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+		t.Fatalf("got %+v, %v", messages, err)
+	}
+}
+
+func TestWebSocketReadLimitAppliesBeforeAuth(t *testing.T) {
+	ts, srv := newWSTestServer(t)
+	_, token := ts.login(t, "alice@example.com", false)
+	conn := dialWS(t, srv, "")
+
+	// A valid auth message padded past wsMaxMessageSize
+	if err := conn.WriteJSON(map[string]interface{}{
+		"type":    "auth",
+		"payload": map[string]string{"token": token, "padding": strings.Repeat("x", 2*wsMaxMessageSize)},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	messages, _ := readUntilClosed(t, conn, 2*time.Second)
+	for _, msg := range messages {
+		if msg.Type == "connected" {
+			t.Fatal("oversized auth message was accepted")
+		}
+	}
+}
+
+func TestWebSocketShutdown(t *testing.T) {
+	ts, srv := newWSTestServer(t)
+	_, token := ts.login(t, "alice@example.com", false)
+
+	var conns []*websocket.Conn
+	for i := 0; i < 3; i++ {
+		conn := dialWS(t, srv, "?token="+token)
+		readWS(t, conn)
+		conns = append(conns, conn)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := ts.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	for i, conn := range conns {
+		if _, err := readUntilClosed(t, conn, 2*time.Second); !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+			t.Fatalf("connection %d closed with %v", i, err)
+		}
+	}
+
+	// Connections after shutdown are turned away
+	late := dialWS(t, srv, "?token="+token)
+	if _, err := readUntilClosed(t, late, 2*time.Second); !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Fatalf("late connection closed with %v", err)
+	}
+}
@@ -0,0 +1,162 @@
+package api
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+
+	"mywall-api/internal/auth"
+	"mywall-api/internal/models"
+)
+
+// WebSocket topics. Galleries and categories belong to a single user, so every
+// topic is scoped to the subscriber's own data.
+const (
+	TopicNotifications = "notifications" // the user's notification feed and unread badge
+	TopicGalleries     = "galleries"     // every gallery of the user
+	topicCategory      = "category"      // category:<id>, galleries in one category
+	topicGallery       = "gallery"       // gallery:<id>, a single gallery
+)
+
+// Subscription errors, sent back in the ack
+var (
+	ErrInvalidTopic = errors.New("invalid topic")
+	ErrTopicDenied  = errors.New("topic not found")
+)
+
+// defaultTopics are subscribed on connect
+func defaultTopics() map[string]bool {
+	return map[string]bool{TopicNotifications: true}
+}
+
+// galleryTopics lists the topics a gallery event is published to
+func galleryTopics(galleryID uint, categoryIDs ...uint) []string {
+	topics := []string{TopicGalleries, topicGallery + ":" + strconv.FormatUint(uint64(galleryID), 10)}
+	for _, categoryID := range categoryIDs {
+		topic := topicCategory + ":" + strconv.FormatUint(uint64(categoryID), 10)
+		if categoryID != 0 && !containsString(topics, topic) {
+			topics = append(topics, topic)
+		}
+	}
+	return topics
+}
+
+// parseTopic splits "category:12" into its kind and ID, plain topics have ID 0
+func parseTopic(topic string) (string, uint, error) {
+	switch topic {
+	case TopicNotifications, TopicGalleries:
+		return topic, 0, nil
+	}
+	kind, rawID, ok := strings.Cut(topic, ":")
+	if !ok || (kind != topicCategory && kind != topicGallery) {
+		return "", 0, ErrInvalidTopic
+	}
+	id, err := strconv.ParseUint(rawID, 10, 32)
+	if err != nil || id == 0 {
+		return "", 0, ErrInvalidTopic
+	}
+	return kind, uint(id), nil
+}
+
+// authorizeTopic checks the subscriber owns the category or gallery behind a topic
+func (s *Server) authorizeTopic(client *streamClient, topic string) error {
+	kind, id, err := parseTopic(topic)
+	if err != nil {
+		return err
+	}
+
+	resource := "galleries"
+	var count int64
+	switch kind {
+	case TopicNotifications:
+		resource = "notifications"
+	case topicCategory:
+		err = s.db.Model(&models.Category{}).Where("id = ? AND user_id = ?", id, client.userID).Count(&count).Error
+	case topicGallery:
+		err = s.db.Model(&models.Gallery{}).Where("id = ? AND user_id = ?", id, client.userID).Count(&count).Error
+	}
+	if err != nil {
+		return err
+	}
+	if (kind == topicCategory || kind == topicGallery) && count == 0 {
+		return ErrTopicDenied
+	}
+	if client.scopes != nil && !auth.HasScope(client.scopes, resource, "read") {
+		return ErrTopicDenied
+	}
+	return nil
+}
+
+// handleSubscription applies a subscribe or unsubscribe request and builds its ack
+func (s *Server) handleSubscription(client *streamClient, action, topic string) Message {
+	ack := map[string]interface{}{
+		"action": action,
+		"topic":  topic,
+		"ok":     true,
+	}
+
+	var err error
+	if action == "subscribe" {
+		if err = s.authorizeTopic(client, topic); err == nil {
+			client.subscribe(topic)
+		}
+	} else if _, _, err = parseTopic(topic); err == nil {
+		client.unsubscribe(topic)
+	}
+
+	if err != nil {
+		ack["ok"] = false
+		if errors.Is(err, ErrInvalidTopic) || errors.Is(err, ErrTopicDenied) {
+			ack["error"] = err.Error()
+		} else {
+			ack["error"] = "failed to subscribe"
+		}
+	}
+	ack["topics"] = client.topicList()
+	return Message{Type: "ack", Payload: ack}
+}
+
+func (c *streamClient) subscribe(topic string) {
+	c.mu.Lock()
+	c.topics[topic] = true
+	c.mu.Unlock()
+}
+
+func (c *streamClient) unsubscribe(topic string) {
+	c.mu.Lock()
+	delete(c.topics, topic)
+	c.mu.Unlock()
+}
+
+func (c *streamClient) subscribedToAny(topics []string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, topic := range topics {
+		if c.topics[topic] {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *streamClient) topicList() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	topics := make([]string, 0, len(c.topics))
+	for topic := range c.topics {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+// payloadString reads a string field from a decoded JSON object payload
+func payloadString(payload interface{}, field string) string {
+	fields, ok := payload.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	value, _ := fields[field].(string)
+	return value
+}
@@ -2,18 +2,43 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
+	"errors"
+	"fmt"
 	"mywall-api/internal/models"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
 	"gorm.io/gorm"
 )
 
+// FullAccessScope grants every scope
+const FullAccessScope = "*"
+
+// Scope verbs, read covers reading and searching, write everything else
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+)
+
+// scopeResource matches the resource of a scope, a route segment such as api-keys
+var scopeResource = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+// lastUsedResolution limits how often last_used_at is written
+const lastUsedResolution = time.Minute
+
 type APIKeyService struct {
-	keyLength int
+	keyLength    int
+	prefixLength int
 }
 
 func NewAPIKeyService(keyLength int) *APIKeyService {
 	return &APIKeyService{
-		keyLength: keyLength,
+		keyLength:    keyLength,
+		prefixLength: 8,
 	}
 }
 
@@ -25,10 +50,109 @@ func (a *APIKeyService) GenerateAPIKey() (string, error) {
 	return hex.EncodeToString(bytes), nil
 }
 
-func (a *APIKeyService) ValidateAPIKey(db *gorm.DB, apiKey string) (*models.User, error) {
+func hashAPIKey(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAPIKey stores a new key for the user and returns its plaintext, which is never stored
+func (a *APIKeyService) CreateAPIKey(db *gorm.DB, userID uint, name string, scopes []string, expiresAt *time.Time) (string, *models.ApiKey, error) {
+	apiKey, err := a.GenerateAPIKey()
+	if err != nil {
+		return "", nil, err
+	}
+	if len(scopes) == 0 {
+		scopes = []string{FullAccessScope}
+	}
+	for _, scope := range scopes {
+		if !ValidScope(scope) {
+			return "", nil, fmt.Errorf("%w: %q", ErrInvalidScope, scope)
+		}
+	}
+
+	key := &models.ApiKey{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    apiKey[:a.prefixLength],
+		KeyHash:   hashAPIKey(apiKey),
+		Scopes:    strings.Join(scopes, ","),
+		ExpiresAt: expiresAt,
+		IsActive:  true,
+	}
+	if err := db.Create(key).Error; err != nil {
+		return "", nil, err
+	}
+	return apiKey, key, nil
+}
+
+func (a *APIKeyService) ValidateAPIKey(db *gorm.DB, apiKey string) (*models.User, *models.ApiKey, error) {
+	var key models.ApiKey
+	if err := db.Where("key_hash = ?", hashAPIKey(apiKey)).First(&key).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidAPIKey
+		}
+		return nil, nil, ErrDatabaseError
+	}
+	if !key.IsActive {
+		return nil, nil, ErrInactiveAPIKey
+	}
+	now := time.Now()
+	if key.ExpiresAt != nil && now.After(*key.ExpiresAt) {
+		return nil, nil, ErrExpiredAPIKey
+	}
+
 	var user models.User
-	if err := db.Where("api_key = ? AND is_active = ?", apiKey, true).First(&user).Error; err != nil {
-		return nil, err
+	if err := db.Where("id = ? AND is_active = ?", key.UserID, true).First(&user).Error; err != nil {
+		return nil, nil, ErrInactiveAPIKey
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > lastUsedResolution {
+		db.Model(&key).UpdateColumn("last_used_at", now)
+		key.LastUsedAt = &now
+	}
+	return &user, &key, nil
+}
+
+// HasScope reports whether the scopes grant action on resource, e.g. galleries:read
+func HasScope(scopes []string, resource, action string) bool {
+	for _, scope := range scopes {
+		if scope == FullAccessScope || scope == resource+":*" || scope == resource+":"+action {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidScope reports whether scope is "*" or resource:*, resource:read or resource:write
+func ValidScope(scope string) bool {
+	if scope == FullAccessScope {
+		return true
+	}
+	resource, verb, ok := strings.Cut(scope, ":")
+	if !ok || !scopeResource.MatchString(resource) {
+		return false
+	}
+	return verb == "*" || verb == ScopeRead || verb == ScopeWrite
+}
+
+// ScopesWithin reports whether held grants every one of scopes, so a key
+// cannot create another key with more access than itself
+func ScopesWithin(scopes, held []string) bool {
+	for _, scope := range scopes {
+		resource, verb, _ := strings.Cut(scope, ":")
+		switch {
+		case scope == FullAccessScope:
+			// Only full access grants every resource, including future ones
+			if !slices.Contains(held, FullAccessScope) {
+				return false
+			}
+		case verb == "*":
+			if !HasScope(held, resource, ScopeRead) || !HasScope(held, resource, ScopeWrite) {
+				return false
+			}
+		case !HasScope(held, resource, verb):
+			return false
+		}
 	}
-	return &user, nil
+	return true
 }
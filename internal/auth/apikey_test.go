@@ -0,0 +1,187 @@
+package auth
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"mywall-api/internal/models"
+)
+
+func newAPIKeyTestDB(t *testing.T) (*gorm.DB, *models.User) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	if err := db.AutoMigrate(&models.User{}, &models.ApiKey{}); err != nil {
+		t.Fatal(err)
+	}
+	user := &models.User{Email: "user@example.com", Password: "x", IsActive: true}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return db, user
+}
+
+func TestValidateAPIKey(t *testing.T) {
+	db, user := newAPIKeyTestDB(t)
+	a := NewAPIKeyService(32)
+	apiKey, key, err := a.CreateAPIKey(db, user.ID, "ci", []string{"galleries:read"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.Prefix != apiKey[:8] || key.KeyHash == apiKey || key.KeyHash != hashAPIKey(apiKey) {
+		t.Fatalf("stored prefix %q hash %q", key.Prefix, key.KeyHash)
+	}
+
+	got, gotKey, err := a.ValidateAPIKey(db, apiKey)
+	if err != nil {
+		t.Fatalf("ValidateAPIKey: %v", err)
+	}
+	if got.ID != user.ID || gotKey.ID != key.ID {
+		t.Fatalf("ValidateAPIKey = user %d key %d", got.ID, gotKey.ID)
+	}
+	var stored models.ApiKey
+	db.First(&stored, key.ID)
+	if stored.LastUsedAt == nil {
+		t.Fatal("last_used_at not set")
+	}
+
+	if _, _, err := a.ValidateAPIKey(db, apiKey+"0"); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Fatalf("unknown key: %v", err)
+	}
+}
+
+func TestValidateAPIKeyRejected(t *testing.T) {
+	db, user := newAPIKeyTestDB(t)
+	a := NewAPIKeyService(32)
+	past := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name    string
+		prepare func(key *models.ApiKey)
+		want    error
+	}{
+		{"inactive key", func(key *models.ApiKey) {
+			db.Model(key).Update("is_active", false)
+		}, ErrInactiveAPIKey},
+		{"expired key", func(key *models.ApiKey) {
+			db.Model(key).Update("expires_at", past)
+		}, ErrExpiredAPIKey},
+		{"inactive user", func(key *models.ApiKey) {
+			db.Model(user).Update("is_active", false)
+			t.Cleanup(func() { db.Model(user).Update("is_active", true) })
+		}, ErrInactiveAPIKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			apiKey, key, err := a.CreateAPIKey(db, user.ID, tt.name, nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.prepare(key)
+			if _, _, err := a.ValidateAPIKey(db, apiKey); !errors.Is(err, tt.want) {
+				t.Fatalf("ValidateAPIKey = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateAPIKeyInvalidScope(t *testing.T) {
+	db, user := newAPIKeyTestDB(t)
+	_, _, err := NewAPIKeyService(32).CreateAPIKey(db, user.ID, "bad", []string{"galleries:read", "galleries:fly"}, nil)
+	if !errors.Is(err, ErrInvalidScope) {
+		t.Fatalf("CreateAPIKey = %v, want ErrInvalidScope", err)
+	}
+	var count int64
+	db.Model(&models.ApiKey{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("%d keys stored", count)
+	}
+}
+
+func TestScopeList(t *testing.T) {
+	for scopes, want := range map[string][]string{
+		"*":                                {"*"},
+		"galleries:read,categories:*":      {"galleries:read", "categories:*"},
+		" galleries:read , ,categories:* ": {"galleries:read", "categories:*"},
+		"":                                 nil,
+	} {
+		if got := (models.ApiKey{Scopes: scopes}).ScopeList(); !reflect.DeepEqual(got, want) {
+			t.Errorf("ScopeList(%q) = %v, want %v", scopes, got, want)
+		}
+	}
+}
+
+func TestHasScope(t *testing.T) {
+	tests := []struct {
+		scopes           []string
+		resource, action string
+		want             bool
+	}{
+		{[]string{"*"}, "galleries", "write", true},
+		{[]string{"galleries:*"}, "galleries", "write", true},
+		{[]string{"galleries:read"}, "galleries", "read", true},
+		{[]string{"galleries:read"}, "galleries", "write", false},
+		{[]string{"galleries:read"}, "categories", "read", false},
+		{[]string{"categories:read", "galleries:write"}, "galleries", "write", true},
+		{[]string{"galleries:*"}, "gallery", "read", false},
+		{[]string{"gall*"}, "galleries", "read", false},
+		{nil, "galleries", "read", false},
+	}
+	for _, tt := range tests {
+		if got := HasScope(tt.scopes, tt.resource, tt.action); got != tt.want {
+			t.Errorf("HasScope(%v, %s, %s) = %v, want %v", tt.scopes, tt.resource, tt.action, got, tt.want)
+		}
+	}
+}
+
+func TestValidScope(t *testing.T) {
+	for scope, want := range map[string]bool{
+		"*":                true,
+		"galleries:*":      true,
+		"galleries:read":   true,
+		"api-keys:write":   true,
+		"galleries:delete": false,
+		"galleries":        false,
+		"galleries:":       false,
+		":read":            false,
+		"*:read":           false,
+		"Galleries:read":   false,
+		"galleries:read ":  false,
+		"":                 false,
+	} {
+		if got := ValidScope(scope); got != want {
+			t.Errorf("ValidScope(%q) = %v, want %v", scope, got, want)
+		}
+	}
+}
+
+func TestScopesWithin(t *testing.T) {
+	tests := []struct {
+		scopes, held []string
+		want         bool
+	}{
+		{[]string{"*"}, []string{"*"}, true},
+		{[]string{"galleries:read"}, []string{"*"}, true},
+		{[]string{"galleries:read"}, []string{"galleries:*"}, true},
+		{[]string{"galleries:*"}, []string{"galleries:read", "galleries:write"}, true},
+		{[]string{"galleries:*"}, []string{"galleries:read"}, false},
+		{[]string{"*"}, []string{"galleries:*", "api-keys:write"}, false},
+		{[]string{"categories:read"}, []string{"galleries:*", "api-keys:write"}, false},
+		{[]string{"galleries:read", "api-keys:write"}, []string{"galleries:read", "api-keys:write"}, true},
+	}
+	for _, tt := range tests {
+		if got := ScopesWithin(tt.scopes, tt.held); got != tt.want {
+			t.Errorf("ScopesWithin(%v, %v) = %v, want %v", tt.scopes, tt.held, got, tt.want)
+		}
+	}
+}
@@ -7,10 +7,13 @@ var (
 	ErrInvalidAPIKey   = errors.New("invalid API key")
 	ErrInactiveAPIKey  = errors.New("API key inactive")
 	ErrExpiredAPIKey   = errors.New("API key expired")
+	ErrInvalidScope    = errors.New("invalid API key scope")
 	ErrInvalidCredentials = errors.New("invalid credentials")
 	ErrDatabaseError   = errors.New("database error")
 	ErrUserExists      = errors.New("username or email already exists")
 	ErrInvalidToken    = errors.New("invalid token")
+	ErrTokenReused     = errors.New("refresh token reused")
+	ErrTokenRevoked    = errors.New("token revoked")
 	ErrForbidden       = errors.New("access forbidden")
 	ErrUnauthorized    = errors.New("unauthorized")
 )
\ No newline at end of file
@@ -9,29 +9,35 @@ import (
 )
 
 type JWTClaims struct {
-	UserID uint   `json:"user_id"`
-	Email  string `json:"email"`
-	Role   string `json:"role"`
+	UserID uint     `json:"user_id"`
+	Email  string   `json:"email"`
+	Role   string   `json:"role"`
+	Roles  []string `json:"roles"`
 	jwt.RegisteredClaims
 }
 
 type JWTService struct {
 	secretKey []byte
+	expiry    time.Duration
 }
 
-func NewJWTService(secretKey string) *JWTService {
+func NewJWTService(secretKey string, expiry time.Duration) *JWTService {
 	return &JWTService{
 		secretKey: []byte(secretKey),
+		expiry:    expiry,
 	}
 }
 
-func (j *JWTService) GenerateToken(user *models.User) (string, error) {
+// GenerateToken signs an access token, sessionID ties it to a refresh token family
+func (j *JWTService) GenerateToken(user *models.User, roles []string, sessionID string) (string, error) {
 	claims := JWTClaims{
 		UserID: user.ID,
 		Email:  user.Email,
 		Role:   user.Role,
+		Roles:  roles,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+			ID:        sessionID,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(j.expiry)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
@@ -43,7 +49,7 @@ func (j *JWTService) GenerateToken(user *models.User) (string, error) {
 func (j *JWTService) ValidateToken(tokenString string) (*JWTClaims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
 		return j.secretKey, nil
-	})
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
 
 	if err != nil {
 		return nil, err
@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"mywall-api/internal/models"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// RefreshTokenService issues and rotates opaque refresh tokens
+type RefreshTokenService struct {
+	tokenLength int
+	ttl         time.Duration
+}
+
+func NewRefreshTokenService(tokenLength int, ttl time.Duration) *RefreshTokenService {
+	return &RefreshTokenService{
+		tokenLength: tokenLength,
+		ttl:         ttl,
+	}
+}
+
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Issue creates a refresh token in the given family, a new family is started when familyID is empty
+func (r *RefreshTokenService) Issue(db *gorm.DB, userID uint, familyID string) (string, *models.RefreshToken, error) {
+	bytes := make([]byte, r.tokenLength)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", nil, err
+	}
+	token := hex.EncodeToString(bytes)
+
+	if familyID == "" {
+		familyID = uuid.New().String()
+	}
+	record := &models.RefreshToken{
+		UserID:    userID,
+		TokenHash: hashRefreshToken(token),
+		FamilyID:  familyID,
+		ExpiresAt: time.Now().Add(r.ttl),
+	}
+	if err := db.Create(record).Error; err != nil {
+		return "", nil, err
+	}
+	return token, record, nil
+}
+
+// Rotate revokes the presented token and issues its successor, a reused token revokes the whole family
+func (r *RefreshTokenService) Rotate(db *gorm.DB, token string) (string, *models.RefreshToken, error) {
+	var newToken string
+	var newRecord *models.RefreshToken
+	var reused bool
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var current models.RefreshToken
+		if err := tx.Where("token_hash = ?", hashRefreshToken(token)).First(&current).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidToken
+			}
+			return err
+		}
+
+		if current.RevokedAt == nil && time.Now().After(current.ExpiresAt) {
+			return ErrInvalidToken
+		}
+
+		// Only the request whose update claims the live token may rotate it,
+		// a concurrent or later use of the same token finds it revoked
+		claim := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND revoked_at IS NULL", current.ID).
+			Updates(map[string]interface{}{"revoked_at": time.Now(), "revoked_reason": models.RevokedRotated})
+		if claim.Error != nil {
+			return claim.Error
+		}
+		if claim.RowsAffected == 0 {
+			if err := tx.First(&current, current.ID).Error; err != nil {
+				return err
+			}
+			// A token revoked by logout or reuse detection is just dead
+			if !current.Rotated() {
+				return ErrTokenRevoked
+			}
+			// A rotated token came back, someone holds a stolen copy
+			reused = true
+			return r.RevokeFamily(tx, current.FamilyID, models.RevokedReuse)
+		}
+
+		var err error
+		newToken, newRecord, err = r.Issue(tx, current.UserID, current.FamilyID)
+		if err != nil {
+			return err
+		}
+		return tx.Model(&current).Update("replaced_by_id", newRecord.ID).Error
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	if reused {
+		return "", nil, ErrTokenReused
+	}
+	return newToken, newRecord, nil
+}
+
+// Revoke revokes the family of the presented token for reason
+func (r *RefreshTokenService) Revoke(db *gorm.DB, token, reason string) error {
+	var current models.RefreshToken
+	if err := db.Where("token_hash = ?", hashRefreshToken(token)).First(&current).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidToken
+		}
+		return err
+	}
+	return r.RevokeFamily(db, current.FamilyID, reason)
+}
+
+// RevokeFamily revokes every live token of a family for reason
+func (r *RefreshTokenService) RevokeFamily(db *gorm.DB, familyID, reason string) error {
+	return db.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Updates(map[string]interface{}{"revoked_at": time.Now(), "revoked_reason": reason}).Error
+}
+
+// FamilyActive reports whether a family still has a live token
+func (r *RefreshTokenService) FamilyActive(db *gorm.DB, familyID string) (bool, error) {
+	var count int64
+	err := db.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL AND expires_at > ?", familyID, time.Now()).
+		Count(&count).Error
+	return count > 0, err
+}
@@ -0,0 +1,173 @@
+package auth
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"mywall-api/internal/models"
+)
+
+func newRefreshTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	if err := db.AutoMigrate(&models.RefreshToken{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func liveTokens(t *testing.T, db *gorm.DB, familyID string) int64 {
+	t.Helper()
+	var count int64
+	db.Model(&models.RefreshToken{}).Where("family_id = ? AND revoked_at IS NULL", familyID).Count(&count)
+	return count
+}
+
+func TestRotateReplacesToken(t *testing.T) {
+	db := newRefreshTestDB(t)
+	r := NewRefreshTokenService(32, time.Hour)
+	token, first, err := r.Issue(db, 1, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next, record, err := r.Rotate(db, token)
+	if err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	if next == token || record.FamilyID != first.FamilyID {
+		t.Fatalf("Rotate returned %q in family %q", next, record.FamilyID)
+	}
+
+	var old models.RefreshToken
+	db.First(&old, first.ID)
+	if old.RevokedAt == nil || old.ReplacedByID == nil || *old.ReplacedByID != record.ID {
+		t.Fatalf("old token = revoked %v, replaced by %v", old.RevokedAt, old.ReplacedByID)
+	}
+	if n := liveTokens(t, db, first.FamilyID); n != 1 {
+		t.Fatalf("%d live tokens, want 1", n)
+	}
+}
+
+func TestRotateReuseRevokesFamily(t *testing.T) {
+	db := newRefreshTestDB(t)
+	r := NewRefreshTokenService(32, time.Hour)
+	token, first, _ := r.Issue(db, 1, "")
+	if _, _, err := r.Rotate(db, token); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := r.Rotate(db, token); !errors.Is(err, ErrTokenReused) {
+		t.Fatalf("second Rotate = %v, want ErrTokenReused", err)
+	}
+	if n := liveTokens(t, db, first.FamilyID); n != 0 {
+		t.Fatalf("%d live tokens after reuse, want 0", n)
+	}
+}
+
+func TestRotateConcurrentUseWinsOnce(t *testing.T) {
+	db := newRefreshTestDB(t)
+	r := NewRefreshTokenService(32, time.Hour)
+	token, first, _ := r.Issue(db, 1, "")
+
+	const attempts = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, attempts)
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, err := r.Rotate(db, token)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	rotated := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			rotated++
+		case !errors.Is(err, ErrTokenReused):
+			t.Errorf("Rotate = %v", err)
+		}
+	}
+	if rotated != 1 {
+		t.Fatalf("%d rotations succeeded, want 1", rotated)
+	}
+	// Every losing attempt counts as reuse, so the family ends up revoked
+	if n := liveTokens(t, db, first.FamilyID); n != 0 {
+		t.Fatalf("%d live tokens, want 0", n)
+	}
+}
+
+func TestRotateExpiredToken(t *testing.T) {
+	db := newRefreshTestDB(t)
+	r := NewRefreshTokenService(32, -time.Minute)
+	token, _, _ := r.Issue(db, 1, "")
+	if _, _, err := r.Rotate(db, token); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("Rotate = %v, want ErrInvalidToken", err)
+	}
+	if _, _, err := r.Rotate(db, "unknown"); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("Rotate unknown = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestRotateAfterLogoutIsNotReuse(t *testing.T) {
+	db := newRefreshTestDB(t)
+	r := NewRefreshTokenService(32, time.Hour)
+	first, _, _ := r.Issue(db, 1, "")
+	live, record, err := r.Rotate(db, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Revoke(db, live, models.RevokedLogout); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := r.Rotate(db, live); !errors.Is(err, ErrTokenRevoked) {
+		t.Fatalf("Rotate after logout = %v, want ErrTokenRevoked", err)
+	}
+	var current models.RefreshToken
+	db.First(&current, record.ID)
+	if current.RevokedReason != models.RevokedLogout {
+		t.Fatalf("revoked_reason = %q, want logout", current.RevokedReason)
+	}
+
+	// The token rotated before logout is still a stolen copy
+	if _, _, err := r.Rotate(db, first); !errors.Is(err, ErrTokenReused) {
+		t.Fatalf("Rotate of a rotated token = %v, want ErrTokenReused", err)
+	}
+}
+
+func TestRotateLegacyRevokedToken(t *testing.T) {
+	db := newRefreshTestDB(t)
+	r := NewRefreshTokenService(32, time.Hour)
+	rotated, _, _ := r.Issue(db, 1, "")
+	if _, _, err := r.Rotate(db, rotated); err != nil {
+		t.Fatal(err)
+	}
+	loggedOut, _, _ := r.Issue(db, 1, "")
+	r.Revoke(db, loggedOut, models.RevokedLogout)
+	// Rows revoked before revoked_reason existed
+	db.Model(&models.RefreshToken{}).Where("1 = 1").Update("revoked_reason", "")
+
+	if _, _, err := r.Rotate(db, loggedOut); !errors.Is(err, ErrTokenRevoked) {
+		t.Fatalf("Rotate of a legacy revoked token = %v, want ErrTokenRevoked", err)
+	}
+	if _, _, err := r.Rotate(db, rotated); !errors.Is(err, ErrTokenReused) {
+		t.Fatalf("Rotate of a legacy rotated token = %v, want ErrTokenReused", err)
+	}
+}
@@ -3,44 +3,54 @@ package auth
 import (
 	"errors"
 	"mywall-api/internal/models"
+	"time"
 
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
+// defaultAPIKeyName labels the key created at registration
+const defaultAPIKeyName = "default"
+
 // Service handles authentication-related operations
 type Service struct {
 	db          *gorm.DB
 	jwtService  *JWTService
 	apiKeyService *APIKeyService
+	refreshService *RefreshTokenService
+	accessExpiry time.Duration
+}
+
+// TokenPair is returned by Login and Refresh
+type TokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
 }
 
 // NewService creates a new auth service
-func NewService(db *gorm.DB, jwtSecret string) *Service {
+func NewService(db *gorm.DB, jwtSecret string, accessExpiry, refreshExpiry time.Duration) *Service {
 	return &Service{
 		db:          db,
-		jwtService:  NewJWTService(jwtSecret),
+		jwtService:  NewJWTService(jwtSecret, accessExpiry),
 		apiKeyService: NewAPIKeyService(32), // 32 bytes for API key
+		refreshService: NewRefreshTokenService(32, refreshExpiry),
+		accessExpiry: accessExpiry,
 	}
 }
 
-func (s *Service) Register(email, password, name string) (*models.User, error) {
+// Register creates the user with a default full access API key, the plaintext key is only returned here
+func (s *Service) Register(email, password, name string) (*models.User, string, error) {
 	// Check if user exists
 	var existingUser models.User
 	if err := s.db.Where("email = ?", email).First(&existingUser).Error; err == nil {
-		return nil, errors.New("user already exists")
+		return nil, "", errors.New("user already exists")
 	}
 
 	// Hash password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
-		return nil, err
-	}
-
-	// Generate API key
-	apiKey, err := s.apiKeyService.GenerateAPIKey()
-	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
 	// Create user
@@ -48,35 +58,86 @@ func (s *Service) Register(email, password, name string) (*models.User, error) {
 		Email:    email,
 		Password: string(hashedPassword),
 		Name:     name,
-		ApiKey:   apiKey,
 		Role:     "user",
 		IsActive: true,
 	}
 
-	if err := s.db.Create(user).Error; err != nil {
-		return nil, err
+	var apiKey string
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		// Generate API key
+		apiKey, _, err = s.apiKeyService.CreateAPIKey(tx, user.ID, defaultAPIKeyName, nil, nil)
+		return err
+	})
+	if err != nil {
+		return nil, "", err
 	}
 
-	return user, nil
+	return user, apiKey, nil
 }
 
-func (s *Service) Login(email, password string) (string, error) {
+func (s *Service) Login(email, password string) (*TokenPair, error) {
 	var user models.User
 	if err := s.db.Where("email = ?", email).First(&user).Error; err != nil {
-		return "", errors.New("invalid credentials")
+		return nil, errors.New("invalid credentials")
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
-		return "", errors.New("invalid credentials")
+		return nil, errors.New("invalid credentials")
+	}
+
+	// Start a new refresh token family for this session
+	refreshToken, record, err := s.refreshService.Issue(s.db, user.ID, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return s.issueTokenPair(&user, refreshToken, record)
+}
+
+// Refresh rotates a refresh token and issues a new access token
+func (s *Service) Refresh(refreshToken string) (*TokenPair, error) {
+	newToken, record, err := s.refreshService.Rotate(s.db, refreshToken)
+	if err != nil {
+		return nil, err
+	}
+
+	var user models.User
+	if err := s.db.First(&user, record.UserID).Error; err != nil {
+		return nil, err
+	}
+	if !user.IsActive {
+		s.refreshService.RevokeFamily(s.db, record.FamilyID, models.RevokedInactive)
+		return nil, ErrUnauthorized
+	}
+
+	return s.issueTokenPair(&user, newToken, record)
+}
+
+// Logout revokes the session the refresh token belongs to
+func (s *Service) Logout(refreshToken string) error {
+	return s.refreshService.Revoke(s.db, refreshToken, models.RevokedLogout)
+}
+
+func (s *Service) issueTokenPair(user *models.User, refreshToken string, record *models.RefreshToken) (*TokenPair, error) {
+	roles, err := s.UserRoles(user)
+	if err != nil {
+		return nil, err
 	}
 
 	// Generate JWT token
-	token, err := s.jwtService.GenerateToken(&user)
+	token, err := s.jwtService.GenerateToken(user, roles, record.FamilyID)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return token, nil
+	return &TokenPair{
+		AccessToken:  token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(s.accessExpiry.Seconds()),
+	}, nil
 }
 
 func (s *Service) ValidateJWT(token string) (*models.User, error) {
@@ -85,6 +146,17 @@ func (s *Service) ValidateJWT(token string) (*models.User, error) {
 		return nil, err
 	}
 
+	// Access tokens die with their session on logout or reuse detection
+	if claims.ID != "" {
+		active, err := s.refreshService.FamilyActive(s.db, claims.ID)
+		if err != nil {
+			return nil, err
+		}
+		if !active {
+			return nil, ErrTokenRevoked
+		}
+	}
+
 	var user models.User
 	if err := s.db.First(&user, claims.UserID).Error; err != nil {
 		return nil, err
@@ -93,19 +165,67 @@ func (s *Service) ValidateJWT(token string) (*models.User, error) {
 	return &user, nil
 }
 
-func (s *Service) ValidateAPIKey(apiKey string) (*models.User, error) {
+func (s *Service) ValidateAPIKey(apiKey string) (*models.User, *models.ApiKey, error) {
 	return s.apiKeyService.ValidateAPIKey(s.db, apiKey)
 }
 
+// RegenerateAPIKey deactivates the user's default key and issues a new one
 func (s *Service) RegenerateAPIKey(userID uint) (string, error) {
-	apiKey, err := s.apiKeyService.GenerateAPIKey()
+	var apiKey string
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.ApiKey{}).
+			Where("user_id = ? AND name = ?", userID, defaultAPIKeyName).
+			Update("is_active", false).Error; err != nil {
+			return err
+		}
+		var err error
+		apiKey, _, err = s.apiKeyService.CreateAPIKey(tx, userID, defaultAPIKeyName, nil, nil)
+		return err
+	})
 	if err != nil {
 		return "", err
 	}
 
-	if err := s.db.Model(&models.User{}).Where("id = ?", userID).Update("api_key", apiKey).Error; err != nil {
-		return "", err
+	return apiKey, nil
+}
+
+// CreateAPIKey issues an additional named key for the user
+func (s *Service) CreateAPIKey(userID uint, name string, scopes []string, expiresAt *time.Time) (string, *models.ApiKey, error) {
+	return s.apiKeyService.CreateAPIKey(s.db, userID, name, scopes, expiresAt)
+}
+
+// ListAPIKeys returns the user's keys, without their secrets
+func (s *Service) ListAPIKeys(userID uint) ([]models.ApiKey, error) {
+	var keys []models.ApiKey
+	if err := s.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&keys).Error; err != nil {
+		return nil, err
 	}
+	return keys, nil
+}
 
-	return apiKey, nil
+// RevokeAPIKey deactivates one of the user's keys
+func (s *Service) RevokeAPIKey(userID, keyID uint) (*models.ApiKey, error) {
+	var key models.ApiKey
+	if err := s.db.Where("id = ? AND user_id = ?", keyID, userID).First(&key).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidAPIKey
+		}
+		return nil, err
+	}
+	if err := s.db.Model(&key).Update("is_active", false).Error; err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// UserRoles returns the role IDs assigned to a user, falling back to the legacy role column
+func (s *Service) UserRoles(user *models.User) ([]string, error) {
+	var roles []string
+	if err := s.db.Model(&models.UserRole{}).Where("user_id = ?", user.ID).Order("role_id").Pluck("role_id", &roles).Error; err != nil {
+		return nil, err
+	}
+	if len(roles) == 0 && user.Role != "" {
+		roles = []string{user.Role}
+	}
+	return roles, nil
 }
@@ -0,0 +1,115 @@
+package database
+
+import (
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	gosqlite "github.com/glebarez/go-sqlite"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"mywall-api/internal/auth"
+	"mywall-api/internal/models"
+)
+
+var registerMySQLFunctions sync.Once
+
+// mysqlLeft matches MySQL LEFT(s, n), a keyword SQLite will not parse as a call
+var mysqlLeft = regexp.MustCompile(`LEFT\(([^,]+), (\d+)\)`)
+
+// mysqlFunctions adds the MySQL SHA2 used by the api key migration to SQLite
+func mysqlFunctions() {
+	registerMySQLFunctions.Do(func() {
+		gosqlite.MustRegisterDeterministicScalarFunction("sha2", 2, func(_ *gosqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+			sum := sha256.Sum256([]byte(fmt.Sprint(args[0])))
+			return hex.EncodeToString(sum[:]), nil
+		})
+	})
+}
+
+func migrationStatements(t *testing.T, path, driver string) []string {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	up, _ := extractSections(string(content))
+	return splitSQLStatements(up, driver)
+}
+
+// TestCreateAPIKeysMigration runs the data half of the MySQL migration, which
+// hashes users.api_key into api_keys, on SQLite
+func TestCreateAPIKeysMigration(t *testing.T) {
+	mysqlFunctions()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	// The users table before the migration, SQLite cannot drop a UNIQUE column
+	if err := db.AutoMigrate(&models.User{}); err != nil {
+		t.Fatal(err)
+	}
+	db.Exec("ALTER TABLE users ADD COLUMN api_key VARCHAR(64)")
+	legacyKey := strings.Repeat("ab12", 16)
+	for i, apiKey := range []interface{}{legacyKey, nil, ""} {
+		err := db.Exec("INSERT INTO users (email, password, is_active, api_key) VALUES (?, 'x', true, ?)",
+			fmt.Sprintf("user%d@example.com", i), apiKey).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// api_keys as created by the SQLite baseline, the MySQL DDL does not run here
+	for _, stmt := range migrationStatements(t, "../../migrations/sqlite/20261017120000_create_schema.sql", DriverSQLite) {
+		if strings.Contains(stmt, "TABLE IF NOT EXISTS api_keys") {
+			if err := db.Exec(stmt).Error; err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	ran := 0
+	for _, stmt := range migrationStatements(t, "../../migrations/20261017093000_create_api_keys_table.sql", DriverMySQL) {
+		if strings.HasPrefix(stmt, "INSERT") || strings.HasPrefix(stmt, "ALTER") {
+			stmt = mysqlLeft.ReplaceAllString(stmt, "substr($1, 1, $2)")
+			if err := db.Exec(stmt).Error; err != nil {
+				t.Fatalf("%s: %v", stmt, err)
+			}
+			ran++
+		}
+	}
+	if ran != 2 {
+		t.Fatalf("ran %d statements, want the INSERT and the ALTER", ran)
+	}
+
+	var keys []models.ApiKey
+	db.Find(&keys)
+	if len(keys) != 1 {
+		t.Fatalf("%d keys migrated, want only the non-empty one", len(keys))
+	}
+	sum := sha256.Sum256([]byte(legacyKey))
+	key := keys[0]
+	if key.UserID != 1 || key.Name != "default" || key.Prefix != legacyKey[:8] ||
+		key.KeyHash != hex.EncodeToString(sum[:]) || key.Scopes != auth.FullAccessScope || !key.IsActive {
+		t.Fatalf("migrated key = %+v", key)
+	}
+	if db.Migrator().HasColumn("users", "api_key") {
+		t.Fatal("users.api_key was not dropped")
+	}
+
+	// The old plaintext key keeps working
+	user, _, err := auth.NewAPIKeyService(32).ValidateAPIKey(db, legacyKey)
+	if err != nil || user.ID != 1 {
+		t.Fatalf("ValidateAPIKey = %v, %v", user, err)
+	}
+}
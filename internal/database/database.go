@@ -1,18 +1,103 @@
 package database
 
 import (
+	"fmt"
+	"strings"
+
 	"mywall-api/internal/models"
-	
+
+	"github.com/glebarez/sqlite"
 	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
-// Connect establishes a connection to the database
-func Connect(dsn string) (*gorm.DB, error) {
-	return gorm.Open(mysql.Open(dsn), &gorm.Config{})
+// Supported database drivers, as returned by gorm's Dialector.Name()
+const (
+	DriverMySQL    = "mysql"
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+// DetectDriver picks the driver of a DSN from its scheme and returns the DSN
+// the driver expects. Schemes only used for detection, such as mysql:// and
+// sqlite://, are stripped. A DSN without a known scheme is a MySQL one.
+func DetectDriver(dsn string) (driver, driverDSN string) {
+	switch {
+	case strings.HasPrefix(dsn, "postgres://"), strings.HasPrefix(dsn, "postgresql://"):
+		return DriverPostgres, dsn
+	case strings.HasPrefix(dsn, "mysql://"):
+		return DriverMySQL, strings.TrimPrefix(dsn, "mysql://")
+	case strings.HasPrefix(dsn, "sqlite://"):
+		return DriverSQLite, strings.TrimPrefix(dsn, "sqlite://")
+	case strings.HasPrefix(dsn, "sqlite:"):
+		return DriverSQLite, strings.TrimPrefix(dsn, "sqlite:")
+	case strings.HasPrefix(dsn, "file:"), dsn == ":memory:",
+		strings.HasSuffix(dsn, ".db"), strings.HasSuffix(dsn, ".sqlite"), strings.HasSuffix(dsn, ".sqlite3"):
+		return DriverSQLite, dsn
+	}
+	return DriverMySQL, dsn
+}
+
+// Connect establishes a connection to the database. The driver is detected
+// from the DSN when empty.
+func Connect(driver, dsn string) (*gorm.DB, error) {
+	if driver == "" {
+		driver, dsn = DetectDriver(dsn)
+	} else if detected, stripped := DetectDriver(dsn); detected == driver {
+		dsn = stripped
+	}
+
+	switch driver {
+	case DriverMySQL:
+		return gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	case DriverPostgres:
+		return gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	case DriverSQLite:
+		return connectSQLite(dsn)
+	}
+	return nil, fmt.Errorf("unsupported database driver %q, use mysql, postgres or sqlite", driver)
+}
+
+// connectSQLite opens a SQLite database with foreign keys enforced. Files use
+// WAL with a busy timeout and take the write lock when a transaction begins,
+// so concurrent writers wait for each other instead of failing with "database
+// is locked". An in-memory database exists once per connection, so it is
+// kept to a single one.
+func connectSQLite(dsn string) (*gorm.DB, error) {
+	memory := dsn == ":memory:" || strings.Contains(dsn, "mode=memory")
+	pragmas := []string{"_pragma=foreign_keys(1)"}
+	if !memory {
+		pragmas = append(pragmas, "_pragma=journal_mode(WAL)", "_pragma=busy_timeout(5000)", "_txlock=immediate")
+	}
+	for _, pragma := range pragmas {
+		name, _, _ := strings.Cut(pragma, "(")
+		if strings.Contains(dsn, name) {
+			continue // set by the DSN
+		}
+		sep := "?"
+		if strings.Contains(dsn, "?") {
+			sep = "&"
+		}
+		dsn += sep + pragma
+	}
+
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+	if memory {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return nil, err
+		}
+		sqlDB.SetMaxOpenConns(1)
+	}
+	return db, nil
 }
 
 // Migrate runs database migrations
 func Migrate(db *gorm.DB) error {
-	return db.AutoMigrate(&models.Gallery{}, &models.User{})
-}
\ No newline at end of file
+	return db.AutoMigrate(&models.Gallery{}, &models.User{}, &models.UserRole{}, &models.RefreshToken{}, &models.ApiKey{},
+		&models.NotificationPreference{}, &models.NotificationDelivery{}, &models.NotificationDigest{}, &models.ScheduledNotification{})
+}
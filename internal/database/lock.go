@@ -0,0 +1,164 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// migrationLockName identifies the migration lock, shared by every replica
+const migrationLockName = "mywall_migrations"
+
+// DefaultLockTimeout is how long a migrator waits for another one by default
+const DefaultLockTimeout = 5 * time.Minute
+
+// ErrLockTimeout is returned when another instance held the migration lock
+// for longer than the timeout
+var ErrLockTimeout = errors.New("timed out waiting for the migration lock")
+
+// lockPollInterval is how often a lock without a blocking wait is retried
+const lockPollInterval = 500 * time.Millisecond
+
+// unlockFunc releases a lock taken by acquireMigrationLock
+type unlockFunc func() error
+
+// acquireMigrationLock takes a lock held until the returned function is
+// called, so only one instance migrates at a time. MySQL and PostgreSQL use an
+// advisory lock on a dedicated connection, SQLite a lock file next to the
+// database.
+func acquireMigrationLock(db *gorm.DB, timeout time.Duration) (unlockFunc, error) {
+	switch db.Dialector.Name() {
+	case DriverMySQL:
+		return mysqlLock(db, timeout)
+	case DriverPostgres:
+		return postgresLock(db, timeout)
+	case DriverSQLite:
+		return sqliteLock(db, timeout)
+	}
+	return nil, fmt.Errorf("migration lock is not supported for %s", db.Dialector.Name())
+}
+
+// lockConn pins a pooled connection, advisory locks belong to the session
+// that took them
+func lockConn(db *gorm.DB) (*sql.Conn, error) {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	return sqlDB.Conn(context.Background())
+}
+
+// mysqlLock waits on GET_LOCK, which takes its timeout in whole seconds
+func mysqlLock(db *gorm.DB, timeout time.Duration) (unlockFunc, error) {
+	conn, err := lockConn(db)
+	if err != nil {
+		return nil, err
+	}
+
+	seconds := int(timeout.Round(time.Second) / time.Second)
+	var acquired sql.NullInt64
+	if err := conn.QueryRowContext(context.Background(), "SELECT GET_LOCK(?, ?)", migrationLockName, seconds).Scan(&acquired); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !acquired.Valid || acquired.Int64 != 1 {
+		conn.Close()
+		return nil, ErrLockTimeout
+	}
+
+	return func() error {
+		defer conn.Close()
+		_, err := conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", migrationLockName)
+		return err
+	}, nil
+}
+
+// postgresLockKey turns the lock name into the bigint key of pg_advisory_lock
+func postgresLockKey() int64 {
+	h := fnv.New64a()
+	h.Write([]byte(migrationLockName))
+	return int64(h.Sum64())
+}
+
+// postgresLock polls pg_try_advisory_lock, pg_advisory_lock itself would wait
+// forever
+func postgresLock(db *gorm.DB, timeout time.Duration) (unlockFunc, error) {
+	conn, err := lockConn(db)
+	if err != nil {
+		return nil, err
+	}
+
+	key := postgresLockKey()
+	deadline := time.Now().Add(timeout)
+	for {
+		var acquired bool
+		if err := conn.QueryRowContext(context.Background(), "SELECT pg_try_advisory_lock($1)", key).Scan(&acquired); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		if acquired {
+			break
+		}
+		if time.Now().After(deadline) {
+			conn.Close()
+			return nil, ErrLockTimeout
+		}
+		time.Sleep(lockPollInterval)
+	}
+
+	return func() error {
+		defer conn.Close()
+		_, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", key)
+		return err
+	}, nil
+}
+
+// sqliteLock locks a file next to the main database file. In-memory databases
+// belong to a single process and need no lock.
+func sqliteLock(db *gorm.DB, timeout time.Duration) (unlockFunc, error) {
+	var databases []struct {
+		Name string
+		File string
+	}
+	if err := db.Raw("PRAGMA database_list").Scan(&databases).Error; err != nil {
+		return nil, err
+	}
+	path := ""
+	for _, d := range databases {
+		if d.Name == "main" {
+			path = d.File
+		}
+	}
+	if path == "" {
+		return func() error { return nil }, nil
+	}
+	return lockFile(path+".migrate.lock", timeout)
+}
+
+// withMigrationLock runs fn while holding the migration lock
+func (m *Migrator) withMigrationLock(fn func() error) error {
+	// A dry run changes nothing, it has no reason to wait for other instances
+	if m.DryRun {
+		return fn()
+	}
+
+	start := time.Now()
+	unlock, err := acquireMigrationLock(m.db, m.LockTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	if waited := time.Since(start); waited >= time.Second {
+		fmt.Fprintf(m.out, "Waited %s for the migration lock\n", waited.Round(time.Second))
+	}
+
+	err = fn()
+	if unlockErr := unlock(); unlockErr != nil && err == nil {
+		err = fmt.Errorf("failed to release migration lock: %w", unlockErr)
+	}
+	return err
+}
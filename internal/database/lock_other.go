@@ -0,0 +1,29 @@
+//go:build !unix
+
+package database
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+// lockFile creates path exclusively and removes it on release. A process
+// killed while migrating leaves the file behind, it must then be deleted by hand.
+func lockFile(path string, timeout time.Duration) (unlockFunc, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			f.Close()
+			return func() error { return os.Remove(path) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		if time.Now().After(deadline) {
+			return nil, ErrLockTimeout
+		}
+		time.Sleep(lockPollInterval)
+	}
+}
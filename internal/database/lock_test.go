@@ -0,0 +1,136 @@
+package database
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// holdMigrationLock takes the lock of the SQLite file at path as another
+// process would, the returned function releases it
+func holdMigrationLock(t *testing.T, path string) func() {
+	t.Helper()
+	unlock, err := lockFile(path+".migrate.lock", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var once sync.Once
+	release := func() { once.Do(func() { unlock() }) }
+	t.Cleanup(release)
+	return release
+}
+
+// slowWriter pauses after each progress line. Between two migrations a run
+// then holds no SQLite write lock for long enough that, without the migration
+// lock, the others read the migrations table and apply the same migration.
+type slowWriter struct{ *bytes.Buffer }
+
+func (w slowWriter) Write(p []byte) (int, error) {
+	defer time.Sleep(20 * time.Millisecond)
+	return w.Buffer.Write(p)
+}
+
+func TestMigrationLockSerializesConcurrentUp(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	release := holdMigrationLock(t, path)
+
+	// The runs start while the lock is held and race for it once released
+	const runs = 3
+	errs := make([]error, runs)
+	outs := make([]*bytes.Buffer, runs)
+	var wg sync.WaitGroup
+	for i := 0; i < runs; i++ {
+		m, out := newTestMigrator(openMigratorTestDB(t, path), testMigrations())
+		m.SetOutput(slowWriter{out})
+		outs[i] = out
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = m.Up()
+		}(i)
+	}
+	time.Sleep(2 * lockPollInterval)
+	release()
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("run %d: %v\n%s", i, err, outs[i])
+		}
+	}
+	names := []string{migrationA, migrationB, migrationC}
+	for _, name := range names {
+		applying := 0
+		for _, out := range outs {
+			applying += strings.Count(out.String(), "Applying migration: "+name+"\n")
+		}
+		if applying != 1 {
+			t.Errorf("%s applied %d times", name, applying)
+		}
+	}
+
+	db := openMigratorTestDB(t, path)
+	if got := appliedNames(t, db); !reflect.DeepEqual(got, names) {
+		t.Fatalf("migrations table holds %v", got)
+	}
+	var check string
+	db.Raw("PRAGMA integrity_check").Scan(&check)
+	if check != "ok" {
+		t.Fatalf("integrity_check: %s", check)
+	}
+}
+
+func TestMigrationLockTimeout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db := openMigratorTestDB(t, path)
+	fsys := testMigrations()
+	m, _ := newTestMigrator(db, fsys)
+	if err := m.Goto("20240101000000"); err != nil {
+		t.Fatal(err)
+	}
+	before := checksums(t, db)
+
+	release := holdMigrationLock(t, path)
+	other, out := newTestMigrator(openMigratorTestDB(t, path), fsys)
+	other.LockTimeout = 100 * time.Millisecond
+	for name, run := range map[string]func() error{
+		"Up":       other.Up,
+		"Down":     func() error { return other.Down(1) },
+		"Backfill": other.BackfillChecksums,
+	} {
+		if err := run(); !errors.Is(err, ErrLockTimeout) {
+			t.Errorf("%s = %v, want ErrLockTimeout", name, err)
+		}
+	}
+	if out.Len() != 0 {
+		t.Fatalf("migrator ran without the lock:\n%s", out)
+	}
+	if got := checksums(t, db); len(got) != len(before) || got[migrationA] != before[migrationA] {
+		t.Fatalf("migrations table changed to %v", got)
+	}
+
+	// The lock is free again once released
+	release()
+	if err := other.Up(); err != nil {
+		t.Fatalf("Up after release: %v", err)
+	}
+	if got := appliedNames(t, db); len(got) != 3 {
+		t.Fatalf("applied %v", got)
+	}
+}
+
+func TestMigrationLockSkippedForDryRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	holdMigrationLock(t, path)
+	m, _ := newTestMigrator(openMigratorTestDB(t, path), testMigrations())
+	m.LockTimeout = 100 * time.Millisecond
+	m.DryRun = true
+	if err := m.Up(); err != nil {
+		t.Fatalf("dry run waited for the lock: %v", err)
+	}
+}
@@ -5,7 +5,6 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
-	"sort"
 	"strings"
 	"time"
 
@@ -17,148 +16,98 @@ type Migration struct {
 	ID        uint      `gorm:"primaryKey"`
 	Name      string    `gorm:"size:255;not null;unique"`
 	AppliedAt time.Time `gorm:"not null"` // Removed the default:CURRENT_TIMESTAMP
+	Checksum  string    `gorm:"size:64;not null;default:''"` // SHA-256 of the applied Up section
 }
 
 // MigrateWithSQL runs SQL migrations from the migrations directory
 func MigrateWithSQL(db *gorm.DB, migrationsDir string) error {
-	// Create migrations table manually instead of using AutoMigrate
-	err := createMigrationsTable(db)
-	if err != nil {
-		return fmt.Errorf("failed to create migrations table: %w", err)
-	}
-
-	// Get applied migrations
-	appliedMigrations := make(map[string]bool)
-	var migrations []Migration
-	if err := db.Find(&migrations).Error; err != nil {
-		return fmt.Errorf("failed to get applied migrations: %w", err)
-	}
-	for _, m := range migrations {
-		appliedMigrations[m.Name] = true
-	}
+	return NewMigrator(db, os.DirFS(migrationsDir)).Up()
+}
 
-	// Read migration files
-	files, err := os.ReadDir(migrationsDir)
-	if err != nil {
-		return fmt.Errorf("failed to read migrations directory: %w", err)
+// sectionMarker matches the "-- Up" and "-- Down" lines of a migration file
+func sectionMarker(line string) string {
+	switch strings.TrimSpace(line) {
+	case "-- Up":
+		return "up"
+	case "-- Down":
+		return "down"
 	}
+	return ""
+}
 
-	// Filter and sort migration files
-	var migrationFiles []string
-	for _, file := range files {
-		if !file.IsDir() && strings.HasSuffix(file.Name(), ".sql") {
-			migrationFiles = append(migrationFiles, file.Name())
-		}
-	}
-	sort.Strings(migrationFiles)
-
-	// Apply migrations
-	for _, fileName := range migrationFiles {
-		// Skip if already applied
-		if appliedMigrations[fileName] {
-			fmt.Printf("Migration %s already applied, skipping\n", fileName)
+// extractSections splits a migration file into its Up and Down SQL. A file
+// without an "-- Up" line is all Up.
+func extractSections(sql string) (up, down string) {
+	var upLines, downLines []string
+	section := ""
+	sawUp := false
+	for _, line := range strings.Split(sql, "\n") {
+		if marker := sectionMarker(line); marker != "" {
+			section = marker
+			sawUp = sawUp || marker == "up"
 			continue
 		}
-
-		// Read and apply migration
-		filePath := filepath.Join(migrationsDir, fileName)
-		sqlBytes, err := ioutil.ReadFile(filePath)
-		if err != nil {
-			return fmt.Errorf("failed to read migration file %s: %w", fileName, err)
+		switch section {
+		case "up":
+			upLines = append(upLines, line)
+		case "down":
+			downLines = append(downLines, line)
 		}
-
-		sql := string(sqlBytes)
-		fmt.Printf("Applying migration: %s\n", fileName)
-
-		// Extract the Up section and split into statements
-		upSQL := extractUpSection(sql)
-		statements := splitSQLStatements(upSQL)
-
-		// Begin transaction
-		tx := db.Begin()
-		if tx.Error != nil {
-			return fmt.Errorf("failed to start transaction for migration %s: %w", fileName, tx.Error)
-		}
-
-		// Execute each statement individually
-		for _, stmt := range statements {
-			stmt = strings.TrimSpace(stmt)
-			if stmt == "" {
-				continue
-			}
-			
-			if err := tx.Exec(stmt).Error; err != nil {
-				tx.Rollback()
-				return fmt.Errorf("failed to apply migration statement in %s: %w\nStatement: %s", fileName, err, stmt)
-			}
-		}
-
-		// Record migration
-		if err := tx.Create(&Migration{Name: fileName, AppliedAt: time.Now()}).Error; err != nil {
-			tx.Rollback()
-			return fmt.Errorf("failed to record migration %s: %w", fileName, err)
-		}
-
-		// Commit transaction
-		if err := tx.Commit().Error; err != nil {
-			return fmt.Errorf("failed to commit migration %s: %w", fileName, err)
-		}
-
-		fmt.Printf("Successfully applied migration: %s\n", fileName)
-	}
-
-	return nil
-}
-
-// extractUpSection extracts the SQL statements from the "Up" section of a migration file
-func extractUpSection(sql string) string {
-	// Find "-- Up" and "-- Down" markers
-	upIndex := strings.Index(sql, "-- Up")
-	downIndex := strings.Index(sql, "-- Down")
-	
-	if upIndex == -1 {
-		// No explicit sections, use the whole file
-		return sql
 	}
-	
-	if downIndex == -1 {
-		// No down section, use everything from "-- Up"
-		return strings.TrimSpace(sql[upIndex+len("-- Up"):])
+	if !sawUp {
+		return strings.TrimSpace(sql), strings.TrimSpace(strings.Join(downLines, "\n"))
 	}
-	
-	// Extract just the Up section
-	return strings.TrimSpace(sql[upIndex+len("-- Up"):downIndex])
+	return strings.TrimSpace(strings.Join(upLines, "\n")), strings.TrimSpace(strings.Join(downLines, "\n"))
 }
 
-// splitSQLStatements splits a SQL string into individual statements
-func splitSQLStatements(sql string) []string {
-	// Simple implementation - split by semicolons
-	// This will handle most cases but might not handle complex SQL with embedded semicolons in quotes, etc.
-	statements := strings.Split(sql, ";")
-	
-	// Remove any empty statements
-	var result []string
-	for _, stmt := range statements {
-		if strings.TrimSpace(stmt) != "" {
-			result = append(result, stmt)
-		}
-	}
-	
-	return result
-}
-
-// createMigrationsTable creates the migrations table with proper SQL
-func createMigrationsTable(db *gorm.DB) error {
-	sql := `
+// migrationsTableDDL creates the migrations table in each driver's dialect
+var migrationsTableDDL = map[string]string{
+	DriverMySQL: `
 	CREATE TABLE IF NOT EXISTS migrations (
 		id bigint unsigned AUTO_INCREMENT,
 		name varchar(255) NOT NULL,
 		applied_at datetime(3) NOT NULL,
+		checksum varchar(64) NOT NULL DEFAULT '',
 		PRIMARY KEY (id),
 		CONSTRAINT uni_migrations_name UNIQUE (name)
 	)
-	`
-	return db.Exec(sql).Error
+	`,
+	DriverPostgres: `
+	CREATE TABLE IF NOT EXISTS migrations (
+		id bigserial,
+		name varchar(255) NOT NULL,
+		applied_at timestamptz NOT NULL,
+		checksum varchar(64) NOT NULL DEFAULT '',
+		PRIMARY KEY (id),
+		CONSTRAINT uni_migrations_name UNIQUE (name)
+	)
+	`,
+	DriverSQLite: `
+	CREATE TABLE IF NOT EXISTS migrations (
+		id integer PRIMARY KEY AUTOINCREMENT,
+		name varchar(255) NOT NULL,
+		applied_at datetime NOT NULL,
+		checksum varchar(64) NOT NULL DEFAULT '',
+		CONSTRAINT uni_migrations_name UNIQUE (name)
+	)
+	`,
+}
+
+// createMigrationsTable creates the migrations table with proper SQL
+func createMigrationsTable(db *gorm.DB) error {
+	sql, ok := migrationsTableDDL[db.Dialector.Name()]
+	if !ok {
+		return fmt.Errorf("SQL migrations are not supported for %s", db.Dialector.Name())
+	}
+	if err := db.Exec(sql).Error; err != nil {
+		return err
+	}
+
+	// Tables created before checksums were recorded
+	if !db.Migrator().HasColumn(&Migration{}, "checksum") {
+		return db.Exec("ALTER TABLE migrations ADD COLUMN checksum varchar(64) NOT NULL DEFAULT ''").Error
+	}
+	return nil
 }
 
 // CreateMigration creates a new migration file
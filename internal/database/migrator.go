@@ -0,0 +1,522 @@
+package database
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Migration errors
+var (
+	// ErrNoDownSection is returned when rolling back a migration whose Down section is empty
+	ErrNoDownSection = errors.New("migration has no down section")
+	// ErrChecksumMismatch is returned when an applied migration was edited afterwards
+	ErrChecksumMismatch = errors.New("applied migrations were modified")
+	// ErrChecksumMissing is returned in strict mode when an applied migration
+	// was recorded before checksums existed
+	ErrChecksumMissing = errors.New("applied migrations have no checksum")
+)
+
+// migrationFile is a parsed migration file
+type migrationFile struct {
+	Name     string // File name, recorded in the migrations table
+	Version  string // Timestamp prefix of the file name
+	Up       string
+	Down     string
+	Checksum string // SHA-256 of the Up section, Down edits never change what was applied
+}
+
+// MigrationStatus describes one migration known to the directory or the database
+type MigrationStatus struct {
+	Name      string
+	Version   string
+	Applied   bool
+	AppliedAt *time.Time
+	Missing   bool // Applied but its file is gone
+	Modified  bool // Applied but its Up section changed since
+}
+
+// Migrator applies and rolls back SQL migrations
+type Migrator struct {
+	db   *gorm.DB
+	fsys fs.FS
+	out  io.Writer
+	// DryRun prints the SQL that would run instead of executing it
+	DryRun bool
+	// Strict refuses to migrate when an applied migration was modified,
+	// otherwise a warning is printed
+	Strict bool
+	// LockTimeout is how long to wait while another instance migrates
+	LockTimeout time.Duration
+}
+
+// NewMigrator creates a migrator for the .sql files of fsys, such as
+// migrations.FS or os.DirFS(dir). Progress is printed to stdout.
+func NewMigrator(db *gorm.DB, fsys fs.FS) *Migrator {
+	return &Migrator{db: db, fsys: fsys, out: os.Stdout, LockTimeout: DefaultLockTimeout}
+}
+
+// SetOutput redirects progress and dry-run output
+func (m *Migrator) SetOutput(w io.Writer) {
+	m.out = w
+}
+
+// migrationVersion returns the timestamp prefix of a migration file name
+func migrationVersion(name string) string {
+	version, _, _ := strings.Cut(name, "_")
+	return version
+}
+
+// migrationChecksum returns the hex SHA-256 of a migration's Up section
+func migrationChecksum(up string) string {
+	sum := sha256.Sum256([]byte(up))
+	return hex.EncodeToString(sum[:])
+}
+
+// source returns the migrations of the connected database. MySQL ones are at
+// the root, other databases use a subdirectory named after their driver, such
+// as postgres/, when there is one.
+func (m *Migrator) source() (fs.FS, error) {
+	driver := m.db.Dialector.Name()
+	if driver == DriverMySQL {
+		return m.fsys, nil
+	}
+	info, err := fs.Stat(m.fsys, driver)
+	if err != nil || !info.IsDir() {
+		return m.fsys, nil
+	}
+	return fs.Sub(m.fsys, driver)
+}
+
+// load reads and parses the migration files, sorted by name
+func (m *Migrator) load() ([]migrationFile, error) {
+	fsys, err := m.source()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations directory: %w", err)
+	}
+
+	var files []migrationFile
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+		sqlBytes, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration file %s: %w", entry.Name(), err)
+		}
+		up, down := extractSections(string(sqlBytes))
+		files = append(files, migrationFile{
+			Name:     entry.Name(),
+			Version:  migrationVersion(entry.Name()),
+			Up:       up,
+			Down:     down,
+			Checksum: migrationChecksum(up),
+		})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	return files, nil
+}
+
+// applied returns the recorded migrations by name. In dry-run mode a missing
+// migrations table is treated as empty instead of being created.
+func (m *Migrator) applied() (map[string]Migration, error) {
+	if m.DryRun {
+		if !m.db.Migrator().HasTable("migrations") {
+			return map[string]Migration{}, nil
+		}
+	} else if err := createMigrationsTable(m.db); err != nil {
+		return nil, fmt.Errorf("failed to create migrations table: %w", err)
+	}
+
+	var migrations []Migration
+	if err := m.db.Find(&migrations).Error; err != nil {
+		return nil, fmt.Errorf("failed to get applied migrations: %w", err)
+	}
+	applied := make(map[string]Migration, len(migrations))
+	for _, mig := range migrations {
+		applied[mig.Name] = mig
+	}
+	return applied, nil
+}
+
+// state loads the files and the applied migrations together
+func (m *Migrator) state() ([]migrationFile, map[string]Migration, error) {
+	files, err := m.load()
+	if err != nil {
+		return nil, nil, err
+	}
+	applied, err := m.applied()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := m.verify(files, applied); err != nil {
+		return nil, nil, err
+	}
+	return files, applied, nil
+}
+
+// modified returns the applied migrations whose Up section no longer matches
+// the recorded checksum. Rows recorded before checksums existed have none.
+func modified(files []migrationFile, applied map[string]Migration) []string {
+	var names []string
+	for _, f := range files {
+		if mig, ok := applied[f.Name]; ok && mig.Checksum != "" && mig.Checksum != f.Checksum {
+			names = append(names, f.Name)
+		}
+	}
+	return names
+}
+
+// unchecked returns the applied migrations recorded before checksums existed
+func unchecked(files []migrationFile, applied map[string]Migration) []migrationFile {
+	var result []migrationFile
+	for _, f := range files {
+		if mig, ok := applied[f.Name]; ok && mig.Checksum == "" {
+			result = append(result, f)
+		}
+	}
+	return result
+}
+
+// backfill records the checksum of each applied migration that has none,
+// trusting that its file is what ran
+func (m *Migrator) backfill(files []migrationFile, applied map[string]Migration) error {
+	for _, f := range unchecked(files, applied) {
+		if m.DryRun {
+			fmt.Fprintf(m.out, "UPDATE migrations SET checksum = '%s' WHERE name = '%s';\n", f.Checksum, f.Name)
+		} else {
+			if err := m.db.Model(&Migration{}).Where("name = ?", f.Name).Update("checksum", f.Checksum).Error; err != nil {
+				return fmt.Errorf("failed to record checksum of %s: %w", f.Name, err)
+			}
+			fmt.Fprintf(m.out, "Recorded checksum of migration: %s\n", f.Name)
+		}
+		mig := applied[f.Name]
+		mig.Checksum = f.Checksum
+		applied[f.Name] = mig
+	}
+	return nil
+}
+
+// verify records missing checksums, which strict mode refuses to do
+// implicitly, then fails or warns about applied migrations edited since
+func (m *Migrator) verify(files []migrationFile, applied map[string]Migration) error {
+	if m.Strict {
+		if missing := unchecked(files, applied); len(missing) > 0 {
+			names := make([]string, len(missing))
+			for i, f := range missing {
+				names[i] = f.Name
+			}
+			return fmt.Errorf("%w: %s, run \"migrate checksum --backfill\" after checking them", ErrChecksumMissing, strings.Join(names, ", "))
+		}
+	} else if err := m.backfill(files, applied); err != nil {
+		return err
+	}
+
+	names := modified(files, applied)
+	if len(names) == 0 {
+		return nil
+	}
+	err := fmt.Errorf("%w since they ran: %s", ErrChecksumMismatch, strings.Join(names, ", "))
+	if m.Strict {
+		return err
+	}
+	fmt.Fprintf(m.out, "WARNING: %v\n", err)
+	return nil
+}
+
+// appliedFiles returns the applied migrations newest first, failing when a file is missing
+func appliedFiles(files []migrationFile, applied map[string]Migration) ([]migrationFile, error) {
+	byName := make(map[string]migrationFile, len(files))
+	for _, f := range files {
+		byName[f.Name] = f
+	}
+	names := make([]string, 0, len(applied))
+	for name := range applied {
+		names = append(names, name)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+
+	result := make([]migrationFile, 0, len(names))
+	for _, name := range names {
+		f, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("applied migration %s has no file", name)
+		}
+		result = append(result, f)
+	}
+	return result, nil
+}
+
+// Up applies every pending migration in order
+func (m *Migrator) Up() error {
+	return m.withMigrationLock(m.up)
+}
+
+func (m *Migrator) up() error {
+	files, applied, err := m.state()
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if _, ok := applied[f.Name]; ok {
+			fmt.Fprintf(m.out, "Migration %s already applied, skipping\n", f.Name)
+			continue
+		}
+		if err := m.apply(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Down rolls back the last n applied migrations, newest first
+func (m *Migrator) Down(n int) error {
+	return m.withMigrationLock(func() error { return m.down(n) })
+}
+
+func (m *Migrator) down(n int) error {
+	files, applied, err := m.state()
+	if err != nil {
+		return err
+	}
+	targets, err := appliedFiles(files, applied)
+	if err != nil {
+		return err
+	}
+	if n < len(targets) {
+		targets = targets[:n]
+	}
+	if len(targets) == 0 {
+		fmt.Fprintln(m.out, "No applied migrations to roll back")
+	}
+	for _, f := range targets {
+		if err := m.rollback(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Redo rolls back the last applied migration and applies it again
+func (m *Migrator) Redo() error {
+	return m.withMigrationLock(m.redo)
+}
+
+func (m *Migrator) redo() error {
+	files, applied, err := m.state()
+	if err != nil {
+		return err
+	}
+	targets, err := appliedFiles(files, applied)
+	if err != nil {
+		return err
+	}
+	if len(targets) == 0 {
+		return errors.New("no applied migration to redo")
+	}
+	if err := m.rollback(targets[0]); err != nil {
+		return err
+	}
+	return m.apply(targets[0])
+}
+
+// Goto migrates up or down until version is the latest applied migration.
+// The version is the timestamp prefix of a file name, or "0" to roll back everything.
+func (m *Migrator) Goto(version string) error {
+	return m.withMigrationLock(func() error { return m.goTo(version) })
+}
+
+func (m *Migrator) goTo(version string) error {
+	files, applied, err := m.state()
+	if err != nil {
+		return err
+	}
+	if version != "0" {
+		found := false
+		for _, f := range files {
+			if f.Version == version || f.Name == version {
+				version = f.Version
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("unknown migration version %s", version)
+		}
+	}
+
+	// Roll back what is newer than the target, then apply what is older
+	targets, err := appliedFiles(files, applied)
+	if err != nil {
+		return err
+	}
+	for _, f := range targets {
+		if version != "0" && f.Version <= version {
+			break
+		}
+		if err := m.rollback(f); err != nil {
+			return err
+		}
+	}
+	if version == "0" {
+		return nil
+	}
+	for _, f := range files {
+		if f.Version > version {
+			break
+		}
+		if _, ok := applied[f.Name]; ok {
+			continue
+		}
+		if err := m.apply(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BackfillChecksums records the checksum of applied migrations that have none,
+// for databases migrated before checksums existed. It is the only way to do so
+// in strict mode.
+func (m *Migrator) BackfillChecksums() error {
+	return m.withMigrationLock(func() error {
+		files, err := m.load()
+		if err != nil {
+			return err
+		}
+		applied, err := m.applied()
+		if err != nil {
+			return err
+		}
+		if len(unchecked(files, applied)) == 0 {
+			fmt.Fprintln(m.out, "Every applied migration has a checksum")
+			return nil
+		}
+		return m.backfill(files, applied)
+	})
+}
+
+// Status lists every migration file with its applied state, followed by
+// applied migrations whose file is missing
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	files, err := m.load()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	changed := make(map[string]bool)
+	for _, name := range modified(files, applied) {
+		changed[name] = true
+	}
+
+	var statuses []MigrationStatus
+	seen := make(map[string]bool, len(files))
+	for _, f := range files {
+		status := MigrationStatus{Name: f.Name, Version: f.Version}
+		if mig, ok := applied[f.Name]; ok {
+			appliedAt := mig.AppliedAt
+			status.Applied = true
+			status.AppliedAt = &appliedAt
+			status.Modified = changed[f.Name]
+		}
+		seen[f.Name] = true
+		statuses = append(statuses, status)
+	}
+
+	var missing []string
+	for name := range applied {
+		if !seen[name] {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(missing)
+	for _, name := range missing {
+		appliedAt := applied[name].AppliedAt
+		statuses = append(statuses, MigrationStatus{
+			Name:      name,
+			Version:   migrationVersion(name),
+			Applied:   true,
+			AppliedAt: &appliedAt,
+			Missing:   true,
+		})
+	}
+	return statuses, nil
+}
+
+// apply runs the Up section of a migration and records it in one transaction
+func (m *Migrator) apply(f migrationFile) error {
+	fmt.Fprintf(m.out, "Applying migration: %s\n", f.Name)
+	err := m.run(f.Name, splitSQLStatements(f.Up, m.db.Dialector.Name()), func(tx *gorm.DB) error {
+		return tx.Create(&Migration{Name: f.Name, AppliedAt: time.Now(), Checksum: f.Checksum}).Error
+	}, fmt.Sprintf("INSERT INTO migrations (name, applied_at, checksum) VALUES ('%s', CURRENT_TIMESTAMP, '%s');", f.Name, f.Checksum))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(m.out, "Successfully applied migration: %s\n", f.Name)
+	return nil
+}
+
+// rollback runs the Down section of a migration and removes its record in one transaction
+func (m *Migrator) rollback(f migrationFile) error {
+	statements := splitSQLStatements(f.Down, m.db.Dialector.Name())
+	if len(statements) == 0 {
+		return fmt.Errorf("failed to roll back %s: %w", f.Name, ErrNoDownSection)
+	}
+
+	fmt.Fprintf(m.out, "Rolling back migration: %s\n", f.Name)
+	err := m.run(f.Name, statements, func(tx *gorm.DB) error {
+		return tx.Where("name = ?", f.Name).Delete(&Migration{}).Error
+	}, fmt.Sprintf("DELETE FROM migrations WHERE name = '%s';", f.Name))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(m.out, "Successfully rolled back migration: %s\n", f.Name)
+	return nil
+}
+
+// run executes statements and the bookkeeping in a transaction, or prints them in dry-run mode.
+// MySQL commits DDL implicitly, so a failed schema change may still be partially applied.
+func (m *Migrator) run(name string, statements []string, record func(tx *gorm.DB) error, recordSQL string) error {
+	if m.DryRun {
+		for _, stmt := range statements {
+			fmt.Fprintf(m.out, "%s;\n", stmt)
+		}
+		fmt.Fprintln(m.out, recordSQL)
+		return nil
+	}
+
+	tx := m.db.Begin()
+	if tx.Error != nil {
+		return fmt.Errorf("failed to start transaction for migration %s: %w", name, tx.Error)
+	}
+	for _, stmt := range statements {
+		if err := tx.Exec(stmt).Error; err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to run migration statement in %s: %w\nStatement: %s", name, err, stmt)
+		}
+	}
+	if err := record(tx); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to record migration %s: %w", name, err)
+	}
+	if err := tx.Commit().Error; err != nil {
+		return fmt.Errorf("failed to commit migration %s: %w", name, err)
+	}
+	return nil
+}
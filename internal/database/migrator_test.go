@@ -0,0 +1,424 @@
+package database
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const (
+	migrationA = "20240101000000_create_a.sql"
+	migrationB = "20240102000000_create_b.sql"
+	migrationC = "20240103000000_add_c.sql"
+)
+
+// testMigrations depend on each other, so applying them out of order fails
+func testMigrations() fstest.MapFS {
+	return fstest.MapFS{
+		migrationC:  {Data: []byte("-- Up\nALTER TABLE b ADD COLUMN c TEXT;\n-- Down\nALTER TABLE b DROP COLUMN c;\n")},
+		migrationA:  {Data: []byte("-- Up\nCREATE TABLE a (id INTEGER PRIMARY KEY);\n-- Down\nDROP TABLE a;\n")},
+		migrationB:  {Data: []byte("-- Up\nCREATE TABLE b (id INTEGER PRIMARY KEY, a_id INTEGER REFERENCES a(id));\n-- Down\nDROP TABLE b;\n")},
+		"README.md": {Data: []byte("not a migration")},
+	}
+}
+
+// newMigratorTestDB opens a SQLite file in a temporary directory
+func newMigratorTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	return openMigratorTestDB(t, filepath.Join(t.TempDir(), "test.db"))
+}
+
+// openMigratorTestDB opens its own connection pool to the SQLite file at path
+func openMigratorTestDB(t *testing.T, path string) *gorm.DB {
+	t.Helper()
+	db, err := Connect(DriverSQLite, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Logger = logger.Discard
+	sqlDB, _ := db.DB()
+	t.Cleanup(func() { sqlDB.Close() })
+	return db
+}
+
+// newTestMigrator returns a migrator whose output is kept in the returned buffer
+func newTestMigrator(db *gorm.DB, fsys fs.FS) (*Migrator, *bytes.Buffer) {
+	var out bytes.Buffer
+	m := NewMigrator(db, fsys)
+	m.SetOutput(&out)
+	return m, &out
+}
+
+// appliedNames returns the recorded migrations in the order they were applied
+func appliedNames(t *testing.T, db *gorm.DB) []string {
+	t.Helper()
+	var names []string
+	if err := db.Model(&Migration{}).Order("id").Pluck("name", &names).Error; err != nil {
+		t.Fatal(err)
+	}
+	return names
+}
+
+// actions lists the "Applying" and "Rolling back" lines of the output in order
+func actions(out *bytes.Buffer) []string {
+	var lines []string
+	for _, match := range regexp.MustCompile(`(?m)^(Applying migration|Rolling back migration): (\S+)$`).FindAllStringSubmatch(out.String(), -1) {
+		verb := "up"
+		if match[1] == "Rolling back migration" {
+			verb = "down"
+		}
+		lines = append(lines, verb+" "+match[2])
+	}
+	out.Reset()
+	return lines
+}
+
+func expectActions(t *testing.T, out *bytes.Buffer, want ...string) {
+	t.Helper()
+	if got := actions(out); !reflect.DeepEqual(got, want) && (len(got) != 0 || len(want) != 0) {
+		t.Fatalf("ran %v, want %v", got, want)
+	}
+}
+
+func TestMigratorUpAppliesInOrder(t *testing.T) {
+	db := newMigratorTestDB(t)
+	m, out := newTestMigrator(db, testMigrations())
+
+	if err := m.Up(); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	expectActions(t, out, "up "+migrationA, "up "+migrationB, "up "+migrationC)
+	if got := appliedNames(t, db); !reflect.DeepEqual(got, []string{migrationA, migrationB, migrationC}) {
+		t.Fatalf("applied %v", got)
+	}
+	if !db.Migrator().HasColumn("b", "c") {
+		t.Fatal("b.c missing")
+	}
+
+	// Nothing left to apply
+	if err := m.Up(); err != nil {
+		t.Fatalf("second Up: %v", err)
+	}
+	expectActions(t, out)
+}
+
+func TestMigratorDownRollsBackNewestFirst(t *testing.T) {
+	db := newMigratorTestDB(t)
+	m, out := newTestMigrator(db, testMigrations())
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+
+	if err := m.Down(1); err != nil {
+		t.Fatalf("Down(1): %v", err)
+	}
+	expectActions(t, out, "down "+migrationC)
+	if db.Migrator().HasColumn("b", "c") || !db.Migrator().HasTable("b") {
+		t.Fatal("Down(1) did not roll back only the last migration")
+	}
+
+	// More than applied rolls back everything
+	if err := m.Down(10); err != nil {
+		t.Fatalf("Down(10): %v", err)
+	}
+	expectActions(t, out, "down "+migrationB, "down "+migrationA)
+	if got := appliedNames(t, db); len(got) != 0 || db.Migrator().HasTable("a") {
+		t.Fatalf("after Down(10) applied %v", got)
+	}
+
+	if err := m.Down(1); err != nil {
+		t.Fatalf("Down on an empty database: %v", err)
+	}
+	expectActions(t, out)
+}
+
+func TestMigratorGoto(t *testing.T) {
+	db := newMigratorTestDB(t)
+	m, out := newTestMigrator(db, testMigrations())
+
+	steps := []struct {
+		version string
+		actions []string
+		applied []string
+	}{
+		{"20240102000000", []string{"up " + migrationA, "up " + migrationB}, []string{migrationA, migrationB}},
+		// A full file name works as well
+		{migrationC, []string{"up " + migrationC}, []string{migrationA, migrationB, migrationC}},
+		{"20240101000000", []string{"down " + migrationC, "down " + migrationB}, []string{migrationA}},
+		{"20240101000000", nil, []string{migrationA}},
+		{"20240103000000", []string{"up " + migrationB, "up " + migrationC}, []string{migrationA, migrationB, migrationC}},
+		{"0", []string{"down " + migrationC, "down " + migrationB, "down " + migrationA}, nil},
+	}
+	for _, step := range steps {
+		if err := m.Goto(step.version); err != nil {
+			t.Fatalf("Goto(%s): %v", step.version, err)
+		}
+		expectActions(t, out, step.actions...)
+		if got := appliedNames(t, db); !reflect.DeepEqual(got, step.applied) && (len(got) != 0 || len(step.applied) != 0) {
+			t.Fatalf("after Goto(%s) applied %v, want %v", step.version, got, step.applied)
+		}
+	}
+
+	if err := m.Goto("20991231000000"); err == nil {
+		t.Fatal("Goto an unknown version succeeded")
+	}
+}
+
+func TestMigratorRedo(t *testing.T) {
+	db := newMigratorTestDB(t)
+	m, out := newTestMigrator(db, testMigrations())
+	if err := m.Redo(); err == nil {
+		t.Fatal("Redo without applied migrations succeeded")
+	}
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	db.Exec("INSERT INTO b (id, c) VALUES (1, 'kept until redo')")
+
+	if err := m.Redo(); err != nil {
+		t.Fatalf("Redo: %v", err)
+	}
+	expectActions(t, out, "down "+migrationC, "up "+migrationC)
+	if got := appliedNames(t, db); !reflect.DeepEqual(got, []string{migrationA, migrationB, migrationC}) {
+		t.Fatalf("applied %v", got)
+	}
+	var c *string
+	db.Raw("SELECT c FROM b WHERE id = 1").Scan(&c)
+	if c != nil {
+		t.Fatalf("b.c = %q, the column was not recreated", *c)
+	}
+}
+
+func TestMigratorMissingDownSection(t *testing.T) {
+	db := newMigratorTestDB(t)
+	fsys := testMigrations()
+	fsys[migrationC] = &fstest.MapFile{Data: []byte("-- Up\nALTER TABLE b ADD COLUMN c TEXT;\n-- Down\n-- nothing to undo\n")}
+	m, _ := newTestMigrator(db, fsys)
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, run := range map[string]func() error{
+		"Down": func() error { return m.Down(1) },
+		"Redo": m.Redo,
+		"Goto": func() error { return m.Goto("0") },
+	} {
+		if err := run(); !errors.Is(err, ErrNoDownSection) {
+			t.Errorf("%s = %v, want ErrNoDownSection", name, err)
+		}
+	}
+	if got := appliedNames(t, db); len(got) != 3 || !db.Migrator().HasColumn("b", "c") {
+		t.Fatalf("applied %v after failed rollbacks", got)
+	}
+}
+
+func TestMigratorFailedMigrationIsRolledBack(t *testing.T) {
+	db := newMigratorTestDB(t)
+	fsys := testMigrations()
+	fsys[migrationC] = &fstest.MapFile{Data: []byte("-- Up\nCREATE TABLE d (id INTEGER);\nALTER TABLE missing ADD COLUMN c TEXT;\n")}
+	m, _ := newTestMigrator(db, fsys)
+
+	if err := m.Up(); err == nil {
+		t.Fatal("Up with a failing statement succeeded")
+	}
+	if got := appliedNames(t, db); !reflect.DeepEqual(got, []string{migrationA, migrationB}) {
+		t.Fatalf("applied %v", got)
+	}
+	if db.Migrator().HasTable("d") {
+		t.Fatal("statement before the failure was kept")
+	}
+}
+
+func TestMigratorPrefersDialectDirectory(t *testing.T) {
+	db := newMigratorTestDB(t)
+	fsys := testMigrations()
+	fsys["sqlite/"+migrationA] = &fstest.MapFile{Data: []byte("-- Up\nCREATE TABLE dialect_only (id INTEGER);\n-- Down\nDROP TABLE dialect_only;\n")}
+	m, _ := newTestMigrator(db, fsys)
+
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	if got := appliedNames(t, db); !reflect.DeepEqual(got, []string{migrationA}) || !db.Migrator().HasTable("dialect_only") {
+		t.Fatalf("applied %v", got)
+	}
+}
+
+func TestMigratorDryRun(t *testing.T) {
+	db := newMigratorTestDB(t)
+	m, out := newTestMigrator(db, testMigrations())
+	m.DryRun = true
+
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	if db.Migrator().HasTable("a") || db.Migrator().HasTable("migrations") {
+		t.Fatal("dry run changed the database")
+	}
+	for _, want := range []string{"CREATE TABLE a (id INTEGER PRIMARY KEY);", "INSERT INTO migrations (name, applied_at, checksum) VALUES ('" + migrationC} {
+		if !bytes.Contains(out.Bytes(), []byte(want)) {
+			t.Errorf("dry run output misses %q", want)
+		}
+	}
+}
+
+// checksums returns the recorded checksum of each applied migration
+func checksums(t *testing.T, db *gorm.DB) map[string]string {
+	t.Helper()
+	var rows []Migration
+	if err := db.Find(&rows).Error; err != nil {
+		t.Fatal(err)
+	}
+	result := make(map[string]string, len(rows))
+	for _, row := range rows {
+		result[row.Name] = row.Checksum
+	}
+	return result
+}
+
+func TestMigratorDetectsModifiedMigrations(t *testing.T) {
+	db := newMigratorTestDB(t)
+	fsys := testMigrations()
+	m, out := newTestMigrator(db, fsys)
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Editing a Down section changes nothing that ran
+	fsys[migrationC] = &fstest.MapFile{Data: []byte("-- Up\nALTER TABLE b ADD COLUMN c TEXT;\n-- Down\nALTER TABLE b DROP COLUMN c;\nSELECT 1;\n")}
+	fsys[migrationB] = &fstest.MapFile{Data: []byte("-- Up\nCREATE TABLE b (id INTEGER PRIMARY KEY);\n-- Down\nDROP TABLE b;\n")}
+	out.Reset()
+
+	if err := m.Up(); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	if want := "WARNING: applied migrations were modified since they ran: " + migrationB + "\n"; !strings.Contains(out.String(), want) {
+		t.Fatalf("output %q misses %q", out.String(), want)
+	}
+	statuses, err := m.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, status := range statuses {
+		if status.Modified != (status.Name == migrationB) {
+			t.Errorf("%s modified = %v", status.Name, status.Modified)
+		}
+	}
+
+	m.Strict = true
+	for name, run := range map[string]func() error{
+		"Up":   m.Up,
+		"Down": func() error { return m.Down(1) },
+		"Goto": func() error { return m.Goto("0") },
+	} {
+		if err := run(); !errors.Is(err, ErrChecksumMismatch) {
+			t.Errorf("strict %s = %v, want ErrChecksumMismatch", name, err)
+		}
+	}
+	if got := appliedNames(t, db); len(got) != 3 {
+		t.Fatalf("applied %v after strict failures", got)
+	}
+}
+
+func TestMigratorChecksumBackfill(t *testing.T) {
+	db := newMigratorTestDB(t)
+	fsys := testMigrations()
+	m, out := newTestMigrator(db, fsys)
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	want := checksums(t, db)
+	// As recorded before checksums existed
+	forget := func() {
+		if err := db.Exec("UPDATE migrations SET checksum = ''").Error; err != nil {
+			t.Fatal(err)
+		}
+		out.Reset()
+	}
+	recorded := func() []string {
+		t.Helper()
+		lines := regexp.MustCompile(`(?m)^Recorded checksum of migration: (\S+)$`).FindAllStringSubmatch(out.String(), -1)
+		names := make([]string, len(lines))
+		for i, line := range lines {
+			names[i] = line[1]
+		}
+		out.Reset()
+		return names
+	}
+	all := []string{migrationA, migrationB, migrationC}
+
+	// Strict mode refuses to trust the files implicitly
+	forget()
+	m.Strict = true
+	if err := m.Up(); !errors.Is(err, ErrChecksumMissing) || !strings.Contains(err.Error(), "checksum --backfill") {
+		t.Fatalf("strict Up = %v, want ErrChecksumMissing", err)
+	}
+	for name, sum := range checksums(t, db) {
+		if sum != "" {
+			t.Fatalf("strict Up recorded the checksum of %s", name)
+		}
+	}
+
+	// The dry run only prints the updates
+	m.DryRun = true
+	if err := m.BackfillChecksums(); err != nil {
+		t.Fatalf("dry-run backfill: %v", err)
+	}
+	if n := strings.Count(out.String(), "UPDATE migrations SET checksum = "); n != 3 {
+		t.Fatalf("dry run printed %d updates:\n%s", n, out.String())
+	}
+	if checksums(t, db)[migrationA] != "" {
+		t.Fatal("dry run recorded a checksum")
+	}
+	m.DryRun = false
+	out.Reset()
+
+	if err := m.BackfillChecksums(); err != nil {
+		t.Fatalf("backfill: %v", err)
+	}
+	if got := recorded(); !reflect.DeepEqual(got, all) {
+		t.Fatalf("backfill logged %v", got)
+	}
+	if got := checksums(t, db); !reflect.DeepEqual(got, want) {
+		t.Fatalf("checksums %v, want %v", got, want)
+	}
+	if err := m.BackfillChecksums(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "Every applied migration has a checksum") {
+		t.Fatalf("second backfill printed %q", out.String())
+	}
+	if err := m.Up(); err != nil {
+		t.Fatalf("strict Up after the backfill: %v", err)
+	}
+
+	// Outside strict mode every command backfills, logging each row
+	forget()
+	m.Strict = false
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	if got := recorded(); !reflect.DeepEqual(got, all) {
+		t.Fatalf("Up logged %v", got)
+	}
+	if got := checksums(t, db); !reflect.DeepEqual(got, want) {
+		t.Fatalf("checksums %v, want %v", got, want)
+	}
+
+	// Backfilled checksums catch later edits
+	fsys[migrationA] = &fstest.MapFile{Data: []byte("-- Up\nCREATE TABLE a (id INTEGER);\n-- Down\nDROP TABLE a;\n")}
+	m.Strict = true
+	if err := m.Up(); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("strict Up after an edit = %v", err)
+	}
+}
@@ -0,0 +1,245 @@
+package database
+
+import (
+	"strings"
+)
+
+// sqlSplitter splits a migration into statements. It understands quoted
+// strings and identifiers, line and block comments, PostgreSQL dollar quoting
+// and delimiter directives, so semicolons inside any of them do not end a
+// statement.
+//
+// The delimiter can be changed for procedure and trigger bodies with a line
+// of its own, either "-- +Delimiter //" or the mysql client's "DELIMITER //",
+// and restored the same way with ";".
+type sqlSplitter struct {
+	// backslashEscapes makes a backslash escape the next character inside
+	// quotes, as MySQL does. PostgreSQL only does so in E'...' strings.
+	backslashEscapes bool
+	// hashComments treats "#" at the start of a line as a comment, as MySQL
+	// does. It is an operator in PostgreSQL.
+	hashComments bool
+	// escapeStrings recognizes E'...' strings, in which a backslash escapes
+	// the next character. MySQL has no such syntax, E is an identifier there.
+	escapeStrings bool
+
+	src       string
+	pos       int
+	delimiter string
+	buf       strings.Builder
+	hasCode   bool // buf holds more than comments and whitespace
+	result    []string
+}
+
+// splitSQLStatements splits a SQL string into individual statements, using
+// the quoting rules of the given driver
+func splitSQLStatements(sql, driver string) []string {
+	mysql := driver == DriverMySQL
+	s := &sqlSplitter{backslashEscapes: mysql, hashComments: mysql, escapeStrings: !mysql}
+	return s.split(sql)
+}
+
+func (s *sqlSplitter) split(sql string) []string {
+	s.src = sql
+	s.pos = 0
+	s.delimiter = ";"
+	s.buf.Reset()
+	s.hasCode = false
+	s.result = nil
+
+	for s.pos < len(s.src) {
+		if s.atLineStart() && s.directive() {
+			continue
+		}
+		if strings.HasPrefix(s.src[s.pos:], s.delimiter) {
+			s.flush()
+			s.pos += len(s.delimiter)
+			continue
+		}
+
+		c := s.src[s.pos]
+		switch {
+		case c == '-' && s.peek(1) == '-':
+			s.lineComment()
+		case c == '#' && s.hashComments && s.onlySpaceBefore():
+			s.lineComment()
+		case c == '/' && s.peek(1) == '*':
+			s.blockComment()
+		case c == '\'' || c == '"' || c == '`':
+			escapes := s.backslashEscapes && c != '`'
+			if c == '\'' && s.escapeStrings && s.pos > 0 && (s.src[s.pos-1] == 'E' || s.src[s.pos-1] == 'e') &&
+				(s.pos == 1 || !isIdentChar(s.src[s.pos-2])) {
+				escapes = true // PostgreSQL escape string E'...'
+			}
+			s.quoted(c, escapes)
+		case c == '$':
+			if !s.dollarQuoted() {
+				s.code(1)
+			}
+		default:
+			if c == ' ' || c == '\t' || c == '\r' || c == '\n' {
+				s.buf.WriteByte(c)
+				s.pos++
+			} else {
+				s.code(1)
+			}
+		}
+	}
+	s.flush()
+	return s.result
+}
+
+func (s *sqlSplitter) peek(offset int) byte {
+	if s.pos+offset < len(s.src) {
+		return s.src[s.pos+offset]
+	}
+	return 0
+}
+
+func (s *sqlSplitter) atLineStart() bool {
+	return s.pos == 0 || s.src[s.pos-1] == '\n'
+}
+
+// onlySpaceBefore reports whether the current character starts its line, ignoring indentation
+func (s *sqlSplitter) onlySpaceBefore() bool {
+	for i := s.pos - 1; i >= 0; i-- {
+		switch s.src[i] {
+		case '\n':
+			return true
+		case ' ', '\t', '\r':
+			continue
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// code copies n bytes of SQL into the current statement
+func (s *sqlSplitter) code(n int) {
+	if s.pos+n > len(s.src) {
+		n = len(s.src) - s.pos
+	}
+	s.buf.WriteString(s.src[s.pos : s.pos+n])
+	s.pos += n
+	s.hasCode = true
+}
+
+// comment copies a comment, leading comments of a statement are dropped
+func (s *sqlSplitter) comment(end int) {
+	if s.hasCode {
+		s.buf.WriteString(s.src[s.pos:end])
+	}
+	s.pos = end
+}
+
+// directive handles a delimiter line, reporting whether it consumed one
+func (s *sqlSplitter) directive() bool {
+	end := strings.IndexByte(s.src[s.pos:], '\n')
+	if end < 0 {
+		end = len(s.src)
+	} else {
+		end += s.pos
+	}
+	fields := strings.Fields(s.src[s.pos:end])
+
+	var delimiter string
+	switch {
+	case len(fields) == 3 && fields[0] == "--" && strings.EqualFold(fields[1], "+Delimiter"):
+		delimiter = fields[2]
+	case len(fields) == 2 && strings.EqualFold(fields[0], "DELIMITER") && !s.hasCode:
+		delimiter = fields[1]
+	default:
+		return false
+	}
+
+	s.flush()
+	s.delimiter = delimiter
+	s.pos = end
+	return true
+}
+
+func (s *sqlSplitter) lineComment() {
+	end := strings.IndexByte(s.src[s.pos:], '\n')
+	if end < 0 {
+		s.comment(len(s.src))
+		return
+	}
+	s.comment(s.pos + end)
+}
+
+func (s *sqlSplitter) blockComment() {
+	end := strings.Index(s.src[s.pos+2:], "*/")
+	if end < 0 {
+		s.comment(len(s.src))
+		return
+	}
+	end += s.pos + 4
+	// MySQL runs the content of /*! ... */ comments, keep them as code
+	if s.peek(2) == '!' {
+		s.code(end - s.pos)
+		return
+	}
+	s.comment(end)
+}
+
+// quoted copies a quoted string or identifier, a doubled quote stands for itself
+func (s *sqlSplitter) quoted(quote byte, escapes bool) {
+	i := s.pos + 1
+	for i < len(s.src) {
+		switch c := s.src[i]; {
+		case escapes && c == '\\':
+			i += 2
+			continue
+		case c == quote:
+			if i+1 < len(s.src) && s.src[i+1] == quote {
+				i += 2
+				continue
+			}
+			s.code(i + 1 - s.pos)
+			return
+		}
+		i++
+	}
+	s.code(len(s.src) - s.pos)
+}
+
+// dollarQuoted copies a PostgreSQL $tag$ ... $tag$ string, reporting whether one starts here
+func (s *sqlSplitter) dollarQuoted() bool {
+	if s.pos > 0 && isIdentChar(s.src[s.pos-1]) {
+		return false
+	}
+	i := s.pos + 1
+	for i < len(s.src) && s.src[i] != '$' {
+		c := s.src[i]
+		if !isIdentChar(c) || (i == s.pos+1 && c >= '0' && c <= '9') {
+			return false // $1 parameters and plain dollars
+		}
+		i++
+	}
+	if i >= len(s.src) {
+		return false
+	}
+
+	tag := s.src[s.pos : i+1]
+	end := strings.Index(s.src[i+1:], tag)
+	if end < 0 {
+		s.code(len(s.src) - s.pos)
+		return true
+	}
+	s.code(i + 1 + end + len(tag) - s.pos)
+	return true
+}
+
+// flush ends the current statement, dropping it when it holds no code
+func (s *sqlSplitter) flush() {
+	if s.hasCode {
+		s.result = append(s.result, strings.TrimSpace(s.buf.String()))
+	}
+	s.buf.Reset()
+	s.hasCode = false
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c == '$' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
@@ -0,0 +1,254 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitSQLStatements(t *testing.T) {
+	tests := []struct {
+		name   string
+		driver string
+		sql    string
+		want   []string
+	}{
+		{
+			name:   "plain statements",
+			driver: DriverMySQL,
+			sql:    "CREATE TABLE a (id int);\nINSERT INTO a VALUES (1);\n",
+			want:   []string{"CREATE TABLE a (id int)", "INSERT INTO a VALUES (1)"},
+		},
+		{
+			name:   "missing final delimiter",
+			driver: DriverPostgres,
+			sql:    "SELECT 1; SELECT 2",
+			want:   []string{"SELECT 1", "SELECT 2"},
+		},
+		{
+			name:   "only comments and whitespace",
+			driver: DriverMySQL,
+			sql:    "-- nothing here;\n/* or; here */\n  ;\n",
+			want:   nil,
+		},
+
+		// Quotes
+		{
+			name:   "semicolon in single quotes",
+			driver: DriverMySQL,
+			sql:    "INSERT INTO t VALUES ('a;b'); SELECT 2",
+			want:   []string{"INSERT INTO t VALUES ('a;b')", "SELECT 2"},
+		},
+		{
+			name:   "semicolon in double quotes",
+			driver: DriverPostgres,
+			sql:    `CREATE TABLE "a;b" (id int); SELECT 2`,
+			want:   []string{`CREATE TABLE "a;b" (id int)`, "SELECT 2"},
+		},
+		{
+			name:   "semicolon in backticks",
+			driver: DriverMySQL,
+			sql:    "CREATE TABLE `a;b` (id int); SELECT 2",
+			want:   []string{"CREATE TABLE `a;b` (id int)", "SELECT 2"},
+		},
+		{
+			name:   "doubled single quote",
+			driver: DriverSQLite,
+			sql:    "SELECT 'it''s; fine'; SELECT 2",
+			want:   []string{"SELECT 'it''s; fine'", "SELECT 2"},
+		},
+		{
+			name:   "doubled double quote",
+			driver: DriverPostgres,
+			sql:    `SELECT "a""; b"; SELECT 2`,
+			want:   []string{`SELECT "a""; b"`, "SELECT 2"},
+		},
+		{
+			name:   "doubled backtick",
+			driver: DriverMySQL,
+			sql:    "SELECT `a``; b`; SELECT 2",
+			want:   []string{"SELECT `a``; b`", "SELECT 2"},
+		},
+
+		// Backslash escapes
+		{
+			name:   "backslash escape in mysql",
+			driver: DriverMySQL,
+			sql:    `SELECT 'it\'s; fine'; SELECT 2`,
+			want:   []string{`SELECT 'it\'s; fine'`, "SELECT 2"},
+		},
+		{
+			name:   "backslash escape in mysql double quotes",
+			driver: DriverMySQL,
+			sql:    `SELECT "say \"hi;\""; SELECT 2`,
+			want:   []string{`SELECT "say \"hi;\""`, "SELECT 2"},
+		},
+		{
+			name:   "backslash is literal in postgres",
+			driver: DriverPostgres,
+			sql:    `SELECT 'C:\'; SELECT 2`,
+			want:   []string{`SELECT 'C:\'`, "SELECT 2"},
+		},
+		{
+			name:   "backslash is literal in sqlite",
+			driver: DriverSQLite,
+			sql:    `SELECT 'C:\'; SELECT 2`,
+			want:   []string{`SELECT 'C:\'`, "SELECT 2"},
+		},
+		{
+			name:   "backslash is literal in mysql backticks",
+			driver: DriverMySQL,
+			sql:    "SELECT 1 AS `a\\`; SELECT 2",
+			want:   []string{"SELECT 1 AS `a\\`", "SELECT 2"},
+		},
+		{
+			name:   "postgres escape string",
+			driver: DriverPostgres,
+			sql:    `SELECT E'it\'s; fine', e'\\'; SELECT 2`,
+			want:   []string{`SELECT E'it\'s; fine', e'\\'`, "SELECT 2"},
+		},
+		{
+			name:   "identifier ending in e is not an escape string",
+			driver: DriverPostgres,
+			sql:    `SELECT 1 AS name'\'; SELECT 2`,
+			want:   []string{`SELECT 1 AS name'\'`, "SELECT 2"},
+		},
+
+		// Dollar quoting
+		{
+			name:   "dollar quoted body",
+			driver: DriverPostgres,
+			sql:    "CREATE FUNCTION f() RETURNS int AS $$ BEGIN RETURN 1; END $$ LANGUAGE plpgsql; SELECT 2",
+			want:   []string{"CREATE FUNCTION f() RETURNS int AS $$ BEGIN RETURN 1; END $$ LANGUAGE plpgsql", "SELECT 2"},
+		},
+		{
+			name:   "tagged dollar quotes nest plain ones",
+			driver: DriverPostgres,
+			sql:    "DO $body$ BEGIN EXECUTE $$SELECT 1;$$; END $body$; SELECT 2",
+			want:   []string{"DO $body$ BEGIN EXECUTE $$SELECT 1;$$; END $body$", "SELECT 2"},
+		},
+		{
+			name:   "positional parameters are not dollar quotes",
+			driver: DriverPostgres,
+			sql:    "PREPARE p AS SELECT $1, $2; SELECT 2",
+			want:   []string{"PREPARE p AS SELECT $1, $2", "SELECT 2"},
+		},
+		{
+			name:   "dollar inside an identifier",
+			driver: DriverPostgres,
+			sql:    "SELECT a$b$c FROM t; SELECT 2",
+			want:   []string{"SELECT a$b$c FROM t", "SELECT 2"},
+		},
+
+		// Comments
+		{
+			name:   "line comment",
+			driver: DriverPostgres,
+			sql:    "-- setup; first\nSELECT 1 -- one; two\n; SELECT 2",
+			want:   []string{"SELECT 1 -- one; two", "SELECT 2"},
+		},
+		{
+			name:   "hash comment in mysql",
+			driver: DriverMySQL,
+			sql:    "SELECT 1;\n  # note; here\nSELECT 2",
+			want:   []string{"SELECT 1", "SELECT 2"},
+		},
+		{
+			name:   "hash is an operator in postgres",
+			driver: DriverPostgres,
+			sql:    "SELECT 1\n# 2; SELECT 3",
+			want:   []string{"SELECT 1\n# 2", "SELECT 3"},
+		},
+		{
+			name:   "block comment",
+			driver: DriverSQLite,
+			sql:    "/* setup; */ SELECT 1; SELECT /* a;b */ 2",
+			want:   []string{"SELECT 1", "SELECT /* a;b */ 2"},
+		},
+		{
+			name:   "mysql executable comment",
+			driver: DriverMySQL,
+			sql:    "/*!40101 SET NAMES utf8; */; SELECT 2",
+			want:   []string{"/*!40101 SET NAMES utf8; */", "SELECT 2"},
+		},
+
+		// Delimiter directives
+		{
+			name:   "goose style delimiter",
+			driver: DriverMySQL,
+			sql: "-- +Delimiter //\n" +
+				"CREATE TRIGGER t BEFORE INSERT ON a FOR EACH ROW BEGIN SET NEW.x = 1; SET NEW.y = 2; END //\n" +
+				"-- +Delimiter ;\n" +
+				"SELECT 1; SELECT 2;",
+			want: []string{
+				"CREATE TRIGGER t BEFORE INSERT ON a FOR EACH ROW BEGIN SET NEW.x = 1; SET NEW.y = 2; END",
+				"SELECT 1",
+				"SELECT 2",
+			},
+		},
+		{
+			name:   "mysql client delimiter",
+			driver: DriverMySQL,
+			sql: "DELIMITER $$\n" +
+				"CREATE PROCEDURE p() BEGIN SELECT 1; SELECT 2; END$$\n" +
+				"DELIMITER ;\n" +
+				"SELECT 3;",
+			want: []string{"CREATE PROCEDURE p() BEGIN SELECT 1; SELECT 2; END", "SELECT 3"},
+		},
+		{
+			name:   "delimiter word inside a statement",
+			driver: DriverMySQL,
+			sql:    "SELECT 1 AS x,\nDELIMITER ;\nSELECT 2",
+			want:   []string{"SELECT 1 AS x,\nDELIMITER", "SELECT 2"},
+		},
+
+		// Unterminated input keeps the rest as one statement
+		{
+			name:   "unterminated single quote",
+			driver: DriverMySQL,
+			sql:    "SELECT 1; SELECT 'abc; SELECT 2",
+			want:   []string{"SELECT 1", "SELECT 'abc; SELECT 2"},
+		},
+		{
+			name:   "unterminated escape at end",
+			driver: DriverMySQL,
+			sql:    `SELECT 'abc\`,
+			want:   []string{`SELECT 'abc\`},
+		},
+		{
+			name:   "unterminated double quote",
+			driver: DriverPostgres,
+			sql:    `SELECT "abc; SELECT 2`,
+			want:   []string{`SELECT "abc; SELECT 2`},
+		},
+		{
+			name:   "unterminated dollar quote",
+			driver: DriverPostgres,
+			sql:    "SELECT $tag$abc; SELECT 2",
+			want:   []string{"SELECT $tag$abc; SELECT 2"},
+		},
+		{
+			name:   "unterminated block comment",
+			driver: DriverSQLite,
+			sql:    "SELECT 1; SELECT 2 /* never; closed",
+			want:   []string{"SELECT 1", "SELECT 2 /* never; closed"},
+		},
+		{
+			name:   "unterminated leading block comment",
+			driver: DriverSQLite,
+			sql:    "SELECT 1; /* never; closed",
+			want:   []string{"SELECT 1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitSQLStatements(tt.sql, tt.driver)
+			if len(got) == 0 && len(tt.want) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitSQLStatements(%q, %s)\n got %q\nwant %q", tt.sql, tt.driver, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package events
+
+import (
+	"context"
+	"sync"
+)
+
+// Event is a real-time message together with who it is routed to.
+// Every API instance receives every event and delivers it to its own connections.
+type Event struct {
+	ID       uint64      `json:"id"` // assigned by the bus, increases with every event
+	Type     string      `json:"type"`
+	Payload  interface{} `json:"payload"`
+	Resource string      `json:"resource,omitempty"` // scope resource an API key needs to read it
+	UserIDs  []uint      `json:"user_ids,omitempty"`
+	Topics   []string    `json:"topics,omitempty"`
+}
+
+// Handler receives the events published on a bus
+type Handler func(Event)
+
+// Bus fans events out to every subscribed API instance. Publish assigns the
+// event ID, and handlers receive events in ID order.
+type Bus interface {
+	Publish(ctx context.Context, event Event) error
+	Subscribe(handler Handler)
+	Close() error
+}
+
+// subscribers is the handler list shared by the bus implementations
+type subscribers struct {
+	mu       sync.RWMutex
+	handlers []Handler
+}
+
+func (s *subscribers) Subscribe(handler Handler) {
+	s.mu.Lock()
+	s.handlers = append(s.handlers, handler)
+	s.mu.Unlock()
+}
+
+func (s *subscribers) dispatch(event Event) {
+	s.mu.RLock()
+	handlers := s.handlers
+	s.mu.RUnlock()
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
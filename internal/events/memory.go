@@ -0,0 +1,34 @@
+package events
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryBus delivers events within the current process, for single instance deployments.
+// IDs restart from 1 with the process.
+type MemoryBus struct {
+	subscribers
+	mu     sync.Mutex
+	lastID uint64
+}
+
+// NewMemoryBus creates an in-process bus
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{}
+}
+
+// Publish hands the event to every handler before returning.
+// Handlers run under the lock so concurrent publishes are seen in ID order.
+func (b *MemoryBus) Publish(ctx context.Context, event Event) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lastID++
+	event.ID = b.lastID
+	b.dispatch(event)
+	return nil
+}
+
+func (b *MemoryBus) Close() error {
+	return nil
+}
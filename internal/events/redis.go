@@ -0,0 +1,108 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultRedisChannel is the pub/sub channel events are exchanged on
+const DefaultRedisChannel = "mywall:events"
+
+// publishScript takes the next ID and publishes in one step, so IDs reach
+// subscribers in order even when several instances publish at once.
+// Messages are the ID, a space and the JSON event.
+var publishScript = redis.NewScript(`
+local id = redis.call('INCR', KEYS[1])
+redis.call('PUBLISH', ARGV[1], id .. ' ' .. ARGV[2])
+return id
+`)
+
+// RedisBus exchanges events between API instances over Redis pub/sub.
+// Instances only deliver what they receive from Redis, including their own
+// events, so every instance sees events in the same order.
+type RedisBus struct {
+	subscribers
+	client  *redis.Client
+	pubsub  *redis.PubSub
+	channel string
+	done    chan struct{}
+}
+
+// NewRedisBus connects to the Redis URL (redis://host:6379/0) and subscribes to channel
+func NewRedisBus(ctx context.Context, url, channel string) (*RedisBus, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis url: %w", err)
+	}
+	if channel == "" {
+		channel = DefaultRedisChannel
+	}
+
+	client := redis.NewClient(opts)
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
+	}
+
+	// Wait for the subscription to be confirmed so no event published after this returns is missed
+	pubsub := client.Subscribe(ctx, channel)
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		client.Close()
+		return nil, fmt.Errorf("failed to subscribe to %s: %w", channel, err)
+	}
+
+	b := &RedisBus{
+		client:  client,
+		pubsub:  pubsub,
+		channel: channel,
+		done:    make(chan struct{}),
+	}
+	go b.run()
+	return b, nil
+}
+
+// Publish sends the event to every instance, this one included.
+// The ID counter lives in Redis under "<channel>:seq".
+func (b *RedisBus) Publish(ctx context.Context, event Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return publishScript.Run(ctx, b.client, []string{b.channel + ":seq"}, b.channel, data).Err()
+}
+
+// run dispatches received events, go-redis resubscribes by itself after a reconnect
+func (b *RedisBus) run() {
+	defer close(b.done)
+	for msg := range b.pubsub.Channel() {
+		rawID, data, _ := strings.Cut(msg.Payload, " ")
+		id, err := strconv.ParseUint(rawID, 10, 64)
+		if err != nil {
+			log.Printf("Invalid event ID on %s: %q", b.channel, rawID)
+			continue
+		}
+		var event Event
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			log.Printf("Invalid event on %s: %v", b.channel, err)
+			continue
+		}
+		event.ID = id
+		b.dispatch(event)
+	}
+}
+
+func (b *RedisBus) Close() error {
+	err := b.pubsub.Close()
+	<-b.done
+	if cerr := b.client.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
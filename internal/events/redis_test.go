@@ -0,0 +1,149 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisURL returns REDIS_URL, the tests need a real server and are skipped without one
+func redisURL(t *testing.T) string {
+	t.Helper()
+	url := os.Getenv("REDIS_URL")
+	if url == "" {
+		t.Skip("REDIS_URL not set")
+	}
+	return url
+}
+
+// testChannel is unique per test so runs do not see each other's events
+func testChannel(t *testing.T) string {
+	return fmt.Sprintf("mywall:test:%s:%d", t.Name(), time.Now().UnixNano())
+}
+
+func newTestRedisBus(t *testing.T, url, channel string) (*RedisBus, <-chan Event) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	bus, err := NewRedisBus(ctx, url, channel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		bus.client.Del(context.Background(), channel+":seq")
+		bus.Close()
+	})
+	received := make(chan Event, 1000)
+	bus.Subscribe(func(event Event) { received <- event })
+	return bus, received
+}
+
+// receiveN waits for n events or fails the test
+func receiveN(t *testing.T, received <-chan Event, n int) []Event {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	var got []Event
+	for len(got) < n {
+		select {
+		case event := <-received:
+			got = append(got, event)
+		case <-timeout:
+			t.Fatalf("received %d of %d events", len(got), n)
+		}
+	}
+	return got
+}
+
+func TestRedisBusDeliversToEveryInstance(t *testing.T) {
+	url, channel := redisURL(t), testChannel(t)
+	a, fromA := newTestRedisBus(t, url, channel)
+	_, fromB := newTestRedisBus(t, url, channel)
+
+	event := Event{Type: "notification", Payload: "hello", Resource: "notifications", UserIDs: []uint{7}, Topics: []string{"notifications"}}
+	if err := a.Publish(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+
+	// The publishing instance only delivers what comes back from Redis
+	gotA, gotB := receiveN(t, fromA, 1)[0], receiveN(t, fromB, 1)[0]
+	if gotA.ID == 0 || gotA.ID != gotB.ID {
+		t.Fatalf("IDs = %d and %d, want the same non-zero ID", gotA.ID, gotB.ID)
+	}
+	if gotB.Type != event.Type || gotB.Payload != "hello" || len(gotB.UserIDs) != 1 || gotB.UserIDs[0] != 7 {
+		t.Fatalf("received %+v", gotB)
+	}
+}
+
+func TestRedisBusOrdersConcurrentPublishes(t *testing.T) {
+	url, channel := redisURL(t), testChannel(t)
+	a, fromA := newTestRedisBus(t, url, channel)
+	b, fromB := newTestRedisBus(t, url, channel)
+
+	// INCR and PUBLISH run as one script, so concurrent publishers never
+	// deliver IDs out of order
+	const perBus = 50
+	var wg sync.WaitGroup
+	for _, bus := range []*RedisBus{a, b} {
+		wg.Add(1)
+		go func(bus *RedisBus) {
+			defer wg.Done()
+			for i := 0; i < perBus; i++ {
+				if err := bus.Publish(context.Background(), Event{Type: "tick"}); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(bus)
+	}
+	wg.Wait()
+
+	gotA, gotB := receiveN(t, fromA, 2*perBus), receiveN(t, fromB, 2*perBus)
+	for i := range gotA {
+		if i > 0 && gotA[i].ID != gotA[i-1].ID+1 {
+			t.Fatalf("event %d has ID %d after %d", i, gotA[i].ID, gotA[i-1].ID)
+		}
+		if gotA[i].ID != gotB[i].ID {
+			t.Fatalf("event %d: instance A saw ID %d, B saw %d", i, gotA[i].ID, gotB[i].ID)
+		}
+	}
+}
+
+func TestRedisBusResubscribesAfterReconnect(t *testing.T) {
+	url, channel := redisURL(t), testChannel(t)
+	bus, received := newTestRedisBus(t, url, channel)
+
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin := redis.NewClient(opts)
+	defer admin.Close()
+
+	// Drop the subscriber connection, go-redis reconnects and subscribes again
+	if err := admin.ClientKillByFilter(context.Background(), "TYPE", "pubsub").Err(); err != nil {
+		t.Fatalf("CLIENT KILL: %v", err)
+	}
+
+	// Events published while the subscription is down are lost, keep
+	// publishing until one arrives
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		if err := bus.Publish(context.Background(), Event{Type: "after_reconnect"}); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case event := <-received:
+			if event.Type != "after_reconnect" {
+				t.Fatalf("received %+v", event)
+			}
+			return
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+	t.Fatal("no event received after the connection was killed")
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ApiKey represents a named API key, only its hash is stored
+type ApiKey struct {
+	gorm.Model
+	UserID     uint       `json:"user_id" gorm:"not null;index"`
+	Name       string     `json:"name" gorm:"not null"`
+	Prefix     string     `json:"prefix" gorm:"size:12;not null"`
+	KeyHash    string     `json:"-" gorm:"size:64;not null;unique"`
+	Scopes     string     `json:"scopes"` // Comma separated, e.g. "galleries:read,categories:*"
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	IsActive   bool       `json:"is_active" gorm:"default:true"`
+}
+
+// TableName specifies the table name for ApiKey
+func (ApiKey) TableName() string {
+	return "api_keys"
+}
+
+// ScopeList returns the key scopes as a slice
+func (k ApiKey) ScopeList() []string {
+	var scopes []string
+	for _, scope := range strings.Split(k.Scopes, ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
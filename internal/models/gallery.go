@@ -1,6 +1,10 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"encoding/json"
+
+	"gorm.io/gorm"
+)
 
 // Gallery represents the gallery item
 type Gallery struct {
@@ -8,6 +12,20 @@ type Gallery struct {
 	Title       string `json:"title" gorm:"unique"`
 	Description string `json:"description"`
 	ImageURL    string `json:"image_url" gorm:"not null"`
+	Renditions  string `json:"renditions"` // JSON map of rendition name to storage key
 	CategoryID  uint   `json:"category_id" gorm:"not null"`
 	UserID      uint    `json:"user_id"`
 }
+
+// RenditionKey returns the storage key of a rendition, "original" or an empty name is the uploaded file
+func (g Gallery) RenditionKey(name string) (string, bool) {
+	if name == "" || name == "original" {
+		return g.ImageURL, true
+	}
+	renditions := map[string]string{}
+	if g.Renditions != "" {
+		json.Unmarshal([]byte(g.Renditions), &renditions)
+	}
+	key, ok := renditions[name]
+	return key, ok
+}
@@ -1,15 +1,22 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 // Notification represents the notification item
 type Notification struct {
 	gorm.Model
 	ID          string `json:"id" gorm:"primaryKey"`
-	Title       string `json:"title" gorm:"unique"`
+	Title       string `json:"title"`
 	Body        string `json:"body"`
 	Metadata    string `json:"metadata"`
 	Type        string `json:"type" gorm:"not null"`
 	IsRead      int    `json:"is_read" gorm:"default:0"`
 	UserID      uint    `json:"user_id"`
+	ArchivedAt  *time.Time `json:"archived_at"`
+	Count       int        `json:"count" gorm:"default:1"` // Events coalesced into this notification
+	ExpiresAt   *time.Time `json:"expires_at" gorm:"index"` // Hidden after this time, then purged
 }
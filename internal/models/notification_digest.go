@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Digest frequencies
+const (
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+)
+
+// NotificationDigest subscribes a user to a periodic summary of their notifications
+type NotificationDigest struct {
+	gorm.Model
+	UserID     uint       `json:"user_id" gorm:"not null;unique"`
+	Frequency  string     `json:"frequency" gorm:"size:10;not null"`
+	NextRunAt  time.Time  `json:"next_run_at" gorm:"not null;index"`
+	LastSentAt *time.Time `json:"last_sent_at"`
+}
+
+// TableName specifies the table name for NotificationDigest
+func (NotificationDigest) TableName() string {
+	return "notification_digests"
+}
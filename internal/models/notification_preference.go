@@ -0,0 +1,56 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// NotificationTypeDefault is the preference type used for types without their own row
+const NotificationTypeDefault = "*"
+
+// NotificationPreference controls how one notification type reaches a user
+type NotificationPreference struct {
+	gorm.Model
+	UserID     uint   `json:"user_id" gorm:"not null;uniqueIndex:unique_user_type"`
+	Type       string `json:"type" gorm:"size:100;not null;uniqueIndex:unique_user_type"`
+	InApp      bool   `json:"in_app"`
+	Email      bool   `json:"email"`
+	Webhook    bool   `json:"webhook"`
+	WebhookURL string `json:"webhook_url" gorm:"size:500"`
+	Muted      bool   `json:"muted"` // Muted types are neither stored nor delivered
+}
+
+// TableName specifies the table name for NotificationPreference
+func (NotificationPreference) TableName() string {
+	return "notification_preferences"
+}
+
+// DefaultNotificationPreference is used when the user has not set any preference
+func DefaultNotificationPreference(userID uint, notifType string) NotificationPreference {
+	return NotificationPreference{UserID: userID, Type: notifType, InApp: true}
+}
+
+// Delivery statuses
+const (
+	DeliveryPending = "pending"
+	DeliverySent    = "sent"
+	DeliveryFailed  = "failed"
+)
+
+// NotificationDelivery logs the delivery of a notification through one channel
+type NotificationDelivery struct {
+	gorm.Model
+	NotificationID string     `json:"notification_id" gorm:"size:36;not null;index"`
+	UserID         uint       `json:"user_id" gorm:"not null;index"`
+	Channel        string     `json:"channel" gorm:"size:20;not null"`
+	Status         string     `json:"status" gorm:"size:20;not null"`
+	Attempts       int        `json:"attempts"`
+	LastError      string     `json:"last_error" gorm:"type:text"`
+	DeliveredAt    *time.Time `json:"delivered_at"`
+}
+
+// TableName specifies the table name for NotificationDelivery
+func (NotificationDelivery) TableName() string {
+	return "notification_deliveries"
+}
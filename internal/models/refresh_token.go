@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Refresh token revoke reasons
+const (
+	RevokedRotated  = "rotated"  // Replaced by its successor
+	RevokedLogout   = "logout"   // The session was ended by its user
+	RevokedReuse    = "reuse"    // A rotated token of the family came back
+	RevokedInactive = "inactive" // The user was deactivated
+)
+
+// RefreshToken represents an opaque refresh token, only its hash is stored
+type RefreshToken struct {
+	gorm.Model
+	UserID        uint       `json:"user_id" gorm:"not null;index"`
+	TokenHash     string     `json:"-" gorm:"size:64;not null;unique"`
+	FamilyID      string     `json:"family_id" gorm:"size:36;not null;index"`
+	ExpiresAt     time.Time  `json:"expires_at" gorm:"not null"`
+	RevokedAt     *time.Time `json:"revoked_at"`
+	RevokedReason string     `json:"revoked_reason" gorm:"size:20"`
+	ReplacedByID  *uint      `json:"replaced_by_id"`
+}
+
+// TableName specifies the table name for RefreshToken
+func (RefreshToken) TableName() string {
+	return "refresh_tokens"
+}
+
+// Rotated reports whether the token was revoked because it was replaced. Rows
+// revoked before reasons were stored count as rotated when they have a successor.
+func (t RefreshToken) Rotated() bool {
+	if t.RevokedReason == "" {
+		return t.RevokedAt != nil && t.ReplacedByID != nil
+	}
+	return t.RevokedReason == RevokedRotated
+}
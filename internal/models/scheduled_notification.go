@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Scheduled notification statuses
+const (
+	ScheduledPending   = "pending"
+	ScheduledSending   = "sending"
+	ScheduledSent      = "sent"
+	ScheduledFailed    = "failed"
+	ScheduledCancelled = "cancelled"
+)
+
+// ScheduledNotification is a notification waiting for its send time, it becomes
+// a Notification once the scheduler delivers it
+type ScheduledNotification struct {
+	gorm.Model
+	UserID         uint       `json:"user_id" gorm:"not null;index"`
+	CreatedBy      uint       `json:"created_by" gorm:"not null;index"`
+	Title          string     `json:"title"`
+	Body           string     `json:"body"`
+	Type           string     `json:"type" gorm:"not null"`
+	Metadata       string     `json:"metadata"`
+	SendAt         time.Time  `json:"send_at" gorm:"not null;index"`
+	ExpiresAt      *time.Time `json:"expires_at"`
+	Status         string     `json:"status" gorm:"size:20;not null;index"`
+	NotificationID string     `json:"notification_id" gorm:"size:36"`
+	LastError      string     `json:"last_error" gorm:"type:text"`
+}
+
+// TableName specifies the table name for ScheduledNotification
+func (ScheduledNotification) TableName() string {
+	return "scheduled_notifications"
+}
@@ -8,9 +8,9 @@ type User struct {
 	Email        string `json:"email" gorm:"unique"`
 	Name         string `json:"name"`
 	Password     string `json:"-" gorm:"not null"` // Password hash
-	ApiKey       string `json:"api_key" gorm:"unique"`
 	Role         string `json:"role" gorm:"default:'user'"`
 	IsActive     bool   `json:"is_active" gorm:"default:true"`
+	Locale       string `json:"locale" gorm:"size:10;default:'en'"` // Language of notifications, e.g. "en" or "id"
 }
 
 // TableName specifies the table name for User
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// UserRole links a user to one of its roles
+type UserRole struct {
+	UserID     uint      `json:"user_id" gorm:"primaryKey"`
+	RoleID     string    `json:"role_id" gorm:"primaryKey;size:20"`
+	AssignedBy uint      `json:"assigned_by"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// TableName specifies the table name for UserRole
+func (UserRole) TableName() string {
+	return "user_roles"
+}
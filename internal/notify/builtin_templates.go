@@ -0,0 +1,45 @@
+package notify
+
+// Event types of the notifications the API creates
+const (
+	EventGalleryCreated = "gallery.created"
+	EventDigestDaily    = "digest.daily"
+	EventDigestWeekly   = "digest.weekly"
+)
+
+// BatchSuffix names the template used once several events coalesced into one
+// notification, e.g. "gallery.created.batch"; the data then carries a count
+const BatchSuffix = ".batch"
+
+// builtinTemplates holds the title and body of each event type, by locale
+var builtinTemplates = map[string]map[string][2]string{
+	EventGalleryCreated: {
+		"en": {"Gallery Created", `Your gallery "{{.title}}" has been created.`},
+		"id": {"Galeri Dibuat", `Galeri "{{.title}}" berhasil dibuat.`},
+	},
+	EventGalleryCreated + BatchSuffix: {
+		"en": {"{{.count}} Galleries Created", `{{.count}} galleries have been created, the latest is "{{.title}}".`},
+		"id": {"{{.count}} Galeri Dibuat", `{{.count}} galeri berhasil dibuat, terbaru "{{.title}}".`},
+	},
+	EventDigestDaily: {
+		"en": {"Your daily digest", "{{.count}} new {{plural .count \"notification\" \"notifications\"}} since yesterday:{{range .items}}\n- {{.}}{{end}}"},
+		"id": {"Ringkasan harian Anda", "{{.count}} notifikasi baru sejak kemarin:{{range .items}}\n- {{.}}{{end}}"},
+	},
+	EventDigestWeekly: {
+		"en": {"Your weekly digest", "{{.count}} new {{plural .count \"notification\" \"notifications\"}} since last week:{{range .items}}\n- {{.}}{{end}}"},
+		"id": {"Ringkasan mingguan Anda", "{{.count}} notifikasi baru sejak minggu lalu:{{range .items}}\n- {{.}}{{end}}"},
+	},
+}
+
+// DefaultTemplates returns a registry with the built-in templates
+func DefaultTemplates() *Templates {
+	r := NewTemplates()
+	for eventType, byLocale := range builtinTemplates {
+		for locale, t := range byLocale {
+			if err := r.Register(eventType, locale, t[0], t[1]); err != nil {
+				panic(err)
+			}
+		}
+	}
+	return r
+}
@@ -0,0 +1,65 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Channel names, in_app is handled by the API through WebSocket and SSE
+const (
+	ChannelInApp   = "in_app"
+	ChannelEmail   = "email"
+	ChannelWebhook = "webhook"
+)
+
+// ErrNoAddress means the recipient has no address for a channel, retrying will not help
+var ErrNoAddress = errors.New("recipient has no address for this channel")
+
+// Message is the notification handed to a channel
+type Message struct {
+	NotificationID string                 `json:"id"`
+	UserID         uint                   `json:"user_id"`
+	Type           string                 `json:"type"`
+	Title          string                 `json:"title"`
+	Body           string                 `json:"body"`
+	Metadata       map[string]interface{} `json:"metadata,omitempty"`
+	CreatedAt      time.Time              `json:"created_at"`
+}
+
+// Recipient holds the addresses a user can be reached at
+type Recipient struct {
+	UserID     uint
+	Name       string
+	Email      string
+	WebhookURL string
+}
+
+// Channel delivers notifications outside the app
+type Channel interface {
+	// Name returns the channel name stored in the delivery log
+	Name() string
+	// Send delivers one message, errors wrapped with Permanent are not retried
+	Send(ctx context.Context, to Recipient, msg Message) error
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks an error that retrying cannot fix, such as a rejected address
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err: err}
+}
+
+// IsPermanent reports whether err was marked with Permanent
+func IsPermanent(err error) bool {
+	var p permanentError
+	return errors.As(err, &p) || errors.Is(err, ErrNoAddress)
+}
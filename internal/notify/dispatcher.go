@@ -0,0 +1,224 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"mywall-api/internal/models"
+)
+
+// sendTimeout bounds a single delivery attempt
+const sendTimeout = 30 * time.Second
+
+// RetryPolicy controls how failed deliveries are retried
+type RetryPolicy struct {
+	MaxAttempts int           // Attempts per channel, including the first
+	Backoff     time.Duration // Wait before the first retry, doubled after each one
+}
+
+// Dispatcher delivers notifications through the channels a user enabled for
+// their type and records every attempt in the delivery log
+type Dispatcher struct {
+	db       *gorm.DB
+	channels map[string]Channel
+	retry    RetryPolicy
+
+	mu      sync.Mutex
+	closing bool
+	stop    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewDispatcher creates a dispatcher, channels that are not configured are
+// simply left out and their deliveries are logged as failed
+func NewDispatcher(db *gorm.DB, retry RetryPolicy, channels ...Channel) *Dispatcher {
+	if retry.MaxAttempts < 1 {
+		retry.MaxAttempts = 1
+	}
+	d := &Dispatcher{
+		db:       db,
+		channels: make(map[string]Channel),
+		retry:    retry,
+		stop:     make(chan struct{}),
+	}
+	for _, ch := range channels {
+		d.channels[ch.Name()] = ch
+	}
+	return d
+}
+
+// Preference returns the user's preference for a type, falling back to their
+// default row and then to in-app only
+func (d *Dispatcher) Preference(userID uint, notifType string) (models.NotificationPreference, error) {
+	var prefs []models.NotificationPreference
+	err := d.db.Where("user_id = ? AND type IN ?", userID, []string{notifType, models.NotificationTypeDefault}).
+		Find(&prefs).Error
+	if err != nil {
+		return models.NotificationPreference{}, err
+	}
+
+	pref := models.DefaultNotificationPreference(userID, notifType)
+	for _, p := range prefs {
+		if p.Type == notifType {
+			return p, nil
+		}
+		pref = p
+	}
+	return pref, nil
+}
+
+// Deliver logs the in-app delivery and sends the notification through the
+// other enabled channels in the background
+func (d *Dispatcher) Deliver(n models.Notification, metadata map[string]interface{}, pref models.NotificationPreference) {
+	if pref.Muted {
+		return
+	}
+	if pref.InApp {
+		now := time.Now()
+		d.record(&models.NotificationDelivery{
+			NotificationID: n.ID,
+			UserID:         n.UserID,
+			Channel:        ChannelInApp,
+			Status:         models.DeliverySent,
+			Attempts:       1,
+			DeliveredAt:    &now,
+		})
+	}
+
+	var external []string
+	if pref.Email {
+		external = append(external, ChannelEmail)
+	}
+	if pref.Webhook {
+		external = append(external, ChannelWebhook)
+	}
+	if len(external) == 0 {
+		return
+	}
+
+	var user models.User
+	if err := d.db.Select("id", "name", "email").First(&user, n.UserID).Error; err != nil {
+		log.Printf("⚠️  Notification %s: failed to load recipient: %v", n.ID, err)
+		return
+	}
+	to := Recipient{UserID: user.ID, Name: user.Name, Email: user.Email, WebhookURL: pref.WebhookURL}
+	msg := Message{
+		NotificationID: n.ID,
+		UserID:         n.UserID,
+		Type:           n.Type,
+		Title:          n.Title,
+		Body:           n.Body,
+		Metadata:       metadata,
+		CreatedAt:      n.CreatedAt,
+	}
+
+	for _, name := range external {
+		delivery := &models.NotificationDelivery{
+			NotificationID: n.ID,
+			UserID:         n.UserID,
+			Channel:        name,
+			Status:         models.DeliveryPending,
+		}
+		ch, ok := d.channels[name]
+		if !ok {
+			delivery.Status = models.DeliveryFailed
+			delivery.LastError = "channel not configured"
+			d.record(delivery)
+			continue
+		}
+		if !d.start() {
+			delivery.Status = models.DeliveryFailed
+			delivery.LastError = "dispatcher shutting down"
+			d.record(delivery)
+			continue
+		}
+		d.record(delivery)
+		go d.send(ch, delivery, to, msg)
+	}
+}
+
+// start registers a background delivery unless the dispatcher is closing
+func (d *Dispatcher) start() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closing {
+		return false
+	}
+	d.wg.Add(1)
+	return true
+}
+
+// send tries a channel until it succeeds, fails permanently or runs out of attempts
+func (d *Dispatcher) send(ch Channel, delivery *models.NotificationDelivery, to Recipient, msg Message) {
+	defer d.wg.Done()
+
+	backoff := d.retry.Backoff
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+		err := ch.Send(ctx, to, msg)
+		cancel()
+
+		delivery.Attempts++
+		if err == nil {
+			now := time.Now()
+			delivery.Status = models.DeliverySent
+			delivery.LastError = ""
+			delivery.DeliveredAt = &now
+			d.record(delivery)
+			return
+		}
+
+		delivery.LastError = err.Error()
+		if IsPermanent(err) || delivery.Attempts >= d.retry.MaxAttempts {
+			delivery.Status = models.DeliveryFailed
+			d.record(delivery)
+			log.Printf("⚠️  Notification %s: %s delivery failed after %d attempts: %v",
+				msg.NotificationID, ch.Name(), delivery.Attempts, err)
+			return
+		}
+		d.record(delivery)
+
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-d.stop:
+			// Left pending in the log, the last error says why
+			return
+		}
+	}
+}
+
+// record saves the delivery log row, logging rather than failing the delivery
+func (d *Dispatcher) record(delivery *models.NotificationDelivery) {
+	if err := d.db.Save(delivery).Error; err != nil {
+		log.Printf("⚠️  Notification %s: failed to log %s delivery: %v",
+			delivery.NotificationID, delivery.Channel, err)
+	}
+}
+
+// Shutdown stops accepting deliveries, abandons pending retries and waits for
+// attempts in progress to finish
+func (d *Dispatcher) Shutdown(ctx context.Context) error {
+	d.mu.Lock()
+	if !d.closing {
+		d.closing = true
+		close(d.stop)
+	}
+	d.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("notification deliveries still in progress: %w", ctx.Err())
+	}
+}
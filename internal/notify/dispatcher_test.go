@@ -0,0 +1,160 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"mywall-api/internal/models"
+)
+
+// fakeChannel fails its first failures sends with err, then succeeds
+type fakeChannel struct {
+	name     string
+	failures int
+	err      error
+
+	mu    sync.Mutex
+	calls int
+}
+
+func (f *fakeChannel) Name() string { return f.name }
+
+func (f *fakeChannel) Send(ctx context.Context, to Recipient, msg Message) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if f.calls <= f.failures {
+		return f.err
+	}
+	return nil
+}
+
+func (f *fakeChannel) Calls() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1) // one in-memory database for the whole test
+	if err := db.AutoMigrate(&models.User{}, &models.NotificationDelivery{}, &models.NotificationPreference{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// deliverAndWait delivers one notification by email, waits until its delivery
+// log row satisfies done, then shuts the dispatcher down and returns the row
+func deliverAndWait(t *testing.T, d *Dispatcher, db *gorm.DB, done func(models.NotificationDelivery) bool) models.NotificationDelivery {
+	t.Helper()
+	user := models.User{Email: "ana@example.com", Name: "Ana"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	pref := models.DefaultNotificationPreference(user.ID, "system")
+	pref.Email = true
+	d.Deliver(models.Notification{ID: "n-1", UserID: user.ID, Type: "system", Title: "t"}, nil, pref)
+
+	load := func() models.NotificationDelivery {
+		var delivery models.NotificationDelivery
+		if err := db.Where("notification_id = ? AND channel = ?", "n-1", ChannelEmail).First(&delivery).Error; err != nil {
+			t.Fatal(err)
+		}
+		return delivery
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !done(load()) {
+		if time.Now().After(deadline) {
+			t.Fatalf("delivery never settled: %+v", load())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := d.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	return load()
+}
+
+// settled reports whether a delivery stopped being retried
+func settled(delivery models.NotificationDelivery) bool {
+	return delivery.Status != models.DeliveryPending
+}
+
+func TestDispatcherRetriesUntilSent(t *testing.T) {
+	db := newTestDB(t)
+	ch := &fakeChannel{name: ChannelEmail, failures: 2, err: errors.New("connection refused")}
+	d := NewDispatcher(db, RetryPolicy{MaxAttempts: 5, Backoff: time.Millisecond}, ch)
+
+	delivery := deliverAndWait(t, d, db, settled)
+	if ch.Calls() != 3 {
+		t.Errorf("calls = %d, want 3", ch.Calls())
+	}
+	if delivery.Status != models.DeliverySent || delivery.Attempts != 3 || delivery.DeliveredAt == nil || delivery.LastError != "" {
+		t.Errorf("delivery = %+v", delivery)
+	}
+}
+
+func TestDispatcherGivesUpAfterMaxAttempts(t *testing.T) {
+	db := newTestDB(t)
+	ch := &fakeChannel{name: ChannelEmail, failures: 10, err: errors.New("connection refused")}
+	d := NewDispatcher(db, RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}, ch)
+
+	delivery := deliverAndWait(t, d, db, settled)
+	if ch.Calls() != 3 {
+		t.Errorf("calls = %d, want 3", ch.Calls())
+	}
+	if delivery.Status != models.DeliveryFailed || delivery.Attempts != 3 || delivery.LastError != "connection refused" {
+		t.Errorf("delivery = %+v", delivery)
+	}
+}
+
+func TestDispatcherDoesNotRetryPermanentErrors(t *testing.T) {
+	db := newTestDB(t)
+	ch := &fakeChannel{name: ChannelEmail, failures: 10, err: Permanent(errors.New("550 no such user"))}
+	d := NewDispatcher(db, RetryPolicy{MaxAttempts: 5, Backoff: time.Millisecond}, ch)
+
+	delivery := deliverAndWait(t, d, db, settled)
+	if ch.Calls() != 1 || delivery.Status != models.DeliveryFailed || delivery.Attempts != 1 {
+		t.Errorf("calls = %d, delivery = %+v", ch.Calls(), delivery)
+	}
+}
+
+func TestDispatcherShutdownAbandonsPendingRetries(t *testing.T) {
+	db := newTestDB(t)
+	ch := &fakeChannel{name: ChannelEmail, failures: 10, err: errors.New("connection refused")}
+	d := NewDispatcher(db, RetryPolicy{MaxAttempts: 5, Backoff: time.Hour}, ch)
+
+	start := time.Now()
+	delivery := deliverAndWait(t, d, db, func(d models.NotificationDelivery) bool { return d.Attempts >= 1 })
+	if time.Since(start) > 5*time.Second {
+		t.Fatal("shutdown waited for the backoff")
+	}
+	if delivery.Status != models.DeliveryPending || delivery.Attempts != 1 || delivery.LastError == "" {
+		t.Errorf("delivery = %+v", delivery)
+	}
+}
+
+func TestDispatcherUnconfiguredChannelFails(t *testing.T) {
+	db := newTestDB(t)
+	d := NewDispatcher(db, RetryPolicy{MaxAttempts: 3})
+
+	delivery := deliverAndWait(t, d, db, settled)
+	if delivery.Status != models.DeliveryFailed || delivery.LastError != "channel not configured" {
+		t.Errorf("delivery = %+v", delivery)
+	}
+}
@@ -0,0 +1,144 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SMTPOptions configures the email channel
+type SMTPOptions struct {
+	Host     string
+	Port     int
+	Username string // Leave empty for servers without auth, such as a local sink
+	Password string
+	From     string // e.g. "MyWall <no-reply@example.com>"
+}
+
+// SMTPChannel sends notifications as plain text email
+type SMTPChannel struct {
+	opts SMTPOptions
+	from *mail.Address
+}
+
+// NewSMTP creates the email channel
+func NewSMTP(opts SMTPOptions) (*SMTPChannel, error) {
+	if opts.Host == "" {
+		return nil, fmt.Errorf("smtp host is required")
+	}
+	from, err := mail.ParseAddress(opts.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid smtp from address: %w", err)
+	}
+	return &SMTPChannel{opts: opts, from: from}, nil
+}
+
+func (s *SMTPChannel) Name() string {
+	return ChannelEmail
+}
+
+// Send delivers the message, upgrading to TLS when the server offers STARTTLS
+func (s *SMTPChannel) Send(ctx context.Context, to Recipient, msg Message) error {
+	if to.Email == "" {
+		return ErrNoAddress
+	}
+	rcpt, err := mail.ParseAddress(to.Email)
+	if err != nil {
+		return Permanent(fmt.Errorf("invalid email address: %w", err))
+	}
+	rcpt.Name = to.Name
+
+	addr := net.JoinHostPort(s.opts.Host, strconv.Itoa(s.opts.Port))
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, s.opts.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: s.opts.Host}); err != nil {
+			return err
+		}
+	}
+	if s.opts.Username != "" {
+		auth := smtp.PlainAuth("", s.opts.Username, s.opts.Password, s.opts.Host)
+		if err := client.Auth(auth); err != nil {
+			return Permanent(err)
+		}
+	}
+
+	if err := client.Mail(s.from.Address); err != nil {
+		return err
+	}
+	if err := client.Rcpt(rcpt.Address); err != nil {
+		// 5xx replies reject the address for good
+		var te *textproto.Error
+		if errors.As(err, &te) && te.Code >= 500 {
+			return Permanent(err)
+		}
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(s.compose(rcpt, msg)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// compose builds the RFC 5322 message
+func (s *SMTPChannel) compose(rcpt *mail.Address, msg Message) []byte {
+	var buf bytes.Buffer
+	header := func(key, value string) {
+		fmt.Fprintf(&buf, "%s: %s\r\n", key, value)
+	}
+	header("From", s.from.String())
+	header("To", rcpt.String())
+	header("Subject", mime.QEncoding.Encode("utf-8", msg.Title))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", s.messageID())
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("Content-Transfer-Encoding", "8bit")
+	header("X-MyWall-Notification", msg.NotificationID)
+	buf.WriteString("\r\n")
+
+	body := strings.ReplaceAll(msg.Body, "\r\n", "\n")
+	buf.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	buf.WriteString("\r\n")
+	return buf.Bytes()
+}
+
+func (s *SMTPChannel) messageID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	domain := s.from.Address[strings.LastIndex(s.from.Address, "@")+1:]
+	return "<" + hex.EncodeToString(b) + "@" + domain + ">"
+}
@@ -0,0 +1,183 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// smtpSink is a minimal SMTP server that records the messages it accepts
+type smtpSink struct {
+	ln         net.Listener
+	rejectRcpt string // RCPT TO reply, defaults to 250
+
+	mu   sync.Mutex
+	from string
+	rcpt []string
+	data string
+}
+
+func newSMTPSink(t *testing.T) *smtpSink {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := &smtpSink{ln: ln}
+	t.Cleanup(func() { ln.Close() })
+	go sink.serve()
+	return sink
+}
+
+func (s *smtpSink) port() int {
+	return s.ln.Addr().(*net.TCPAddr).Port
+}
+
+func (s *smtpSink) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *smtpSink) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+	reply("220 sink ready")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		cmd := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 sink")
+		case strings.HasPrefix(cmd, "MAIL FROM:"):
+			s.mu.Lock()
+			s.from = strings.Trim(line[len("MAIL FROM:"):], "<> ")
+			s.mu.Unlock()
+			reply("250 ok")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			if s.rejectRcpt != "" {
+				reply(s.rejectRcpt)
+				continue
+			}
+			s.mu.Lock()
+			s.rcpt = append(s.rcpt, strings.Trim(line[len("RCPT TO:"):], "<> "))
+			s.mu.Unlock()
+			reply("250 ok")
+		case cmd == "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(l)
+			}
+			s.mu.Lock()
+			s.data = data.String()
+			s.mu.Unlock()
+			reply("250 queued")
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+func newTestSMTP(t *testing.T, sink *smtpSink) *SMTPChannel {
+	t.Helper()
+	ch, err := NewSMTP(SMTPOptions{Host: "127.0.0.1", Port: sink.port(), From: "MyWall <no-reply@mywall.test>"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ch
+}
+
+func TestSMTPSendDeliversToSink(t *testing.T) {
+	sink := newSMTPSink(t)
+	ch := newTestSMTP(t, sink)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := ch.Send(ctx, Recipient{Name: "Ana", Email: "ana@example.com"}, Message{
+		NotificationID: "n-1",
+		Title:          "Galeri Dibuat ✓",
+		Body:           "line one\nline two",
+	})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	if sink.from != "no-reply@mywall.test" {
+		t.Errorf("MAIL FROM = %q", sink.from)
+	}
+	if len(sink.rcpt) != 1 || sink.rcpt[0] != "ana@example.com" {
+		t.Errorf("RCPT TO = %v", sink.rcpt)
+	}
+	for _, want := range []string{
+		"To: \"Ana\" <ana@example.com>\r\n",
+		"Subject: =?utf-8?q?",
+		"X-MyWall-Notification: n-1\r\n",
+		"\r\n\r\nline one\r\nline two\r\n",
+	} {
+		if !strings.Contains(sink.data, want) {
+			t.Errorf("message missing %q:\n%s", want, sink.data)
+		}
+	}
+}
+
+func TestSMTPSendRejectedRecipientIsPermanent(t *testing.T) {
+	sink := newSMTPSink(t)
+	sink.rejectRcpt = "550 no such user"
+	ch := newTestSMTP(t, sink)
+
+	err := ch.Send(context.Background(), Recipient{Email: "nobody@example.com"}, Message{Title: "x"})
+	if err == nil || !IsPermanent(err) {
+		t.Fatalf("Send = %v, want a permanent error", err)
+	}
+}
+
+func TestSMTPSendTemporaryFailureIsRetryable(t *testing.T) {
+	sink := newSMTPSink(t)
+	sink.rejectRcpt = "451 try again later"
+	ch := newTestSMTP(t, sink)
+
+	err := ch.Send(context.Background(), Recipient{Email: "ana@example.com"}, Message{Title: "x"})
+	if err == nil || IsPermanent(err) {
+		t.Fatalf("Send = %v, want a retryable error", err)
+	}
+}
+
+func TestSMTPSendWithoutAddress(t *testing.T) {
+	ch, err := NewSMTP(SMTPOptions{Host: "127.0.0.1", Port: 1, From: "no-reply@mywall.test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ch.Send(context.Background(), Recipient{}, Message{}); !IsPermanent(err) {
+		t.Fatalf("Send = %v, want ErrNoAddress", err)
+	}
+	if err := ch.Send(context.Background(), Recipient{Email: "not an address"}, Message{}); !IsPermanent(err) {
+		t.Fatalf("Send = %v, want a permanent error", err)
+	}
+}
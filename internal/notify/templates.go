@@ -0,0 +1,137 @@
+package notify
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// DefaultLocale is used when a user's locale has no template for an event type
+const DefaultLocale = "en"
+
+// ErrNoTemplate means no template is registered for the event type
+var ErrNoTemplate = errors.New("no notification template for event type")
+
+// templateFuncs are available in every template
+var templateFuncs = template.FuncMap{
+	// plural picks the singular or plural word for a count, e.g. {{plural .count "gallery" "galleries"}}
+	"plural": func(count interface{}, singular, plural string) string {
+		if fmt.Sprint(count) == "1" {
+			return singular
+		}
+		return plural
+	},
+}
+
+// notificationTemplate renders the title and body of one event type in one locale
+type notificationTemplate struct {
+	title *template.Template
+	body  *template.Template
+}
+
+// Templates is a registry of notification templates keyed by event type and
+// locale. Templates use text/template and are rendered with the event metadata.
+type Templates struct {
+	mu      sync.RWMutex
+	byType  map[string]map[string]*notificationTemplate
+	locales map[string]bool
+}
+
+// NewTemplates creates an empty registry
+func NewTemplates() *Templates {
+	return &Templates{
+		byType:  make(map[string]map[string]*notificationTemplate),
+		locales: map[string]bool{DefaultLocale: true},
+	}
+}
+
+// Register parses and adds the template of an event type in a locale,
+// replacing any previous one
+func (r *Templates) Register(eventType, locale, title, body string) error {
+	name := eventType + "." + locale
+	t, err := template.New(name + ".title").Funcs(templateFuncs).Option("missingkey=error").Parse(title)
+	if err != nil {
+		return fmt.Errorf("template %s title: %w", name, err)
+	}
+	b, err := template.New(name + ".body").Funcs(templateFuncs).Option("missingkey=error").Parse(body)
+	if err != nil {
+		return fmt.Errorf("template %s body: %w", name, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.byType[eventType] == nil {
+		r.byType[eventType] = make(map[string]*notificationTemplate)
+	}
+	r.byType[eventType][locale] = &notificationTemplate{title: t, body: b}
+	r.locales[locale] = true
+	return nil
+}
+
+// Has reports whether an event type has a template in any locale
+func (r *Templates) Has(eventType string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.byType[eventType]) > 0
+}
+
+// Locales returns every locale with at least one template, sorted
+func (r *Templates) Locales() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	locales := make([]string, 0, len(r.locales))
+	for l := range r.locales {
+		locales = append(locales, l)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// Supports reports whether locale has templates, after normalization
+func (r *Templates) Supports(locale string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.locales[NormalizeLocale(locale)]
+}
+
+// Render renders the title and body of an event type in the user's locale,
+// falling back to DefaultLocale
+func (r *Templates) Render(eventType, locale string, data map[string]interface{}) (title, body string, err error) {
+	r.mu.RLock()
+	byLocale := r.byType[eventType]
+	t := byLocale[NormalizeLocale(locale)]
+	if t == nil {
+		t = byLocale[DefaultLocale]
+	}
+	r.mu.RUnlock()
+	if t == nil {
+		return "", "", fmt.Errorf("%w %q", ErrNoTemplate, eventType)
+	}
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+
+	var buf bytes.Buffer
+	if err := t.title.Execute(&buf, data); err != nil {
+		return "", "", err
+	}
+	title = buf.String()
+	buf.Reset()
+	if err := t.body.Execute(&buf, data); err != nil {
+		return "", "", err
+	}
+	return title, buf.String(), nil
+}
+
+// NormalizeLocale reduces a locale such as "id-ID" or "en_US" to its language
+func NormalizeLocale(locale string) string {
+	locale = strings.ToLower(strings.TrimSpace(locale))
+	if i := strings.IndexAny(locale, "-_"); i >= 0 {
+		locale = locale[:i]
+	}
+	return locale
+}
@@ -0,0 +1,82 @@
+package notify
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRenderLocalized(t *testing.T) {
+	r := DefaultTemplates()
+	data := map[string]interface{}{"title": "Sunset"}
+
+	tests := []struct {
+		locale, title, body string
+	}{
+		{"en", "Gallery Created", `Your gallery "Sunset" has been created.`},
+		{"id", "Galeri Dibuat", `Galeri "Sunset" berhasil dibuat.`},
+		{"id-ID", "Galeri Dibuat", `Galeri "Sunset" berhasil dibuat.`},
+		{" ID_id ", "Galeri Dibuat", `Galeri "Sunset" berhasil dibuat.`},
+		// Locales without templates fall back to DefaultLocale
+		{"fr", "Gallery Created", `Your gallery "Sunset" has been created.`},
+		{"", "Gallery Created", `Your gallery "Sunset" has been created.`},
+	}
+	for _, tt := range tests {
+		title, body, err := r.Render(EventGalleryCreated, tt.locale, data)
+		if err != nil || title != tt.title || body != tt.body {
+			t.Errorf("Render(%q) = %q, %q, %v", tt.locale, title, body, err)
+		}
+	}
+}
+
+func TestRenderFallsBackPerEventType(t *testing.T) {
+	r := NewTemplates()
+	if err := r.Register("comment.created", DefaultLocale, "New comment", "{{.author}} commented"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register("like.created", "id", "Suka baru", "{{.author}} menyukai"); err != nil {
+		t.Fatal(err)
+	}
+
+	// id is a known locale, but comment.created has no id template
+	title, body, err := r.Render("comment.created", "id", map[string]interface{}{"author": "Budi"})
+	if err != nil || title != "New comment" || body != "Budi commented" {
+		t.Fatalf("Render = %q, %q, %v", title, body, err)
+	}
+	// Nothing to fall back to without a DefaultLocale template
+	if _, _, err := r.Render("like.created", "fr", nil); !errors.Is(err, ErrNoTemplate) {
+		t.Fatalf("Render without default = %v, want ErrNoTemplate", err)
+	}
+	if _, _, err := r.Render("unknown", "en", nil); !errors.Is(err, ErrNoTemplate) {
+		t.Fatalf("Render unknown type = %v, want ErrNoTemplate", err)
+	}
+}
+
+func TestRenderPluralAndMissingKeys(t *testing.T) {
+	r := DefaultTemplates()
+	one := map[string]interface{}{"count": 1, "items": []string{"a"}}
+	if _, body, err := r.Render(EventDigestDaily, "en", one); err != nil || body != "1 new notification since yesterday:\n- a" {
+		t.Fatalf("Render = %q, %v", body, err)
+	}
+	two := map[string]interface{}{"count": 2, "items": []string{"a", "b"}}
+	if _, body, err := r.Render(EventDigestDaily, "en", two); err != nil || body != "2 new notifications since yesterday:\n- a\n- b" {
+		t.Fatalf("Render = %q, %v", body, err)
+	}
+
+	// Metadata missing a key the template uses is an error, not "<no value>"
+	if _, _, err := r.Render(EventGalleryCreated, "en", nil); err == nil {
+		t.Fatal("Render without title succeeded")
+	}
+}
+
+func TestTemplateLocales(t *testing.T) {
+	r := DefaultTemplates()
+	if got := r.Locales(); len(got) != 2 || got[0] != "en" || got[1] != "id" {
+		t.Fatalf("Locales = %v", got)
+	}
+	if !r.Supports("id-ID") || r.Supports("fr") {
+		t.Fatal("Supports")
+	}
+	if err := r.Register("bad", "en", "{{.title", ""); err == nil {
+		t.Fatal("Register accepted an invalid template")
+	}
+}
@@ -0,0 +1,183 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrWebhookAddress is returned for webhook URLs that are not https or point
+// at a loopback, private, link-local or otherwise internal address
+var ErrWebhookAddress = errors.New("webhook address is not allowed")
+
+// internalNetworks are ranges net.IP has no predicate for
+var internalNetworks = []*net.IPNet{
+	mustCIDR("0.0.0.0/8"),     // "this" network
+	mustCIDR("100.64.0.0/10"), // carrier-grade NAT
+	mustCIDR("192.0.0.0/24"),  // IETF protocol assignments
+	mustCIDR("198.18.0.0/15"), // benchmarking
+}
+
+// nat64Prefix embeds an IPv4 address in the last 4 bytes
+var nat64Prefix = mustCIDR("64:ff9b::/96")
+
+func mustCIDR(cidr string) *net.IPNet {
+	_, n, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+// isPublicIP reports whether ip is reachable on the internet, as opposed to
+// the server's own host and networks
+func isPublicIP(ip net.IP) bool {
+	if nat64Prefix.Contains(ip) {
+		ip = ip[12:16]
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, n := range internalNetworks {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidateWebhookURL checks a webhook URL before it is saved: https only, and
+// no host that obviously points inside. Hostnames are checked again on every
+// connection, after DNS resolution.
+func ValidateWebhookURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "https" || u.Hostname() == "" || u.User != nil {
+		return ErrWebhookAddress
+	}
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return ErrWebhookAddress
+	}
+	if ip := net.ParseIP(host); ip != nil && !isPublicIP(ip) {
+		return ErrWebhookAddress
+	}
+	return nil
+}
+
+// WebhookChannel posts notifications as JSON to the URL set in the user's preference
+type WebhookChannel struct {
+	client *http.Client
+	secret []byte
+}
+
+// NewWebhook creates the webhook channel. With a secret every request carries
+// X-MyWall-Signature, the hex HMAC-SHA256 of the body, so receivers can verify it.
+//
+// URLs are chosen by users, so the client only connects to public addresses.
+// The check runs on the resolved address of each connection, which DNS
+// rebinding cannot get around, and redirects are not followed.
+func NewWebhook(secret string, timeout time.Duration) *WebhookChannel {
+	return newWebhook(secret, timeout, isPublicIP)
+}
+
+func newWebhook(secret string, timeout time.Duration, allowed func(net.IP) bool) *WebhookChannel {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !allowed(ip) {
+				return ErrWebhookAddress
+			}
+			return nil
+		},
+	}
+	transport := &http.Transport{
+		Proxy:               nil, // a proxy would connect on our behalf, unchecked
+		DialContext:         dialer.DialContext,
+		TLSHandshakeTimeout: timeout,
+		MaxIdleConns:        10,
+		IdleConnTimeout:     90 * time.Second,
+	}
+	return &WebhookChannel{
+		client: &http.Client{
+			Timeout:   timeout,
+			Transport: transport,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		secret: []byte(secret),
+	}
+}
+
+func (w *WebhookChannel) Name() string {
+	return ChannelWebhook
+}
+
+// Send posts the message, any 2xx reply counts as delivered
+func (w *WebhookChannel) Send(ctx context.Context, to Recipient, msg Message) error {
+	if to.WebhookURL == "" {
+		return ErrNoAddress
+	}
+	if u, err := url.Parse(to.WebhookURL); err != nil || u.Scheme != "https" {
+		return Permanent(ErrWebhookAddress)
+	}
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return Permanent(err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, to.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return Permanent(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "MyWall-Webhook/1.0")
+	req.Header.Set("X-MyWall-Event", msg.Type)
+	req.Header.Set("X-MyWall-Delivery", msg.NotificationID)
+	if len(w.secret) > 0 {
+		mac := hmac.New(sha256.New, w.secret)
+		mac.Write(body)
+		req.Header.Set("X-MyWall-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		if errors.Is(err, ErrWebhookAddress) {
+			// Same error whatever listens there, the log must not probe the network
+			return Permanent(ErrWebhookAddress)
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	err = fmt.Errorf("webhook responded with %s", resp.Status)
+	// Redirects are not followed and client errors will not change on retry,
+	// except timeouts and rate limits
+	if resp.StatusCode >= 300 && resp.StatusCode < 500 &&
+		resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+		return Permanent(err)
+	}
+	return err
+}
@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+// Storage errors
+var (
+	ErrNotFound     = errors.New("object not found")
+	ErrInvalidKey   = errors.New("invalid object key")
+	ErrNotSupported = errors.New("operation not supported by storage backend")
+)
+
+// Storage stores uploaded files under slash separated keys such as uploads/2025/06/05/name.jpg
+type Storage interface {
+	// Save writes the object, replacing any existing object with the same key
+	Save(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Open returns a reader for the object, the caller must close it
+	Open(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error)
+	// Stat returns the object metadata
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+	// Delete removes the object, deleting a missing object is not an error
+	Delete(ctx context.Context, key string) error
+	// SignedURL returns a time limited URL for direct download, or ErrNotSupported
+	SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error)
+}
+
+// ObjectInfo describes a stored object
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	ContentType  string
+	LastModified time.Time
+	ETag         string
+}
+
+// UploadPrefix is the root every upload key lives under
+const UploadPrefix = "uploads"
+
+// DateKey builds an upload key of the form uploads/YYYY/MM/DD/filename
+func DateKey(t time.Time, filename string) string {
+	return fmt.Sprintf("%s/%d/%02d/%02d/%s", UploadPrefix, t.Year(), t.Month(), t.Day(), filename)
+}
+
+// CleanKey normalizes a key and rejects keys escaping the storage root
+func CleanKey(key string) (string, error) {
+	key = strings.ReplaceAll(key, "\\", "/")
+	cleaned := path.Clean("/" + key)
+	if cleaned == "/" || strings.Contains(key, "..") {
+		return "", ErrInvalidKey
+	}
+	return strings.TrimPrefix(cleaned, "/"), nil
+}
@@ -0,0 +1,25 @@
+-- Migration: create_user_roles_table
+-- Created at: 2026-10-17T09:00:00+07:00
+-- Up
+
+-- Write your up migration here
+CREATE TABLE IF NOT EXISTS user_roles (
+    user_id INT NOT NULL,
+    role_id VARCHAR(20) NOT NULL,
+    assigned_by INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, role_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (role_id) REFERENCES roles(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE INDEX idx_user_roles_role_id ON user_roles(role_id);
+
+-- Link existing users to the role named by their legacy role column
+INSERT IGNORE INTO user_roles (user_id, role_id)
+SELECT users.id, roles.id FROM users JOIN roles ON roles.id = users.role;
+
+-- Down
+-- Uncomment if you want to use down migrations
+DROP TABLE IF EXISTS user_roles;
+-- Write your down migration here
@@ -0,0 +1,27 @@
+-- Migration: create_refresh_tokens_table
+-- Created at: 2026-10-17T09:15:00+07:00
+-- Up
+
+-- Write your up migration here
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP NULL,
+    user_id INT NOT NULL,
+    token_hash CHAR(64) NOT NULL,
+    family_id CHAR(36) NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP NULL,
+    replaced_by_id INT NULL,
+    UNIQUE KEY unique_token_hash (token_hash),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE INDEX idx_refresh_tokens_user_id ON refresh_tokens(user_id);
+CREATE INDEX idx_refresh_tokens_family_id ON refresh_tokens(family_id);
+
+-- Down
+-- Uncomment if you want to use down migrations
+DROP TABLE IF EXISTS refresh_tokens;
+-- Write your down migration here
@@ -0,0 +1,36 @@
+-- Migration: create_api_keys_table
+-- Created at: 2026-10-17T09:30:00+07:00
+-- Up
+
+-- Write your up migration here
+CREATE TABLE IF NOT EXISTS api_keys (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP NULL,
+    user_id INT NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    prefix VARCHAR(12) NOT NULL,
+    key_hash CHAR(64) NOT NULL,
+    scopes VARCHAR(500) NOT NULL DEFAULT '*',
+    expires_at TIMESTAMP NULL,
+    last_used_at TIMESTAMP NULL,
+    is_active BOOLEAN DEFAULT true,
+    UNIQUE KEY unique_key_hash (key_hash),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE INDEX idx_api_keys_user_id ON api_keys(user_id);
+
+-- Move the plaintext key of every user into the hashed store
+INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes)
+SELECT id, 'default', LEFT(api_key, 8), SHA2(api_key, 256), '*' FROM users
+WHERE api_key IS NOT NULL AND api_key <> '';
+
+ALTER TABLE users DROP COLUMN api_key;
+
+-- Down
+-- Uncomment if you want to use down migrations
+ALTER TABLE users ADD COLUMN api_key VARCHAR(64) UNIQUE;
+DROP TABLE IF EXISTS api_keys;
+-- Write your down migration here
@@ -0,0 +1,13 @@
+-- Migration: add_field_renditions_gallery
+-- Created at: 2026-10-17T09:45:00+07:00
+-- Up
+
+-- Write your up migration here
+ALTER TABLE galleries
+    ADD COLUMN renditions TEXT NULL;
+
+-- Down
+-- Uncomment if you want to use down migrations
+ALTER TABLE galleries
+    DROP COLUMN renditions;
+-- Write your down migration here
@@ -0,0 +1,17 @@
+-- Migration: add_field_archived_at_notification
+-- Created at: 2026-10-17T10:00:00+07:00
+-- Up
+
+-- Write your up migration here
+ALTER TABLE notifications
+    ADD COLUMN archived_at TIMESTAMP NULL;
+
+-- Inbox listing is by user, newest first, with archived rows filtered out
+CREATE INDEX notifications_user_archived_created_idx ON notifications (user_id, archived_at, created_at);
+
+-- Down
+-- Uncomment if you want to use down migrations
+DROP INDEX notifications_user_archived_created_idx ON notifications;
+ALTER TABLE notifications
+    DROP COLUMN archived_at;
+-- Write your down migration here
@@ -0,0 +1,43 @@
+-- Migration: create_notification_preferences_table
+-- Created at: 2026-10-17T10:15:00+07:00
+-- Up
+
+-- Write your up migration here
+CREATE TABLE IF NOT EXISTS notification_preferences (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP NULL,
+    user_id INT NOT NULL,
+    type VARCHAR(100) NOT NULL,
+    in_app BOOLEAN NOT NULL DEFAULT true,
+    email BOOLEAN NOT NULL DEFAULT false,
+    webhook BOOLEAN NOT NULL DEFAULT false,
+    webhook_url VARCHAR(500) NOT NULL DEFAULT '',
+    muted BOOLEAN NOT NULL DEFAULT false,
+    UNIQUE KEY unique_user_type (user_id, type),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE TABLE IF NOT EXISTS notification_deliveries (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP NULL,
+    notification_id VARCHAR(36) NOT NULL,
+    user_id INT NOT NULL,
+    channel VARCHAR(20) NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT,
+    delivered_at TIMESTAMP NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE INDEX idx_notification_deliveries_notification_id ON notification_deliveries(notification_id);
+CREATE INDEX idx_notification_deliveries_user_id ON notification_deliveries(user_id);
+
+-- Down
+-- Uncomment if you want to use down migrations
+DROP TABLE IF EXISTS notification_deliveries;
+DROP TABLE IF EXISTS notification_preferences;
+-- Write your down migration here
@@ -0,0 +1,13 @@
+-- Migration: add_field_locale_user
+-- Created at: 2026-10-17T10:30:00+07:00
+-- Up
+
+-- Write your up migration here
+ALTER TABLE users
+    ADD COLUMN locale VARCHAR(10) NOT NULL DEFAULT 'en';
+
+-- Down
+-- Uncomment if you want to use down migrations
+ALTER TABLE users
+    DROP COLUMN locale;
+-- Write your down migration here
@@ -0,0 +1,29 @@
+-- Migration: add_notification_batching_and_digests
+-- Created at: 2026-10-17T10:45:00+07:00
+-- Up
+
+-- Write your up migration here
+ALTER TABLE notifications
+    ADD COLUMN count INT NOT NULL DEFAULT 1;
+
+CREATE TABLE IF NOT EXISTS notification_digests (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP NULL,
+    user_id INT NOT NULL,
+    frequency VARCHAR(10) NOT NULL,
+    next_run_at TIMESTAMP NOT NULL,
+    last_sent_at TIMESTAMP NULL,
+    UNIQUE KEY unique_user_id (user_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE INDEX idx_notification_digests_next_run_at ON notification_digests(next_run_at);
+
+-- Down
+-- Uncomment if you want to use down migrations
+DROP TABLE IF EXISTS notification_digests;
+ALTER TABLE notifications
+    DROP COLUMN count;
+-- Write your down migration here
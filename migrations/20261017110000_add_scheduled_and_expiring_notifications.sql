@@ -0,0 +1,39 @@
+-- Migration: add_scheduled_and_expiring_notifications
+-- Created at: 2026-10-17T11:00:00+07:00
+-- Up
+
+-- Write your up migration here
+ALTER TABLE notifications
+    ADD COLUMN expires_at TIMESTAMP NULL;
+
+CREATE INDEX idx_notifications_expires_at ON notifications(expires_at);
+
+CREATE TABLE IF NOT EXISTS scheduled_notifications (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP NULL,
+    user_id INT NOT NULL,
+    created_by INT NOT NULL,
+    title TEXT NOT NULL,
+    body TEXT NOT NULL,
+    type VARCHAR(50) NOT NULL,
+    metadata JSON,
+    send_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NULL,
+    status VARCHAR(20) NOT NULL,
+    notification_id VARCHAR(36) NOT NULL DEFAULT '',
+    last_error TEXT,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE INDEX idx_scheduled_notifications_status_send_at ON scheduled_notifications(status, send_at);
+CREATE INDEX idx_scheduled_notifications_created_by ON scheduled_notifications(created_by);
+
+-- Down
+-- Uncomment if you want to use down migrations
+DROP TABLE IF EXISTS scheduled_notifications;
+DROP INDEX idx_notifications_expires_at ON notifications;
+ALTER TABLE notifications
+    DROP COLUMN expires_at;
+-- Write your down migration here
@@ -0,0 +1,14 @@
+-- Migration: add_field_revoked_reason_refresh_token
+-- Created at: 2026-10-17T13:00:00+07:00
+-- Up
+
+-- Write your up migration here
+-- Tells a session ended by logout apart from one revoked on token reuse
+ALTER TABLE refresh_tokens
+    ADD COLUMN revoked_reason VARCHAR(20) NULL;
+
+-- Down
+-- Uncomment if you want to use down migrations
+ALTER TABLE refresh_tokens
+    DROP COLUMN revoked_reason;
+-- Write your down migration here
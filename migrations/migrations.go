@@ -0,0 +1,11 @@
+// Package migrations embeds the SQL migrations so binaries can migrate without
+// the directory at runtime
+package migrations
+
+import "embed"
+
+// FS holds every .sql file of this directory, MySQL ones at the root and the
+// other databases' in their postgres/ and sqlite/ subdirectories
+//
+//go:embed *.sql postgres/*.sql sqlite/*.sql
+var FS embed.FS
@@ -0,0 +1,242 @@
+-- Migration: create_schema
+-- Created at: 2026-10-17T12:00:00+07:00
+-- Up
+
+-- Write your up migration here
+-- Baseline of the MySQL migrations up to 20261017110000, later changes get their own files
+CREATE TABLE IF NOT EXISTS users (
+    id SERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMPTZ NULL,
+    email VARCHAR(255) NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    password VARCHAR(255) NOT NULL DEFAULT '',
+    role VARCHAR(20) DEFAULT 'user',
+    is_active BOOLEAN DEFAULT true,
+    locale VARCHAR(10) NOT NULL DEFAULT 'en',
+    CONSTRAINT unique_email UNIQUE (email)
+);
+
+CREATE TABLE IF NOT EXISTS categories (
+    id SERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMPTZ NULL,
+    name VARCHAR(50) NOT NULL,
+    image_url VARCHAR(255) NOT NULL,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT unique_name UNIQUE (name)
+);
+CREATE INDEX idx_categories_user_id ON categories(user_id);
+
+CREATE TABLE IF NOT EXISTS galleries (
+    id SERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMPTZ NULL,
+    title VARCHAR(255) NOT NULL,
+    description TEXT,
+    image_url VARCHAR(2048),
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    category VARCHAR(50) NOT NULL DEFAULT '',
+    category_id INT NOT NULL,
+    renditions TEXT NULL,
+    CONSTRAINT fk_galleries_category FOREIGN KEY (category_id) REFERENCES categories(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_galleries_user_id ON galleries(user_id);
+CREATE INDEX idx_galleries_category_id ON galleries(category_id);
+
+CREATE TABLE IF NOT EXISTS image_views (
+    gallery_id INT PRIMARY KEY REFERENCES galleries(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMPTZ NULL,
+    count INT DEFAULT 0,
+    user_id INT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS menus (
+    id VARCHAR(50) PRIMARY KEY,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMPTZ NULL,
+    path VARCHAR(150) NOT NULL,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT unique_path UNIQUE (path)
+);
+CREATE INDEX idx_menus_user_id ON menus(user_id);
+
+CREATE TABLE IF NOT EXISTS roles (
+    id VARCHAR(20) PRIMARY KEY,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMPTZ NULL,
+    name VARCHAR(100) NOT NULL,
+    description TEXT,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_roles_user_id ON roles(user_id);
+
+CREATE TABLE IF NOT EXISTS rbacs (
+    id SERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMPTZ NULL,
+    menu_id VARCHAR(50) NOT NULL REFERENCES menus(id) ON DELETE CASCADE,
+    permission VARCHAR(200) NOT NULL,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    owner_id INT NOT NULL,
+    role_id VARCHAR(20) NOT NULL,
+    CONSTRAINT fk_rbacs_owner FOREIGN KEY (owner_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT fk_rbacs_role FOREIGN KEY (role_id) REFERENCES roles(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_rbacs_user_id ON rbacs(user_id);
+CREATE INDEX idx_rbacs_menu_id ON rbacs(menu_id);
+CREATE INDEX idx_rbacs_owner_id ON rbacs(owner_id);
+CREATE INDEX idx_rbacs_role_id ON rbacs(role_id);
+
+CREATE TABLE IF NOT EXISTS user_roles (
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role_id VARCHAR(20) NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+    assigned_by INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, role_id)
+);
+CREATE INDEX idx_user_roles_role_id ON user_roles(role_id);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id SERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMPTZ NULL,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash CHAR(64) NOT NULL,
+    family_id CHAR(36) NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ NULL,
+    replaced_by_id INT NULL,
+    CONSTRAINT unique_token_hash UNIQUE (token_hash)
+);
+CREATE INDEX idx_refresh_tokens_user_id ON refresh_tokens(user_id);
+CREATE INDEX idx_refresh_tokens_family_id ON refresh_tokens(family_id);
+
+CREATE TABLE IF NOT EXISTS api_keys (
+    id SERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMPTZ NULL,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    prefix VARCHAR(12) NOT NULL,
+    key_hash CHAR(64) NOT NULL,
+    scopes VARCHAR(500) NOT NULL DEFAULT '*',
+    expires_at TIMESTAMPTZ NULL,
+    last_used_at TIMESTAMPTZ NULL,
+    is_active BOOLEAN DEFAULT true,
+    CONSTRAINT unique_key_hash UNIQUE (key_hash)
+);
+CREATE INDEX idx_api_keys_user_id ON api_keys(user_id);
+
+CREATE TABLE IF NOT EXISTS notifications (
+    id VARCHAR(40) PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    title TEXT NOT NULL,
+    body TEXT NOT NULL,
+    type VARCHAR(50) NOT NULL,
+    metadata JSONB,
+    is_read INT NOT NULL DEFAULT 0,
+    count INT NOT NULL DEFAULT 1,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMPTZ NULL,
+    archived_at TIMESTAMPTZ NULL,
+    expires_at TIMESTAMPTZ NULL
+);
+CREATE INDEX notifications_user_created_at_idx ON notifications (user_id, created_at);
+CREATE INDEX notifications_user_isread_idx ON notifications (user_id, is_read);
+CREATE INDEX notifications_user_archived_created_idx ON notifications (user_id, archived_at, created_at);
+CREATE INDEX idx_notifications_expires_at ON notifications(expires_at);
+
+CREATE TABLE IF NOT EXISTS notification_preferences (
+    id SERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMPTZ NULL,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    type VARCHAR(100) NOT NULL,
+    in_app BOOLEAN NOT NULL DEFAULT true,
+    email BOOLEAN NOT NULL DEFAULT false,
+    webhook BOOLEAN NOT NULL DEFAULT false,
+    webhook_url VARCHAR(500) NOT NULL DEFAULT '',
+    muted BOOLEAN NOT NULL DEFAULT false,
+    CONSTRAINT unique_user_type UNIQUE (user_id, type)
+);
+
+CREATE TABLE IF NOT EXISTS notification_deliveries (
+    id SERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMPTZ NULL,
+    notification_id VARCHAR(36) NOT NULL,
+    user_id INT NOT NULL,
+    channel VARCHAR(20) NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT,
+    delivered_at TIMESTAMPTZ NULL
+);
+CREATE INDEX idx_notification_deliveries_notification_id ON notification_deliveries(notification_id);
+CREATE INDEX idx_notification_deliveries_user_id ON notification_deliveries(user_id);
+
+CREATE TABLE IF NOT EXISTS notification_digests (
+    id SERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMPTZ NULL,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    frequency VARCHAR(10) NOT NULL,
+    next_run_at TIMESTAMPTZ NOT NULL,
+    last_sent_at TIMESTAMPTZ NULL,
+    CONSTRAINT unique_user_id UNIQUE (user_id)
+);
+CREATE INDEX idx_notification_digests_next_run_at ON notification_digests(next_run_at);
+
+CREATE TABLE IF NOT EXISTS scheduled_notifications (
+    id SERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMPTZ NULL,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_by INT NOT NULL,
+    title TEXT NOT NULL,
+    body TEXT NOT NULL,
+    type VARCHAR(50) NOT NULL,
+    metadata JSONB,
+    send_at TIMESTAMPTZ NOT NULL,
+    expires_at TIMESTAMPTZ NULL,
+    status VARCHAR(20) NOT NULL,
+    notification_id VARCHAR(36) NOT NULL DEFAULT '',
+    last_error TEXT
+);
+CREATE INDEX idx_scheduled_notifications_status_send_at ON scheduled_notifications(status, send_at);
+CREATE INDEX idx_scheduled_notifications_created_by ON scheduled_notifications(created_by);
+
+-- Down
+-- Uncomment if you want to use down migrations
+DROP TABLE IF EXISTS scheduled_notifications;
+DROP TABLE IF EXISTS notification_digests;
+DROP TABLE IF EXISTS notification_deliveries;
+DROP TABLE IF EXISTS notification_preferences;
+DROP TABLE IF EXISTS notifications;
+DROP TABLE IF EXISTS api_keys;
+DROP TABLE IF EXISTS refresh_tokens;
+DROP TABLE IF EXISTS user_roles;
+DROP TABLE IF EXISTS rbacs;
+DROP TABLE IF EXISTS roles;
+DROP TABLE IF EXISTS menus;
+DROP TABLE IF EXISTS image_views;
+DROP TABLE IF EXISTS galleries;
+DROP TABLE IF EXISTS categories;
+DROP TABLE IF EXISTS users;
+-- Write your down migration here